@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/btcsuite/btcutil/base58"
+	"strings"
+)
+
+// Base58PrefixPublicKey is the version prefix core puts in front of public
+// keys, and of txn hashes in the ids the indexer hands out, before encoding
+// them with Base58Check. It is what makes mainnet keys start with "BC1YL".
+var Base58PrefixPublicKey = [3]byte{0xcd, 0x14, 0x0}
+
+// Base58PrefixPublicKeyTestnet is the testnet version of
+// Base58PrefixPublicKey, which makes keys start with "tBC".
+var Base58PrefixPublicKeyTestnet = [3]byte{0x11, 0xc2, 0x0}
+
+// desoNetwork is a network whose keys we print.
+type desoNetwork struct {
+	Name            string
+	PublicKeyPrefix [3]byte
+}
+
+var (
+	networkMainnet = &desoNetwork{Name: "mainnet", PublicKeyPrefix: Base58PrefixPublicKey}
+	networkTestnet = &desoNetwork{Name: "testnet", PublicKeyPrefix: Base58PrefixPublicKeyTestnet}
+)
+
+var desoNetworks = []*desoNetwork{networkMainnet, networkTestnet}
+
+// keyNetwork is the network public keys, PKIDs and txn ids are printed for.
+// It is set once with -network, before anything is printed.
+var keyNetwork = networkMainnet
+
+func findNetwork(name string) (*desoNetwork, error) {
+	for _, network := range desoNetworks {
+		if network.Name == name {
+			return network, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown network %q, expected %s or %s", name, networkMainnet.Name, networkTestnet.Name)
+}
+
+// Base58CheckEncodeWithPrefix mirrors core's function of the same name: the
+// prefix and input followed by the first four bytes of their double sha256.
+func Base58CheckEncodeWithPrefix(input []byte, prefix [3]byte) string {
+	b := make([]byte, 0, len(prefix)+len(input)+4)
+	b = append(b, prefix[:]...)
+	b = append(b, input...)
+	first := sha256.Sum256(b)
+	cksum := sha256.Sum256(first[:])
+	b = append(b, cksum[:4]...)
+	return base58.Encode(b)
+}
+
+// PkToString returns the Base58Check encoding of a public key for
+// keyNetwork. Core encodes PKIDs the same way.
+func PkToString(pk []byte) string {
+	return Base58CheckEncodeWithPrefix(pk, keyNetwork.PublicKeyPrefix)
+}
+
+// Base58CheckDecodePrefix mirrors core's function of the same name. It checks
+// the checksum of input and splits what is left into the prefixLen byte
+// prefix and the result.
+func Base58CheckDecodePrefix(input string, prefixLen int) (_result []byte, _prefix []byte, _err error) {
+	decoded := base58.Decode(input)
+	if len(decoded) < prefixLen+4 {
+		return nil, nil, fmt.Errorf("Base58CheckDecodePrefix: Invalid input format")
+	}
+	first := sha256.Sum256(decoded[:len(decoded)-4])
+	cksum := sha256.Sum256(first[:])
+	if !bytes.Equal(cksum[:4], decoded[len(decoded)-4:]) {
+		return nil, nil, fmt.Errorf("Base58CheckDecodePrefix: Checksum does not match")
+	}
+	return decoded[prefixLen : len(decoded)-4], decoded[:prefixLen], nil
+}
+
+// parsePublicKey reads a public key given as Base58Check, for either network,
+// or as 33 hex encoded bytes. PKIDs are read the same way.
+func parsePublicKey(input string) ([]byte, error) {
+	input = strings.TrimSpace(input)
+	if len(input) == 2*33 {
+		if decoded, err := hex.DecodeString(input); err == nil {
+			return decoded, nil
+		}
+	}
+	decoded, prefix, err := Base58CheckDecodePrefix(input, 3)
+	if err != nil {
+		return nil, fmt.Errorf("parsePublicKey: %q is neither Base58Check nor hex: %v", input, err)
+	}
+	known := false
+	for _, network := range desoNetworks {
+		known = known || bytes.Equal(prefix, network.PublicKeyPrefix[:])
+	}
+	if !known {
+		return nil, fmt.Errorf("parsePublicKey: %q is neither a mainnet nor a testnet key", input)
+	}
+	if len(decoded) != 33 {
+		return nil, fmt.Errorf("parsePublicKey: %q holds %d bytes, expected 33", input, len(decoded))
+	}
+	return decoded, nil
+}
+
+// parsePKID reads a PKID given like parsePublicKey reads public keys.
+func parsePKID(input string) (*PKID, error) {
+	decoded, err := parsePublicKey(input)
+	if err != nil {
+		return nil, err
+	}
+	pkid := &PKID{}
+	copy(pkid[:], decoded)
+	return pkid, nil
+}
@@ -0,0 +1,1096 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// envDBDir names the badger directory of the node when no -db flag is passed.
+const envDBDir = "BADGER_DIR"
+
+// command is a single subcommand of the tool.
+type command struct {
+	name  string
+	args  string
+	usage string
+	run   func(ctx context.Context, opts *cliOptions, args []string) error
+}
+
+// cliOptions holds the flags shared by every subcommand.
+type cliOptions struct {
+	dbDir string
+	// openMode is openModeAuto, openModeReadOnly or openModeSnapshot,
+	// snapshotDir where snapshots are copied to.
+	openMode    string
+	snapshotDir string
+	// network is the network keys are printed for, mainnet or testnet.
+	network string
+
+	prefix string
+	// category selects every prefix tagged with it instead of -prefix.
+	category string
+	limit    int
+	format   string
+
+	// Bounds and order of scan, dump and count. start and end are hex keys
+	// relative to the prefix.
+	start   string
+	end     string
+	reverse bool
+
+	// Only used by watch, forward, sync and orderbook.
+	interval time.Duration
+	// Only used by forward.
+	backfill    bool
+	filtersPath string
+	// Only used by forward and replay.
+	configPath string
+	profile    string
+	// Only used by export, a directory or - for stdout.
+	outPath string
+	// Only used by validate.
+	sourcePath   string
+	upstreamPath string
+	// Only used by key.
+	isPKID bool
+	// Only used by serve.
+	addr string
+	// Only used by sync.
+	sqlDSN    string
+	tables    string
+	batchSize int
+	// Only used by orderbook.
+	showOrders bool
+	transactor string
+	watch      bool
+}
+
+var commands []*command
+
+func init() {
+	commands = []*command{
+		{name: "prefixes", usage: "List every prefix in DBPrefixes with its id and categories, or those of -category.", run: runPrefixes},
+		{name: "count", usage: "Count the keys stored under a prefix, or under each prefix of -category.", run: runCount},
+		{name: "stats", usage: "Walk the DB once and report the count, key and value sizes and disk share of every prefix, grouped by category.", run: runStats},
+		{name: "scan", usage: "Print up to -limit keys and values stored under a prefix, or under each prefix of -category.", run: runScan},
+		{name: "get", args: "<key hex>", usage: "Print the value stored under a single key. With -prefix the key is relative to the prefix.", run: runGet},
+		{name: "key", args: "<public key|PKID>", usage: "Convert a Base58Check or hex public key and resolve its PKID through [36], or with -pkid resolve a PKID to its public key through [37].", run: runKey},
+		{name: "profile", args: "<username|public key|PKID>", usage: "Print a profile with its creator coin's DeSo locked, coins in circulation, founder reward and price.", run: runProfile},
+		{name: "holders", args: "<username|public key|PKID>", usage: "Print who holds a creator coin, largest balance first, with each balance valued in DeSo on the creator's bonding curve. -limit keeps the largest holders only.", run: runHolders},
+		{name: "holdings", args: "<username|public key|PKID>", usage: "Print the creator coins a wallet holds, largest balance first, with each balance valued in DeSo on its creator's bonding curve. -limit keeps the largest holdings only.", run: runHoldings},
+		{name: "orderbook", args: "<base coin> [quote coin]", usage: "Print the DAO coin limit order book of a pair, DESO or a username, public key or PKID each, the quote defaulting to DESO: depth per price, best bid and ask and the spread. -limit keeps that many levels per side.", run: runOrderBook},
+		{name: "whatis", args: "<key hex|base64>", usage: "Name the prefix a raw key belongs to, with its tags, and decode the rest of the key.", run: runWhatis},
+		{name: "dump", usage: "Print the entries of every prefix, or of -prefix or -category only. -limit applies per prefix.", run: runDump},
+		{name: "export", usage: "Write the decoded entries of -prefix, or of each prefix of -category, to one file per prefix. CSV and Parquet only cover the tabular prefixes such as balances, profiles and limit orders.", run: runExport},
+		{name: "sync", usage: "Mirror profiles, balances, posts, follows, likes, NFTs and DAO coin limit orders into SQLite or Postgres tables, resuming from the last checkpoint.", run: runSync},
+		{name: "serve", usage: "Serve prefixes, counts, paginated scans, keys, profiles and balances as JSON over HTTP, and transactions, profiles, balances and posts over GraphQL at /graphql.", run: runServe},
+		{name: "watch", usage: "Poll a prefix and print keys as they appear. Defaults to the mempool prefix.", run: runWatch},
+		{name: "forward", usage: "Watch the mempool and post every new transaction to the trade-bot webhook once.", run: runForward},
+		{name: "validate", usage: "Check DBPrefixes for duplicate or malformed ids, unknown tags and NEXT_TAG drift, and list the unmapped ids. Comments aren't compiled in, so prefixes without one are only reported with -source.", run: runValidate},
+		{name: "replay", args: "[id...]", usage: "Resend the dead-lettered webhook payloads, or only the given ids. Delivered ones are removed.", run: runReplay},
+	}
+}
+
+// runCommand parses the subcommand and its flags and runs it.
+func runCommand(ctx context.Context, args []string) error {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		printUsage(os.Stdout)
+		return nil
+	}
+
+	var cmd *command
+	for _, c := range commands {
+		if c.name == args[0] {
+			cmd = c
+			break
+		}
+	}
+	if cmd == nil {
+		printUsage(os.Stderr)
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+
+	opts := &cliOptions{}
+	fs := flag.NewFlagSet(cmd.name, flag.ExitOnError)
+	fs.StringVar(&opts.dbDir, "db", os.Getenv(envDBDir), "path to the badger directory of the node, defaults to $"+envDBDir)
+	fs.StringVar(&opts.openMode, "open", openModeAuto, "how to open -db: readonly fails while the node is running, snapshot copies the directory and opens the copy, auto opens it read-only unless it is locked and a copy otherwise")
+	fs.StringVar(&opts.network, "network", networkMainnet.Name, "network to print public keys and PKIDs for: mainnet or testnet. Keys of either are accepted as input")
+	fs.StringVar(&opts.snapshotDir, "snapshot-dir", "", "where -open snapshot and auto copy the DB to, defaults to the temp dir")
+	fs.StringVar(&opts.prefix, "prefix", "", "prefix name (e.g. PrefixPKIDToProfileEntry) or id (e.g. 23)")
+	fs.StringVar(&opts.category, "category", "", "use every prefix tagged with a category instead of -prefix: "+strings.Join(prefixCategories, ", "))
+	fs.IntVar(&opts.limit, "limit", 0, "maximum number of entries to print, 0 means no limit")
+	formats := []string{"text", "json"}
+	if cmd.name == "export" {
+		formats = exportFormats
+	}
+	fs.StringVar(&opts.format, "format", formats[0], "output format: "+strings.Join(formats, ", "))
+	fs.StringVar(&opts.start, "start", "", "hex key relative to the prefix to start from (inclusive)")
+	fs.StringVar(&opts.end, "end", "", "hex key relative to the prefix to stop at (exclusive)")
+	fs.BoolVar(&opts.reverse, "reverse", false, "iterate from the last key to the first")
+	if cmd.name == "watch" || cmd.name == "forward" {
+		fs.DurationVar(&opts.interval, "interval", 2*time.Second, "how often to poll the prefix")
+	}
+	if cmd.name == "orderbook" {
+		fs.BoolVar(&opts.showOrders, "orders", false, "also list the open orders of the pair by transactor")
+		fs.StringVar(&opts.transactor, "transactor", "", "list the open orders of this username, public key or PKID only, implies -orders")
+		fs.BoolVar(&opts.watch, "watch", false, "keep polling the book and print it again whenever it changes")
+		fs.DurationVar(&opts.interval, "interval", 2*time.Second, "how often -watch polls the book")
+	}
+	if cmd.name == "key" {
+		fs.BoolVar(&opts.isPKID, "pkid", false, "the argument is a PKID rather than a public key")
+	}
+	if cmd.name == "serve" {
+		fs.StringVar(&opts.addr, "addr", "localhost:8080", "address to listen on")
+	}
+	if cmd.name == "sync" {
+		fs.StringVar(&opts.sqlDSN, "sql", os.Getenv(envSyncSQL), "postgres:// URL or SQLite file to write to, defaults to $"+envSyncSQL)
+		fs.StringVar(&opts.tables, "tables", "", "comma separated tables to sync, defaults to all of them: "+strings.Join(sqlTableNamesList(), ", "))
+		fs.IntVar(&opts.batchSize, "batch", 1000, "rows written per transaction, the checkpoint moves with every batch")
+		fs.DurationVar(&opts.interval, "interval", 0, "sync again after this long, 0 syncs once")
+	}
+	if cmd.name == "forward" {
+		fs.BoolVar(&opts.backfill, "backfill", false, "also post the transactions already in the mempool on the first run. Later runs post whatever arrived while they were down either way")
+		fs.StringVar(&opts.filtersPath, "filters", os.Getenv(envFilters), "YAML or JSON file with the rules deciding which transactions are posted, defaults to $"+envFilters+" or posting all of them")
+	}
+	if cmd.name == "forward" || cmd.name == "replay" {
+		fs.StringVar(&opts.configPath, "config", "", "JSON file with the webhook profiles, defaults to $"+envConfigFile)
+		fs.StringVar(&opts.profile, "profile", "", "webhook profile to use: local, which is built in, or one from -config, defaults to $"+envProfile+" or local")
+	}
+	if cmd.name == "export" {
+		fs.StringVar(&opts.outPath, "out", ".", "directory to write one <prefix name>.<format> file per prefix to, or - for stdout")
+	}
+	if cmd.name == "validate" {
+		fs.StringVar(&opts.sourcePath, "source", "", "this tool's main.go, to check DBPrefixes as written there, including its comments and NEXT_TAG comment")
+		fs.StringVar(&opts.upstreamPath, "upstream", "", "core's lib/db_utils.go, to also list the prefixes that differ from it")
+	}
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s %s [flags] %s\n\n%s\n\n", os.Args[0], cmd.name, cmd.args, cmd.usage)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if !containsString(formats, opts.format) {
+		return fmt.Errorf("unknown format %q, expected %s", opts.format, strings.Join(formats, " or "))
+	}
+	network, err := findNetwork(opts.network)
+	if err != nil {
+		return err
+	}
+	keyNetwork = network
+	switch opts.openMode {
+	case openModeAuto, openModeReadOnly, openModeSnapshot:
+	default:
+		return fmt.Errorf("unknown open mode %q, expected %s, %s or %s", opts.openMode, openModeAuto, openModeReadOnly, openModeSnapshot)
+	}
+
+	return cmd.run(ctx, opts, fs.Args())
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s <command> [flags]\n\nCommands:\n", os.Args[0])
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-10s %s\n", c.name, c.usage)
+	}
+	fmt.Fprintf(w, "\nRun '%s <command> -h' for the flags of a command.\n", os.Args[0])
+}
+
+func bytesToInts(b []byte) []int {
+	ints := make([]int, len(b))
+	for i := range b {
+		ints[i] = int(b[i])
+	}
+	return ints
+}
+
+// openDB opens the badger directory passed with -db the way -open says.
+func openDB(opts *cliOptions) (*nodeDB, error) {
+	if err := opts.checkDBDir(); err != nil {
+		return nil, err
+	}
+	return openNodeDB(opts.dbDir, opts.openMode, opts.snapshotDir)
+}
+
+// pollDB returns a poller for the commands that keep reading the badger
+// directory passed with -db. Once it reads a copy, which -open snapshot always
+// does and auto does while the node is running, it refreshes that single copy
+// before every poll.
+func pollDB(opts *cliOptions) (*dbPoller, error) {
+	if err := opts.checkDBDir(); err != nil {
+		return nil, err
+	}
+	return newDBPoller(opts.dbDir, opts.openMode, opts.snapshotDir), nil
+}
+
+// checkDBDir returns an error if the commands that read the node's DB weren't
+// told where it is.
+func (opts *cliOptions) checkDBDir() error {
+	if opts.dbDir == "" {
+		return fmt.Errorf("no badger directory given, pass -db or set $%s", envDBDir)
+	}
+	return nil
+}
+
+// selectedPrefixes returns the prefixes picked with -prefix or -category.
+// Without either it returns every prefix if all is set, and fails otherwise.
+func (opts *cliOptions) selectedPrefixes(all bool) ([]*namedPrefix, error) {
+	switch {
+	case opts.prefix != "" && opts.category != "":
+		return nil, fmt.Errorf("-prefix and -category can't be used together")
+	case opts.category != "":
+		return prefixesInCategory(opts.category)
+	case opts.prefix != "" || !all:
+		prefix, err := findPrefix(opts.prefix)
+		if err != nil {
+			return nil, err
+		}
+		return []*namedPrefix{prefix}, nil
+	}
+	return listPrefixes(), nil
+}
+
+// iterateOptions builds the bounds of an iteration over prefix from -start,
+// -end, -reverse and -limit.
+func (opts *cliOptions) iterateOptions(prefix *namedPrefix) (*iterateOptions, error) {
+	iterOpts := &iterateOptions{Reverse: opts.reverse, Limit: opts.limit}
+	for _, bound := range []struct {
+		flag  string
+		value string
+		key   *[]byte
+	}{{"start", opts.start, &iterOpts.Start}, {"end", opts.end, &iterOpts.End}} {
+		if bound.value == "" {
+			continue
+		}
+		key, err := hex.DecodeString(bound.value)
+		if err != nil {
+			return nil, fmt.Errorf("-%s must be hex encoded: %v", bound.flag, err)
+		}
+		*bound.key = append(append([]byte{}, prefix.Prefix...), key...)
+	}
+	return iterOpts, nil
+}
+
+// entry is a single key/value pair as printed by scan, get, dump and watch.
+type entry struct {
+	Prefix    string      `json:"prefix"`
+	Key       string      `json:"key"`
+	KeyFields []*keyField `json:"keyFields,omitempty"`
+	KeyError  string      `json:"keyError,omitempty"`
+	Value     string      `json:"value,omitempty"`
+	// The decoded value, if there is a decoder for the prefix.
+	DecodedValue interface{} `json:"decodedValue,omitempty"`
+	ValueError   string      `json:"valueError,omitempty"`
+}
+
+func newEntry(prefix *namedPrefix, key []byte, value []byte) *entry {
+	e := &entry{Key: hex.EncodeToString(key), Value: hex.EncodeToString(value)}
+	if prefix != nil {
+		e.Prefix = prefix.Name
+	}
+	fields, err := decodeKey(prefix, key)
+	e.KeyFields = fields
+	if err != nil {
+		e.KeyError = err.Error()
+	}
+	e.DecodedValue, err = decodeValue(prefix, value)
+	if err != nil {
+		e.ValueError = err.Error()
+	}
+	return e
+}
+
+// printEntry writes one entry to stdout in the requested format. JSON output
+// is newline-delimited so that it can be piped into jq. Text output prints the
+// decoded key fields and value, and falls back to hex for whatever could not be
+// decoded.
+func printEntry(opts *cliOptions, e *entry) error {
+	if opts.format == "json" {
+		return json.NewEncoder(os.Stdout).Encode(e)
+	}
+	line := []string{e.Prefix}
+	for _, field := range e.KeyFields {
+		line = append(line, field.String())
+	}
+	if e.KeyError != "" {
+		line = append(line, "key="+e.Key)
+	}
+	if e.DecodedValue != nil {
+		decoded, err := json.Marshal(e.DecodedValue)
+		if err != nil {
+			return err
+		}
+		line = append(line, "value="+string(decoded))
+	} else {
+		if e.ValueError != "" {
+			line = append(line, "valueError="+strconv.Quote(e.ValueError))
+		}
+		line = append(line, "value="+e.Value)
+	}
+	_, err := fmt.Println(strings.Join(line, " "))
+	return err
+}
+
+func runPrefixes(ctx context.Context, opts *cliOptions, args []string) error {
+	prefixes, err := opts.selectedPrefixes(true)
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(prefixes, func(i, j int) bool {
+		return bytes.Compare(prefixes[i].Prefix, prefixes[j].Prefix) < 0
+	})
+	if opts.format == "json" {
+		return json.NewEncoder(os.Stdout).Encode(prefixes)
+	}
+	for _, p := range prefixes {
+		fmt.Printf("%v\t%s\t%s\n", bytesToInts(p.Prefix), p.Name, strings.Join(p.Categories(), ","))
+	}
+	return nil
+}
+
+func runCount(ctx context.Context, opts *cliOptions, args []string) error {
+	prefixes, err := opts.selectedPrefixes(false)
+	if err != nil {
+		return err
+	}
+	db, err := openDB(opts)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.View(func(txn kvTxn) error {
+		for _, prefix := range prefixes {
+			iterOpts, err := opts.iterateOptions(prefix)
+			if err != nil {
+				return err
+			}
+			iterOpts.KeysOnly = true
+
+			count := 0
+			err = _iterateKeysForPrefixWithTxn(ctx, txn, prefix.Prefix, iterOpts, func(key []byte, val []byte) error {
+				count++
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			if opts.format == "json" {
+				if err := json.NewEncoder(os.Stdout).Encode(map[string]interface{}{"prefix": prefix.Name, "count": count}); err != nil {
+					return err
+				}
+				continue
+			}
+			fmt.Printf("%s\t%d\n", prefix.Name, count)
+		}
+		return nil
+	})
+}
+
+func runStats(ctx context.Context, opts *cliOptions, args []string) error {
+	db, err := openDB(opts)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	report, err := collectDBStats(ctx, db, opts.dbDir)
+	if err != nil {
+		return err
+	}
+	if opts.format == "json" {
+		return json.NewEncoder(os.Stdout).Encode(report)
+	}
+	return printDBStats(os.Stdout, report)
+}
+
+func runScan(ctx context.Context, opts *cliOptions, args []string) error {
+	return printPrefixes(ctx, opts, false)
+}
+
+func runDump(ctx context.Context, opts *cliOptions, args []string) error {
+	return printPrefixes(ctx, opts, true)
+}
+
+// printPrefixes prints the entries of the prefixes selected on the command
+// line, or of every prefix if all is set and none are.
+func printPrefixes(ctx context.Context, opts *cliOptions, all bool) error {
+	prefixes, err := opts.selectedPrefixes(all)
+	if err != nil {
+		return err
+	}
+	db, err := openDB(opts)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.View(func(txn kvTxn) error {
+		for _, prefix := range prefixes {
+			if err := printPrefix(ctx, opts, txn, prefix); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// printPrefix prints the entries stored under prefix within the bounds and
+// limit set on the command line.
+func printPrefix(ctx context.Context, opts *cliOptions, txn kvTxn, prefix *namedPrefix) error {
+	iterOpts, err := opts.iterateOptions(prefix)
+	if err != nil {
+		return err
+	}
+	return _iterateKeysForPrefixWithTxn(ctx, txn, prefix.Prefix, iterOpts, func(key []byte, val []byte) error {
+		return printEntry(opts, newEntry(prefix, key, val))
+	})
+}
+
+func runGet(ctx context.Context, opts *cliOptions, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("get expects exactly one key argument")
+	}
+	key, err := hex.DecodeString(args[0])
+	if err != nil {
+		return fmt.Errorf("key must be hex encoded: %v", err)
+	}
+	var prefix *namedPrefix
+	if opts.prefix != "" {
+		if prefix, err = findPrefix(opts.prefix); err != nil {
+			return err
+		}
+		key = append(append([]byte{}, prefix.Prefix...), key...)
+	} else {
+		prefix = prefixForKey(key)
+	}
+
+	db, err := openDB(opts)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.View(func(txn kvTxn) error {
+		val, err := txn.Get(key)
+		if err != nil {
+			return fmt.Errorf("error getting key %x: %v", key, err)
+		}
+		return printEntry(opts, newEntry(prefix, key, val))
+	})
+}
+
+func runKey(ctx context.Context, opts *cliOptions, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("key expects exactly one public key or PKID argument")
+	}
+	db, err := openDB(opts)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var conversion *keyConversion
+	err = db.View(func(txn kvTxn) error {
+		conversion, err = resolveKeyWithTxn(txn, args[0], opts.isPKID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if opts.format == "json" {
+		return json.NewEncoder(os.Stdout).Encode(conversion)
+	}
+	fmt.Printf("public key (mainnet)\t%s\n", conversion.PublicKeyMainnet)
+	fmt.Printf("public key (testnet)\t%s\n", conversion.PublicKeyTestnet)
+	fmt.Printf("public key (hex)\t%s\n", conversion.PublicKeyHex)
+	fmt.Printf("PKID\t%s\n", conversion.PKID)
+	fmt.Printf("PKID (hex)\t%s\n", conversion.PKIDHex)
+	return nil
+}
+
+func runProfile(ctx context.Context, opts *cliOptions, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("profile expects exactly one username, public key or PKID argument")
+	}
+	db, err := openDB(opts)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var profile *profileInfo
+	err = db.View(func(txn kvTxn) error {
+		profile, err = resolveProfileWithTxn(txn, args[0])
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if profile == nil {
+		return fmt.Errorf("no profile for %q", args[0])
+	}
+	if opts.format == "json" {
+		return json.NewEncoder(os.Stdout).Encode(profile)
+	}
+	coin := profile.CreatorCoin
+	fmt.Printf("username\t%s\n", profile.Username)
+	fmt.Printf("public key\t%v\n", profile.PublicKey)
+	fmt.Printf("PKID\t%v\n", profile.PKID)
+	fmt.Printf("description\t%s\n", profile.Description)
+	fmt.Printf("hidden\t%t\n", profile.IsHidden)
+	fmt.Printf("DeSo locked\t%s DESO\n", formatNanos(coin.DeSoLockedNanos))
+	fmt.Printf("coins in circulation\t%s nanos\n", coin.CoinsInCirculationNanos)
+	fmt.Printf("holders\t%d\n", coin.NumberOfHolders)
+	fmt.Printf("founder reward\t%.2f%%\n", float64(coin.FounderRewardBasisPoints)/100)
+	fmt.Printf("price\t%s DESO per coin\n", formatNanos(*coin.PriceNanos))
+	return nil
+}
+
+func runHolders(ctx context.Context, opts *cliOptions, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("holders expects exactly one username, public key or PKID argument")
+	}
+	return printCoinHoldings(ctx, opts, args[0], creatorCoinHoldersWithTxn)
+}
+
+func runHoldings(ctx context.Context, opts *cliOptions, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("holdings expects exactly one username, public key or PKID argument")
+	}
+	return printCoinHoldings(ctx, opts, args[0], creatorCoinHoldingsWithTxn)
+}
+
+// printCoinHoldings prints the holdings read resolves query to. Holders are
+// printed with the holder and holdings with the creator, the other side being
+// query itself.
+func printCoinHoldings(ctx context.Context, opts *cliOptions, query string, read func(context.Context, kvTxn, *PKID) (*coinHoldings, error)) error {
+	db, err := openDB(opts)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var holdings *coinHoldings
+	err = db.View(func(txn kvTxn) error {
+		pkid, err := resolvePKIDWithTxn(txn, query)
+		if err != nil {
+			return err
+		}
+		if pkid == nil {
+			return fmt.Errorf("no profile for %q", query)
+		}
+		holdings, err = read(ctx, txn, pkid)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	holdings.truncate(opts.limit)
+	if opts.format == "json" {
+		return json.NewEncoder(os.Stdout).Encode(holdings)
+	}
+	for _, holding := range holdings.Holdings {
+		other, name := holding.HODLerPKID, holding.HODLerUsername
+		if *other == *holdings.PKID {
+			other, name = holding.CreatorPKID, holding.CreatorUsername
+		}
+		fmt.Printf("%v\t%s\t%s nanos\t%s DESO\n", other, name, holding.BalanceNanos, formatNanos(holding.ValueNanos))
+	}
+	fmt.Printf("total\t%s DESO\n", formatNanos(holdings.TotalValueNanos))
+	return nil
+}
+
+func runOrderBook(ctx context.Context, opts *cliOptions, args []string) error {
+	if len(args) != 1 && len(args) != 2 {
+		return fmt.Errorf("orderbook expects a base coin and optionally a quote coin")
+	}
+	quote := orderBookDeSo
+	if len(args) == 2 {
+		quote = args[1]
+	}
+
+	// The DB is opened again for every poll. When a copy is read the copy is
+	// refreshed first, which only copies the files that changed since.
+	poller, err := pollDB(opts)
+	if err != nil {
+		return err
+	}
+	defer poller.Close()
+
+	var last []byte
+	for {
+		db, err := poller.Open()
+		if err != nil {
+			return err
+		}
+		var book *orderBook
+		err = db.View(func(txn kvTxn) error {
+			query := &orderBookQuery{Depth: opts.limit, Orders: opts.showOrders}
+			if query.Base, err = resolveCoinWithTxn(txn, args[0]); err != nil {
+				return err
+			}
+			if query.Quote, err = resolveCoinWithTxn(txn, quote); err != nil {
+				return err
+			}
+			if opts.transactor != "" {
+				if query.Transactor, err = resolvePKIDWithTxn(txn, opts.transactor); err != nil {
+					return err
+				}
+				if query.Transactor == nil {
+					return fmt.Errorf("no profile for %q", opts.transactor)
+				}
+			}
+			book, err = readOrderBookWithTxn(ctx, txn, query)
+			return err
+		})
+		db.Close()
+		if errors.Is(err, context.Canceled) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		current, err := json.Marshal(book)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(current, last) {
+			if err := printOrderBook(opts, book, last != nil); err != nil {
+				return err
+			}
+			last = current
+		}
+		if !opts.watch {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(opts.interval):
+		}
+	}
+}
+
+// printOrderBook prints book as a JSON line or as text. Books printed again
+// by -watch are separated by an empty line in text.
+func printOrderBook(opts *cliOptions, book *orderBook, again bool) error {
+	if opts.format == "json" {
+		return json.NewEncoder(os.Stdout).Encode(book)
+	}
+	if again {
+		fmt.Println()
+	}
+	formatPrice := func(price *float64) string {
+		if price == nil {
+			return "-"
+		}
+		return strconv.FormatFloat(*price, 'g', -1, 64)
+	}
+	fmt.Printf("pair\t%s/%s\n", coinName(book.BasePKID), coinName(book.QuotePKID))
+	fmt.Printf("best bid\t%s\n", formatPrice(book.BestBid))
+	fmt.Printf("best ask\t%s\n", formatPrice(book.BestAsk))
+	fmt.Printf("spread\t%s\n", formatPrice(book.Spread))
+	for _, side := range []struct {
+		name   string
+		levels []*orderBookLevel
+	}{{"bids", book.Bids}, {"asks", book.Asks}} {
+		fmt.Printf("%s\n", side.name)
+		for _, level := range side.levels {
+			fmt.Printf("\t%s\t%s\t%d orders\n", formatPrice(&level.Price), level.Quantity, level.NumberOfOrders)
+		}
+	}
+	for _, transactor := range book.Transactors {
+		fmt.Printf("orders of %v\n", transactor.TransactorPKID)
+		for _, order := range transactor.Orders {
+			fmt.Printf("\t%s\t%s\t%s\t%v\t%d\n", order.Side, formatPrice(&order.Price), order.Quantity, order.OrderID, order.BlockHeight)
+		}
+	}
+	return nil
+}
+
+func runWhatis(ctx context.Context, opts *cliOptions, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("whatis expects exactly one key argument")
+	}
+	key, err := parseRawKey(args[0])
+	if err != nil {
+		return err
+	}
+	identity, err := identifyKey(key)
+	if err != nil {
+		return err
+	}
+	if opts.format == "json" {
+		return json.NewEncoder(os.Stdout).Encode(identity)
+	}
+
+	categories := ""
+	if len(identity.Prefix.Categories()) > 0 {
+		categories = " (" + strings.Join(identity.Prefix.Categories(), ", ") + ")"
+	}
+	fmt.Printf("prefix\t%v %s%s\n", bytesToInts(identity.Prefix.Prefix), identity.Prefix.Name, categories)
+	fmt.Printf("layout\t<%s>\n", strings.Join(append([]string{"prefix_id"}, identity.Layout...), ", "))
+	for _, field := range identity.Fields {
+		fmt.Printf("%s\t%v\n", field.Name, field.Value)
+	}
+	if identity.KeyError != "" {
+		fmt.Printf("error\t%s\n", identity.KeyError)
+	}
+	return nil
+}
+
+func runExport(ctx context.Context, opts *cliOptions, args []string) error {
+	prefixes, err := opts.selectedPrefixes(false)
+	if err != nil {
+		return err
+	}
+	if opts.format != exportFormatNDJSON {
+		for _, prefix := range prefixes {
+			if tableSchemas[prefix.Name] == nil {
+				return fmt.Errorf("%s can't be exported as %s, only %s can", prefix.Name, opts.format, tabularPrefixNames())
+			}
+		}
+	}
+	db, err := openDB(opts)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.View(func(txn kvTxn) error {
+		for _, prefix := range prefixes {
+			iterOpts, err := opts.iterateOptions(prefix)
+			if err != nil {
+				return err
+			}
+			path := opts.outPath
+			if path != "-" {
+				path = filepath.Join(opts.outPath, prefix.Name+"."+opts.format)
+			}
+			exported := 0
+			err = exportFile(path, func(w io.Writer) error {
+				exported, err = exportPrefix(ctx, txn, prefix, iterOpts, opts.format, w)
+				return err
+			})
+			if err != nil {
+				return err
+			}
+			log.Printf("Exported %d entries of %s to %s\n", exported, prefix.Name, path)
+		}
+		return nil
+	})
+}
+
+func runSync(ctx context.Context, opts *cliOptions, args []string) error {
+	var names []string
+	if opts.tables != "" {
+		names = strings.Split(opts.tables, ",")
+	}
+	tables, err := sqlTables(names)
+	if err != nil {
+		return err
+	}
+	conn, err := openSQLConn(opts.sqlDSN)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	syncer := newSQLSyncer(conn, opts.batchSize)
+	if err := syncer.createTables(tables); err != nil {
+		return err
+	}
+
+	// The DB is opened again for every pass. When a copy is read the copy is
+	// refreshed first, which only copies the files that changed since.
+	poller, err := pollDB(opts)
+	if err != nil {
+		return err
+	}
+	defer poller.Close()
+
+	for {
+		db, err := poller.Open()
+		if err != nil {
+			return err
+		}
+		results, err := syncer.sync(ctx, db, tables)
+		db.Close()
+		for _, result := range results {
+			resumed := ""
+			if result.Resumed {
+				resumed = ", resumed"
+			}
+			log.Printf("Synced %s: pass %d%s, %d rows written, %d deleted\n",
+				result.Table, result.Pass, resumed, result.Rows, result.Deleted)
+		}
+		if errors.Is(err, context.Canceled) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if opts.interval <= 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(opts.interval):
+		}
+	}
+}
+
+func runServe(ctx context.Context, opts *cliOptions, args []string) error {
+	db, err := openDB(opts)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	log.Printf("Serving %s on http://%s\n", opts.dbDir, opts.addr)
+	return serveAPI(ctx, db, opts.addr)
+}
+
+func runWatch(ctx context.Context, opts *cliOptions, args []string) error {
+	if opts.prefix == "" {
+		opts.prefix = "PrefixMempoolTxnHashToMsgDeSoTxn"
+	}
+	prefix, err := findPrefix(opts.prefix)
+	if err != nil {
+		return err
+	}
+	poller, err := pollDB(opts)
+	if err != nil {
+		return err
+	}
+	defer poller.Close()
+
+	seen := make(map[string]bool)
+	printed := 0
+	for {
+		db, err := poller.Open()
+		if err != nil {
+			return err
+		}
+		err = db.View(func(txn kvTxn) error {
+			// Only the keys are read on every poll, values are fetched for
+			// the keys we have not printed yet.
+			iterOpts := &iterateOptions{KeysOnly: true}
+			return _iterateKeysForPrefixWithTxn(ctx, txn, prefix.Prefix, iterOpts, func(key []byte, _ []byte) error {
+				if seen[string(key)] {
+					return nil
+				}
+				if opts.limit > 0 && printed >= opts.limit {
+					return errStopIteration
+				}
+				seen[string(key)] = true
+				val, err := txn.Get(key)
+				if err != nil {
+					return fmt.Errorf("error getting key %x: %v", key, err)
+				}
+				printed++
+				return printEntry(opts, newEntry(prefix, key, val))
+			})
+		})
+		db.Close()
+		if errors.Is(err, context.Canceled) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if opts.limit > 0 && printed >= opts.limit {
+			return nil
+		}
+		log.Printf("Watching %s: %d keys seen\n", prefix.Name, len(seen))
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(opts.interval):
+		}
+	}
+}
+
+func runForward(ctx context.Context, opts *cliOptions, args []string) error {
+	cfg, err := loadWebhookConfig(opts.configPath, opts.profile)
+	if err != nil {
+		return err
+	}
+	filter, err := loadTxnFilter(opts.filtersPath)
+	if err != nil {
+		return err
+	}
+	webhook := newWebhookClient(cfg)
+	if webhook.deadLetters, err = openDeadLetterQueue(cfg.DeadLetterDir); err != nil {
+		return err
+	}
+	defer webhook.deadLetters.Close()
+	seen, err := openSeenStore(cfg.SeenDir)
+	if err != nil {
+		return err
+	}
+	defer seen.Close()
+
+	poller, err := pollDB(opts)
+	if err != nil {
+		return err
+	}
+	defer poller.Close()
+	open := func() (kvDB, error) {
+		db, err := poller.Open()
+		if err != nil {
+			return nil, err
+		}
+		return db, nil
+	}
+
+	watcher := newMempoolWatcher(open, opts.interval, func(db kvDB, txnHash BlockHash, txn *MsgDeSoTxn) error {
+		var txnData *TransactionData
+		err := db.View(func(badgerTxn kvTxn) error {
+			var err error
+			txnData, err = newTransactionData(badgerTxn, txnHash, txn)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		if !filter.Allow(txn, txnData) {
+			return nil
+		}
+		data, err := json.Marshal(txnData)
+		if err != nil {
+			return err
+		}
+		log.Printf("Forwarding %s txn %v\n", txn.TxnType, txnHash)
+		webhook.Enqueue(txnHash, data)
+		return errTxnPending
+	})
+	watcher.backfill = opts.backfill
+	watcher.store = seen
+	// A txn is only saved as seen once the webhook delivered or
+	// dead-lettered it, so one still queued when the process died is
+	// forwarded again.
+	webhook.onDone = watcher.txnDone
+
+	// Payloads are posted by the webhook's workers, so a slow or failing
+	// endpoint doesn't hold up the polls.
+	webhook.Start(ctx)
+	defer func() {
+		if err := webhook.Stop(); err != nil {
+			log.Printf("Problem dead-lettering the undelivered payloads: %v\n", err)
+		}
+	}()
+	log.Printf("Forwarding new mempool transactions to %s every %v\n", cfg.URL, opts.interval)
+	return watcher.Run(ctx)
+}
+
+func runReplay(ctx context.Context, opts *cliOptions, args []string) error {
+	cfg, err := loadWebhookConfig(opts.configPath, opts.profile)
+	if err != nil {
+		return err
+	}
+	// Replayed payloads stay in the queue when they fail again, so the
+	// webhook client doesn't get a queue to add them to.
+	webhook := newWebhookClient(cfg)
+	deadLetters, err := openDeadLetterQueue(cfg.DeadLetterDir)
+	if err != nil {
+		return err
+	}
+	defer deadLetters.Close()
+
+	items, err := deadLetters.List()
+	if err != nil {
+		return err
+	}
+	ids := make(map[string]bool)
+	for _, id := range args {
+		ids[id] = true
+	}
+
+	delivered, failed := 0, 0
+	for _, item := range items {
+		if len(ids) > 0 && !ids[item.ID] {
+			continue
+		}
+		if opts.limit > 0 && delivered+failed >= opts.limit {
+			break
+		}
+		attempts, err := webhook.postWithRetries(ctx, item.Payload)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			failed++
+			item.Attempts += attempts
+			item.LastError = err.Error()
+			item.FailedAt = time.Now().UTC()
+			log.Printf("Replaying %s failed, keeping it: %v\n", item.ID, err)
+			if err := deadLetters.Put(item); err != nil {
+				return err
+			}
+			continue
+		}
+		delivered++
+		if err := deadLetters.Delete(item.ID); err != nil {
+			return err
+		}
+	}
+	log.Printf("Replayed %d dead-lettered payloads from %s: %d delivered, %d failed\n",
+		delivered+failed, cfg.DeadLetterDir, delivered, failed)
+	return nil
+}
+
+func runValidate(ctx context.Context, opts *cliOptions, args []string) error {
+	registry, err := loadPrefixRegistryFile(opts.sourcePath)
+	if err != nil {
+		return err
+	}
+	if registry == nil {
+		registry = reflectPrefixRegistry(reflect.TypeOf(DBPrefixes{}), dbPrefixesNextTag)
+	}
+	upstream, err := loadPrefixRegistryFile(opts.upstreamPath)
+	if err != nil {
+		return err
+	}
+	report := validatePrefixRegistry(registry, upstream)
+	if registry.FromSource && registry.NextTag != dbPrefixesNextTag {
+		report.errorf("%s: the NEXT_TAG comment is %d but dbPrefixesNextTag is %d", opts.sourcePath, registry.NextTag, dbPrefixesNextTag)
+	}
+
+	if opts.format == "json" {
+		if err := json.NewEncoder(os.Stdout).Encode(report); err != nil {
+			return err
+		}
+	} else {
+		fmt.Printf("%d prefixes, NEXT_TAG %d\n", report.Prefixes, report.NextTag)
+		for _, message := range report.Errors {
+			fmt.Printf("error: %s\n", message)
+		}
+		for _, message := range report.Warnings {
+			fmt.Printf("warning: %s\n", message)
+		}
+		fmt.Printf("unmapped ids: %v\n", report.Unmapped)
+		for _, message := range report.Upstream {
+			fmt.Printf("upstream: %s\n", message)
+		}
+	}
+	if len(report.Errors) > 0 {
+		return fmt.Errorf("DBPrefixes has %d errors", len(report.Errors))
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+)
+
+// The creator coin parameters of core's DeSoParams. They are the same on
+// mainnet and testnet.
+const (
+	NanosPerUnit                      = 1e9
+	CreatorCoinTradeFeeBasisPoints    = 1
+	CreatorCoinSlope                  = 0.003
+	CreatorCoinReserveRatio           = 0.3333333
+	CreatorCoinAutoSellThresholdNanos = 10
+)
+
+// The functions below follow core's bonding curve functions in
+// block_view_creator_coin.go. Core computes them with big.Float, we use
+// float64, which is close enough to estimate a trade but can be off from the
+// node's result by a few nanos.
+
+// calculateCreatorCoinToMint returns how many creator coin nanos a buy of
+// desoToSellNanos, after fees, would mint.
+func calculateCreatorCoinToMint(desoToSellNanos uint64, coinsInCirculationNanos uint64, desoLockedNanos uint64) uint64 {
+	deltaDeSo := float64(desoToSellNanos) / NanosPerUnit
+	supply := float64(coinsInCirculationNanos) / NanosPerUnit
+	if desoLockedNanos == 0 {
+		// There is no DeSo locked in the profile yet, so the polynomial curve
+		// is used to initialize the coin:
+		// (((dB + m*RR*s^(1/RR)) / (m*RR)))^RR - s
+		mintedCoins := math.Pow((deltaDeSo+CreatorCoinSlope*CreatorCoinReserveRatio*
+			math.Pow(supply, 1/CreatorCoinReserveRatio))/(CreatorCoinSlope*CreatorCoinReserveRatio),
+			CreatorCoinReserveRatio) - supply
+		return nanosFromUnits(mintedCoins)
+	}
+	// Bancor: S0 * ((1 + dB / B0) ^ (RR) - 1)
+	desoLocked := float64(desoLockedNanos) / NanosPerUnit
+	mintedCoins := supply * (math.Pow(1+deltaDeSo/desoLocked, CreatorCoinReserveRatio) - 1)
+	return nanosFromUnits(mintedCoins)
+}
+
+// calculateDeSoToReturn returns how many DeSo nanos, before fees, selling
+// deltaCreatorCoinNanos would take out of the profile.
+func calculateDeSoToReturn(deltaCreatorCoinNanos uint64, coinsInCirculationNanos uint64, desoLockedNanos uint64) uint64 {
+	if coinsInCirculationNanos == 0 {
+		return 0
+	}
+	if deltaCreatorCoinNanos >= coinsInCirculationNanos {
+		return desoLockedNanos
+	}
+	// Bancor: B0 * (1 - (1 - dS / S0)^(1/RR))
+	deltaCoins := float64(deltaCreatorCoinNanos) / NanosPerUnit
+	supply := float64(coinsInCirculationNanos) / NanosPerUnit
+	desoLocked := float64(desoLockedNanos) / NanosPerUnit
+	desoReturned := desoLocked * (1 - math.Pow(1-deltaCoins/supply, 1/CreatorCoinReserveRatio))
+	return nanosFromUnits(desoReturned)
+}
+
+// creatorCoinPriceNanos returns the DeSo nanos one whole coin costs at the
+// current point of the curve, B / (RR * S), the price frontends show. A coin
+// with nothing in circulation has no price yet.
+func creatorCoinPriceNanos(coinsInCirculationNanos uint64, desoLockedNanos uint64) uint64 {
+	if coinsInCirculationNanos == 0 {
+		return 0
+	}
+	desoLocked := float64(desoLockedNanos) / NanosPerUnit
+	supply := float64(coinsInCirculationNanos) / NanosPerUnit
+	return nanosFromUnits(desoLocked / (CreatorCoinReserveRatio * supply))
+}
+
+func nanosFromUnits(units float64) uint64 {
+	if units <= 0 || math.IsNaN(units) {
+		return 0
+	}
+	nanos := units * NanosPerUnit
+	if nanos >= math.MaxUint64 {
+		return math.MaxUint64
+	}
+	return uint64(nanos)
+}
+
+// uint64OrMax returns value as a uint64, capped at math.MaxUint64 since
+// uint256 amounts can be larger.
+func uint64OrMax(value *big.Int) uint64 {
+	if value == nil {
+		return 0
+	}
+	if !value.IsUint64() {
+		return math.MaxUint64
+	}
+	return value.Uint64()
+}
+
+// formatNanos formats an amount of nanos in whole units, e.g. 1.500000000.
+func formatNanos(nanos uint64) string {
+	return fmt.Sprintf("%d.%09d", nanos/NanosPerUnit, nanos%NanosPerUnit)
+}
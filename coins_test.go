@@ -0,0 +1,109 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/deso-protocol/core/lib"
+)
+
+// coinMathToleranceNanos is how far the float64 curve functions may be from
+// core's big.Float ones. float64 keeps about 16 significant digits, so the
+// error grows with the amounts. The cases below currently match core
+// exactly.
+const coinMathToleranceNanos = 10
+
+func withinNanos(got uint64, want uint64, tolerance uint64) bool {
+	if got > want {
+		return got-want <= tolerance
+	}
+	return want-got <= tolerance
+}
+
+// TestCreatorCoinCurve checks the curve functions against core's, and
+// against the supply and DeSo locked core's TestCreatorCoinBuySellSimple
+// tests get after their first buys.
+func TestCreatorCoinCurve(t *testing.T) {
+	tests := []struct {
+		name               string
+		deltaNanos         uint64
+		coinsInCirculation uint64
+		desoLocked         uint64
+		// wantNanos is core's result for the case, when its tests have one.
+		wantNanos uint64
+	}{
+		// 1271123456 nanos minus the 1 basis point fee.
+		{"first buy", 1270996343, 0, 0, 10832150315},
+		{"second buy", 1172255945, 10832150315, 1270996343, 13468606753 - 10832150315},
+		{"polynomial buy with supply", 1e9, 5e9, 0, 0},
+		{"small bancor buy", 1, 10832150315, 1270996343, 0},
+		{"large bancor buy", 30e15, 10000004, 1, 0},
+		{"bancor buy on a large coin", 5e12, 2e15, 8e14, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			want := lib.CalculateCreatorCoinToMint(test.deltaNanos, test.coinsInCirculation, test.desoLocked, &lib.DeSoMainnetParams)
+			if test.wantNanos != 0 && want != test.wantNanos {
+				t.Fatalf("core minted %d nanos, its tests say %d", want, test.wantNanos)
+			}
+			got := calculateCreatorCoinToMint(test.deltaNanos, test.coinsInCirculation, test.desoLocked)
+			if !withinNanos(got, want, coinMathToleranceNanos) {
+				t.Errorf("minted %d nanos, core mints %d", got, want)
+			}
+		})
+	}
+}
+
+func TestCalculateDeSoToReturn(t *testing.T) {
+	tests := []struct {
+		name               string
+		deltaNanos         uint64
+		coinsInCirculation uint64
+		desoLocked         uint64
+	}{
+		{"sell one nano", 1, 10832150315, 1270996343},
+		{"sell half", 10832150315 / 2, 10832150315, 1270996343},
+		{"sell all but one nano", 13468606753 - 1, 13468606753, 2443252288},
+		{"sell part of a large coin", 1e14, 2e15, 8e14},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			want := lib.CalculateDeSoToReturn(test.deltaNanos, test.coinsInCirculation, test.desoLocked, &lib.DeSoMainnetParams)
+			got := calculateDeSoToReturn(test.deltaNanos, test.coinsInCirculation, test.desoLocked)
+			if !withinNanos(got, want, coinMathToleranceNanos) {
+				t.Errorf("returned %d nanos, core returns %d", got, want)
+			}
+		})
+	}
+
+	// Selling the whole supply returns everything locked, and nothing is
+	// returned for a coin with no supply.
+	if got := calculateDeSoToReturn(10832150315, 10832150315, 1270996343); got != 1270996343 {
+		t.Errorf("selling the whole supply returned %d nanos, want 1270996343", got)
+	}
+	if got := calculateDeSoToReturn(5, 0, 0); got != 0 {
+		t.Errorf("selling a coin with no supply returned %d nanos, want 0", got)
+	}
+}
+
+// TestCreatorCoinRoundTrip buys into a new coin and sells it all back in two
+// halves, which gets back what was put in, as in core's
+// TestCreatorCoinBigBigBuyBigSell.
+func TestCreatorCoinRoundTrip(t *testing.T) {
+	desoNanos := uint64(1e12)
+	minted := calculateCreatorCoinToMint(desoNanos, 0, 0)
+	firstHalf := calculateDeSoToReturn(minted/2, minted, desoNanos)
+	secondHalf := calculateDeSoToReturn(minted-minted/2, minted-minted/2, desoNanos-firstHalf)
+	if !withinNanos(firstHalf+secondHalf, desoNanos, coinMathToleranceNanos) {
+		t.Errorf("got back %d nanos for %d", firstHalf+secondHalf, desoNanos)
+	}
+}
+
+func TestCreatorCoinPriceNanos(t *testing.T) {
+	if got := creatorCoinPriceNanos(0, 0); got != 0 {
+		t.Errorf("a coin with no supply costs %d nanos, want 0", got)
+	}
+	// B / (RR * S): 1 DeSo locked for 3 coins costs about 1 DeSo a coin.
+	if got := creatorCoinPriceNanos(3e9, 1e9); !withinNanos(got, 1000000100, coinMathToleranceNanos) {
+		t.Errorf("got a price of %d nanos, want 1000000100", got)
+	}
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The environment variables read by loadWebhookConfig. They override whatever
+// the config file sets for the selected profile.
+const (
+	envConfigFile     = "WEBHOOK_CONFIG"
+	envProfile        = "WEBHOOK_PROFILE"
+	envURL            = "WEBHOOK_URL"
+	envToken          = "WEBHOOK_TOKEN"
+	envHeaders        = "WEBHOOK_HEADERS"
+	envTimeout        = "WEBHOOK_TIMEOUT"
+	envConnectTimeout = "WEBHOOK_CONNECT_TIMEOUT"
+	envMaxAttempts    = "WEBHOOK_MAX_ATTEMPTS"
+	envDeadLetterDir  = "WEBHOOK_DEAD_LETTER_DIR"
+	envSeenDir        = "WEBHOOK_SEEN_DIR"
+)
+
+const defaultProfile = "local"
+
+// webhookConfig is where and how transactions are posted.
+type webhookConfig struct {
+	URL string `json:"url"`
+	// Token is sent as a bearer token in the Authorization header.
+	Token string `json:"token,omitempty"`
+	// Headers are added to every request, after Authorization and
+	// Content-Type so they can override both.
+	Headers map[string]string `json:"headers,omitempty"`
+	// Timeout bounds a whole request, ConnectTimeout only the dial.
+	Timeout        configDuration `json:"timeout,omitempty"`
+	ConnectTimeout configDuration `json:"connectTimeout,omitempty"`
+
+	// MaxAttempts is how many times a payload is posted before it is
+	// dead-lettered. The delay between attempts starts at InitialBackoff and
+	// doubles up to MaxBackoff.
+	MaxAttempts    int            `json:"maxAttempts,omitempty"`
+	InitialBackoff configDuration `json:"initialBackoff,omitempty"`
+	MaxBackoff     configDuration `json:"maxBackoff,omitempty"`
+	// Workers is how many payloads are posted at once. Payloads wait for a
+	// worker in a queue of QueueSize, and are dead-lettered when it is full.
+	Workers   int `json:"workers,omitempty"`
+	QueueSize int `json:"queueSize,omitempty"`
+	// DeadLetterDir is the badger directory undelivered payloads are kept in
+	// until they are replayed.
+	DeadLetterDir string `json:"deadLetterDir,omitempty"`
+	// SeenDir is the badger directory the hashes of the transactions already
+	// posted are kept in, so that forward doesn't post them again after a
+	// restart.
+	SeenDir string `json:"seenDir,omitempty"`
+}
+
+// configFile is the layout of the JSON file passed with -config:
+//
+//	{
+//	  "profile": "prod",
+//	  "profiles": {
+//	    "prod": {"url": "https://...", "token": "...", "timeout": "10s"}
+//	  }
+//	}
+//
+// Profiles in the file are merged over the built-in ones, so a profile only
+// needs to set the fields it changes.
+type configFile struct {
+	Profile  string                    `json:"profile,omitempty"`
+	Profiles map[string]*webhookConfig `json:"profiles"`
+}
+
+// builtinProfiles only holds the local trade-bot function of the Supabase CLI.
+// Other endpoints, such as production, come from the config file or
+// WEBHOOK_URL, along with their token.
+var builtinProfiles = map[string]*webhookConfig{
+	"local": {
+		URL:            "http://127.0.0.1:54321/functions/v1/trade-bot_v2",
+		Timeout:        configDuration(10 * time.Second),
+		ConnectTimeout: configDuration(2 * time.Second),
+		MaxAttempts:    3,
+		InitialBackoff: configDuration(500 * time.Millisecond),
+		MaxBackoff:     configDuration(5 * time.Second),
+		DeadLetterDir:  "deadletter-local",
+		SeenDir:        "seen-local",
+	},
+}
+
+// configDuration is a time.Duration that is written as a string such as "10s"
+// in the config file.
+type configDuration time.Duration
+
+func (d configDuration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *configDuration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("duration must be a string such as \"10s\": %v", err)
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*d = configDuration(duration)
+	return nil
+}
+
+// loadWebhookConfig resolves the webhook settings. The profile is picked from,
+// in order, the profile argument, WEBHOOK_PROFILE, the config file and
+// "local". The settings of that profile come from the built-in profiles, then
+// the config file, then the WEBHOOK_* environment variables, so a profile
+// that is in neither of the first two can still be used with WEBHOOK_URL. An
+// empty configPath falls back to WEBHOOK_CONFIG, and no config file is read if
+// neither is set.
+func loadWebhookConfig(configPath string, profile string) (*webhookConfig, error) {
+	if configPath == "" {
+		configPath = os.Getenv(envConfigFile)
+	}
+	file := &configFile{}
+	if configPath != "" {
+		data, err := os.ReadFile(configPath)
+		if err != nil {
+			return nil, fmt.Errorf("loadWebhookConfig: Problem reading config file: %v", err)
+		}
+		if err := json.Unmarshal(data, file); err != nil {
+			return nil, fmt.Errorf("loadWebhookConfig: Problem parsing config file %s: %v", configPath, err)
+		}
+	}
+
+	for _, name := range []string{profile, os.Getenv(envProfile), file.Profile, defaultProfile} {
+		if name != "" {
+			profile = name
+			break
+		}
+	}
+	builtin, isBuiltin := builtinProfiles[profile]
+	fromFile, isInFile := file.Profiles[profile]
+	if !isBuiltin && !isInFile && os.Getenv(envURL) == "" {
+		return nil, fmt.Errorf("loadWebhookConfig: unknown profile %q, define it in the config file or set %s", profile, envURL)
+	}
+
+	cfg := &webhookConfig{Headers: make(map[string]string)}
+	for _, layer := range []*webhookConfig{builtin, fromFile} {
+		if layer != nil {
+			cfg.merge(layer)
+		}
+	}
+	if err := cfg.mergeEnv(); err != nil {
+		return nil, err
+	}
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("loadWebhookConfig: profile %q has no url", profile)
+	}
+	// Profiles that only exist in the config file may leave the delivery
+	// settings out.
+	if cfg.MaxAttempts == 0 {
+		cfg.MaxAttempts = 3
+	}
+	if cfg.MaxAttempts < 1 {
+		cfg.MaxAttempts = 1
+	}
+	if cfg.InitialBackoff == 0 {
+		cfg.InitialBackoff = configDuration(500 * time.Millisecond)
+	}
+	if cfg.MaxBackoff == 0 {
+		cfg.MaxBackoff = configDuration(30 * time.Second)
+	}
+	if cfg.MaxBackoff < cfg.InitialBackoff {
+		cfg.MaxBackoff = cfg.InitialBackoff
+	}
+	if cfg.Workers < 1 {
+		cfg.Workers = 4
+	}
+	if cfg.QueueSize < 1 {
+		cfg.QueueSize = 1000
+	}
+	if cfg.DeadLetterDir == "" {
+		cfg.DeadLetterDir = "deadletter-" + profile
+	}
+	if cfg.SeenDir == "" {
+		cfg.SeenDir = "seen-" + profile
+	}
+	return cfg, nil
+}
+
+// merge copies the fields that are set in other over cfg.
+func (cfg *webhookConfig) merge(other *webhookConfig) {
+	if other.URL != "" {
+		cfg.URL = other.URL
+	}
+	if other.Token != "" {
+		cfg.Token = other.Token
+	}
+	for name, value := range other.Headers {
+		cfg.Headers[name] = value
+	}
+	if other.Timeout != 0 {
+		cfg.Timeout = other.Timeout
+	}
+	if other.ConnectTimeout != 0 {
+		cfg.ConnectTimeout = other.ConnectTimeout
+	}
+	if other.MaxAttempts != 0 {
+		cfg.MaxAttempts = other.MaxAttempts
+	}
+	if other.InitialBackoff != 0 {
+		cfg.InitialBackoff = other.InitialBackoff
+	}
+	if other.MaxBackoff != 0 {
+		cfg.MaxBackoff = other.MaxBackoff
+	}
+	if other.Workers != 0 {
+		cfg.Workers = other.Workers
+	}
+	if other.QueueSize != 0 {
+		cfg.QueueSize = other.QueueSize
+	}
+	if other.DeadLetterDir != "" {
+		cfg.DeadLetterDir = other.DeadLetterDir
+	}
+	if other.SeenDir != "" {
+		cfg.SeenDir = other.SeenDir
+	}
+}
+
+// mergeEnv applies the WEBHOOK_* environment variables. WEBHOOK_HEADERS is a
+// comma-separated list of Name=value pairs.
+func (cfg *webhookConfig) mergeEnv() error {
+	fromEnv := &webhookConfig{
+		URL:           os.Getenv(envURL),
+		Token:         os.Getenv(envToken),
+		Headers:       make(map[string]string),
+		DeadLetterDir: os.Getenv(envDeadLetterDir),
+		SeenDir:       os.Getenv(envSeenDir),
+	}
+	if value := os.Getenv(envMaxAttempts); value != "" {
+		maxAttempts, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%s: %v", envMaxAttempts, err)
+		}
+		fromEnv.MaxAttempts = maxAttempts
+	}
+	if headers := os.Getenv(envHeaders); headers != "" {
+		for _, header := range strings.Split(headers, ",") {
+			name, value, found := strings.Cut(header, "=")
+			if !found || strings.TrimSpace(name) == "" {
+				return fmt.Errorf("%s: expected Name=value, got %q", envHeaders, header)
+			}
+			fromEnv.Headers[strings.TrimSpace(name)] = strings.TrimSpace(value)
+		}
+	}
+	for _, timeout := range []struct {
+		name  string
+		value *configDuration
+	}{{envTimeout, &fromEnv.Timeout}, {envConnectTimeout, &fromEnv.ConnectTimeout}} {
+		if value := os.Getenv(timeout.name); value != "" {
+			duration, err := time.ParseDuration(value)
+			if err != nil {
+				return fmt.Errorf("%s: %v", timeout.name, err)
+			}
+			*timeout.value = configDuration(duration)
+		}
+	}
+	cfg.merge(fromEnv)
+	return nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadWebhookConfig(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "webhook.json")
+	err := os.WriteFile(configPath, []byte(`{
+  "profiles": {
+    "local": {"token": "anon"},
+    "prod": {"url": "https://example.com/trade-bot", "token": "secret", "maxAttempts": 8, "maxBackoff": "1m"}
+  }
+}`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		configPath string
+		profile    string
+		env        map[string]string
+		wantURL    string
+		wantToken  string
+		wantErr    string
+	}{
+		{"built-in local", "", "", nil, builtinProfiles["local"].URL, "", ""},
+		{"local from the file", configPath, "local", nil, builtinProfiles["local"].URL, "anon", ""},
+		{"prod from the file", configPath, "prod", nil, "https://example.com/trade-bot", "secret", ""},
+		{"prod isn't built in", "", "prod", nil, "", "", `unknown profile "prod"`},
+		{"prod from the environment", "", "prod",
+			map[string]string{envURL: "https://example.com/env", envToken: "env-secret"}, "https://example.com/env", "env-secret", ""},
+		{"environment over the file", configPath, "prod",
+			map[string]string{envURL: "https://example.com/env"}, "https://example.com/env", "secret", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for _, name := range []string{envConfigFile, envProfile, envURL, envToken, envHeaders, envTimeout,
+				envConnectTimeout, envMaxAttempts, envDeadLetterDir, envSeenDir} {
+				t.Setenv(name, test.env[name])
+			}
+			cfg, err := loadWebhookConfig(test.configPath, test.profile)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("got error %v, want one containing %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.URL != test.wantURL || cfg.Token != test.wantToken {
+				t.Errorf("got url %q and token %q, want %q and %q", cfg.URL, cfg.Token, test.wantURL, test.wantToken)
+			}
+			// The delivery settings a profile leaves out get defaults.
+			if cfg.MaxAttempts < 1 || cfg.InitialBackoff == 0 || cfg.MaxBackoff < cfg.InitialBackoff ||
+				cfg.Workers < 1 || cfg.QueueSize < 1 || cfg.DeadLetterDir == "" || cfg.SeenDir == "" {
+				t.Errorf("missing defaults in %+v", cfg)
+			}
+		})
+	}
+}
+
+// TestBuiltinProfiles makes sure no remote endpoint is compiled in.
+func TestBuiltinProfiles(t *testing.T) {
+	for name, cfg := range builtinProfiles {
+		if !strings.HasPrefix(cfg.URL, "http://127.0.0.1:") && !strings.HasPrefix(cfg.URL, "http://localhost:") {
+			t.Errorf("built-in profile %s posts to %s", name, cfg.URL)
+		}
+	}
+}
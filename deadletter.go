@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/dgraph-io/badger/v4"
+	"sync/atomic"
+	"time"
+)
+
+// deadLetterPrefix is the key prefix of every item in the dead-letter DB. The
+// rest of the key is the item's id: the time it failed followed by a sequence
+// number, so items are replayed in the order they failed.
+var deadLetterPrefix = []byte("deadletter/")
+
+// deadLetter is a webhook payload that could not be delivered.
+type deadLetter struct {
+	ID        string          `json:"id"`
+	TxnHash   string          `json:"txnHash,omitempty"`
+	URL       string          `json:"url"`
+	Payload   json.RawMessage `json:"payload"`
+	Attempts  int             `json:"attempts"`
+	LastError string          `json:"lastError"`
+	FailedAt  time.Time       `json:"failedAt"`
+}
+
+// deadLetterQueue stores undelivered payloads in a small badger DB of its
+// own, separate from the node's DB which we only ever read.
+type deadLetterQueue struct {
+	db *badger.DB
+	// seq tells apart the ids of items that fail in the same nanosecond,
+	// which the workers of a webhookClient can.
+	seq uint32
+}
+
+func openDeadLetterQueue(dir string) (*deadLetterQueue, error) {
+	db, err := badger.Open(badger.DefaultOptions(dir).WithLogger(nil))
+	if err != nil {
+		return nil, fmt.Errorf("openDeadLetterQueue: Problem opening %s: %v", dir, err)
+	}
+	return &deadLetterQueue{db: db}, nil
+}
+
+func (dlq *deadLetterQueue) Close() error {
+	return dlq.db.Close()
+}
+
+// Add stores a payload that failed delivery and fills in its id.
+func (dlq *deadLetterQueue) Add(item *deadLetter) error {
+	if item.ID == "" {
+		id := make([]byte, 12)
+		binary.BigEndian.PutUint64(id, uint64(item.FailedAt.UnixNano()))
+		binary.BigEndian.PutUint32(id[8:], atomic.AddUint32(&dlq.seq, 1))
+		item.ID = hex.EncodeToString(id)
+	}
+	return dlq.Put(item)
+}
+
+// Put writes item under its id, replacing any earlier version of it.
+func (dlq *deadLetterQueue) Put(item *deadLetter) error {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	return dlq.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(append(append([]byte{}, deadLetterPrefix...), item.ID...), data)
+	})
+}
+
+func (dlq *deadLetterQueue) Delete(id string) error {
+	return dlq.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete(append(append([]byte{}, deadLetterPrefix...), id...))
+	})
+}
+
+// List returns the dead-lettered items, oldest first.
+func (dlq *deadLetterQueue) List() ([]*deadLetter, error) {
+	var items []*deadLetter
+	err := dlq.db.View(func(txn *badger.Txn) error {
+		_, vals, err := _enumerateKeysForPrefixWithTxn(badgerV4Txn{txn}, deadLetterPrefix)
+		if err != nil {
+			return err
+		}
+		for _, val := range vals {
+			item := &deadLetter{}
+			if err := json.Unmarshal(val, item); err != nil {
+				return fmt.Errorf("deadLetterQueue.List: Problem parsing item: %v", err)
+			}
+			items = append(items, item)
+		}
+		return nil
+	})
+	return items, err
+}
@@ -0,0 +1,29 @@
+//go:build !windows && !plan9
+
+package main
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// checkDirLock returns errDirLocked if another process, such as the running
+// node, holds badger's lock on dir. badger takes it with flock on the
+// directory itself, so the same shared lock a read-only open would take is
+// tried and released at once.
+func checkDirLock(dir string) error {
+	f, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := unix.Flock(int(f.Fd()), unix.LOCK_SH|unix.LOCK_NB); err != nil {
+		if errors.Is(err, unix.EWOULDBLOCK) {
+			return errDirLocked
+		}
+		return err
+	}
+	return nil
+}
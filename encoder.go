@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"unicode/utf8"
+)
+
+// The helpers in this file mirror the encoding primitives of core's
+// lib/db_utils.go, and entries.go and values.go mirror its entries, instead of
+// decoding through core. The core release pinned in go.mod predates the
+// DeSoEncoder layout, it stored entries with gob, so its lib package can't
+// decode what a current node writes; the tests only use it to encode txn
+// metadata whose layout hasn't changed since. The releases that can decode
+// current entries turn the version byte back into a block height through
+// core's global network params, which a tool pointed at a DB directory
+// doesn't know, so these decoders take the version itself. They are tested
+// against fixtures laid out from core's encoders in encoder_test.go.
+
+// PKID is the 33-byte id core uses for profiles so that a profile survives a
+// change of its public key.
+type PKID [33]byte
+
+// String returns the PKID Base58Check encoded like a public key, as core
+// prints it.
+func (pkid PKID) String() string {
+	return PkToString(pkid[:])
+}
+
+func (pkid PKID) MarshalJSON() ([]byte, error) {
+	return json.Marshal(pkid.String())
+}
+
+// PublicKey is a 33-byte compressed secp256k1 public key.
+type PublicKey []byte
+
+// String returns the Base58Check encoding of the key, or "" if it is empty.
+func (pk PublicKey) String() string {
+	if len(pk) == 0 {
+		return ""
+	}
+	return PkToString(pk)
+}
+
+func (pk PublicKey) MarshalJSON() ([]byte, error) {
+	return json.Marshal(pk.String())
+}
+
+// BlockHash is a 32-byte hash. Core uses it for block hashes, txids, post
+// hashes and order ids alike.
+type BlockHash [32]byte
+
+func (bh BlockHash) String() string {
+	return hex.EncodeToString(bh[:])
+}
+
+func (bh BlockHash) MarshalJSON() ([]byte, error) {
+	return json.Marshal(bh.String())
+}
+
+// HexBytes is a byte slice that is printed as hex rather than base64.
+type HexBytes []byte
+
+func (data HexBytes) MarshalJSON() ([]byte, error) {
+	return json.Marshal(hex.EncodeToString(data))
+}
+
+// ExtraData is the map[string][]byte core attaches to most entries. Values
+// that are valid UTF-8 are printed as strings, everything else as hex.
+type ExtraData map[string][]byte
+
+func (extraData ExtraData) MarshalJSON() ([]byte, error) {
+	printable := make(map[string]string, len(extraData))
+	for key, value := range extraData {
+		if utf8.Valid(value) {
+			printable[key] = string(value)
+		} else {
+			printable[key] = hex.EncodeToString(value)
+		}
+	}
+	return json.Marshal(printable)
+}
+
+// encoderVersion is the version byte core's EncodeToBytes writes: the number
+// of the last encoder migration that had happened at the height the entry was
+// written at. Entries change their layout only at these migrations.
+type encoderVersion byte
+
+// The encoder migrations, in the order of core's EncoderMigrationHeights.
+const (
+	encoderVersionDefault encoderVersion = iota
+	encoderVersionUnlimitedDerivedKeys
+	encoderVersionAssociationsAndAccessGroups
+	encoderVersionBalanceModel
+	encoderVersionProofOfStake1StateSetup
+	encoderVersionProofOfStake2ConsensusCutover
+)
+
+// latestEncoderVersion is the last migration the decoders know about. An entry
+// written after a later one may have fields they would misread, so it is
+// rejected instead.
+const latestEncoderVersion = encoderVersionProofOfStake2ConsensusCutover
+
+// DeSoDecoder is implemented by every entry we know how to read. It is the
+// decoding half of core's DeSoEncoder interface, which passes the block
+// height rather than the version it was derived from.
+type DeSoDecoder interface {
+	RawDecodeWithoutMetadata(version encoderVersion, rr *bytes.Reader) error
+}
+
+// DecodeFromBytes reads an entry that was written with core's EncodeToBytes:
+// an existence byte, the encoder type and version, and then the entry itself
+// in the layout of that version.
+func DecodeFromBytes(decoder DeSoDecoder, rr *bytes.Reader) (_exists bool, _err error) {
+	exists, err := ReadBoolByte(rr)
+	if err != nil {
+		return false, fmt.Errorf("DecodeFromBytes: Problem reading existence byte: %v", err)
+	}
+	if !exists {
+		return false, nil
+	}
+	if _, err := ReadUvarint(rr); err != nil {
+		return false, fmt.Errorf("DecodeFromBytes: Problem reading encoder type: %v", err)
+	}
+	versionByte, err := rr.ReadByte()
+	if err != nil {
+		return false, fmt.Errorf("DecodeFromBytes: Problem reading encoder version: %v", err)
+	}
+	version := encoderVersion(versionByte)
+	if version > latestEncoderVersion {
+		return false, fmt.Errorf("DecodeFromBytes: %T was written with encoder version %d, "+
+			"the latest one this tool can read is %d", decoder, version, latestEncoderVersion)
+	}
+	if err := decoder.RawDecodeWithoutMetadata(version, rr); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func ReadUvarint(rr *bytes.Reader) (uint64, error) {
+	return binary.ReadUvarint(rr)
+}
+
+func ReadBoolByte(rr *bytes.Reader) (bool, error) {
+	b, err := rr.ReadByte()
+	if err != nil {
+		return false, err
+	}
+	return b != 0, nil
+}
+
+// DecodeByteArray reads a uvarint length followed by that many bytes.
+func DecodeByteArray(rr *bytes.Reader) ([]byte, error) {
+	length, err := ReadUvarint(rr)
+	if err != nil {
+		return nil, err
+	}
+	if length > uint64(rr.Len()) {
+		return nil, fmt.Errorf("DecodeByteArray: length %d exceeds the %d bytes left", length, rr.Len())
+	}
+	if length == 0 {
+		return nil, nil
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(rr, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// VariableDecodeUint256 reads a uint256 that was written with an existence
+// byte followed by its big-endian bytes as a byte array.
+func VariableDecodeUint256(rr *bytes.Reader) (*big.Int, error) {
+	exists, err := ReadBoolByte(rr)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, nil
+	}
+	numberBytes, err := DecodeByteArray(rr)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(numberBytes), nil
+}
+
+// DecodeExtraData reads the number of keys followed by each key and value as
+// byte arrays, in sorted key order.
+func DecodeExtraData(rr *bytes.Reader) (ExtraData, error) {
+	numKeys, err := ReadUvarint(rr)
+	if err != nil {
+		return nil, err
+	}
+	if numKeys > uint64(rr.Len()) {
+		return nil, fmt.Errorf("DecodeExtraData: %d keys can't fit in the %d bytes left", numKeys, rr.Len())
+	}
+	if numKeys == 0 {
+		return nil, nil
+	}
+	extraData := make(ExtraData, numKeys)
+	for ii := uint64(0); ii < numKeys; ii++ {
+		key, err := DecodeByteArray(rr)
+		if err != nil {
+			return nil, fmt.Errorf("DecodeExtraData: Problem reading key #%d: %v", ii, err)
+		}
+		value, err := DecodeByteArray(rr)
+		if err != nil {
+			return nil, fmt.Errorf("DecodeExtraData: Problem reading value #%d: %v", ii, err)
+		}
+		extraData[string(key)] = value
+	}
+	return extraData, nil
+}
+
+// pkidDecoder and blockHashDecoder read the nested PKID and BlockHash
+// encoders that entries embed with EncodeToBytes.
+type pkidDecoder struct{ pkid PKID }
+
+func (d *pkidDecoder) RawDecodeWithoutMetadata(version encoderVersion, rr *bytes.Reader) error {
+	data, err := DecodeByteArray(rr)
+	if err != nil {
+		return err
+	}
+	if len(data) != len(d.pkid) {
+		return fmt.Errorf("PKID: expected %d bytes, got %d", len(d.pkid), len(data))
+	}
+	copy(d.pkid[:], data)
+	return nil
+}
+
+type blockHashDecoder struct{ hash BlockHash }
+
+func (d *blockHashDecoder) RawDecodeWithoutMetadata(version encoderVersion, rr *bytes.Reader) error {
+	data, err := DecodeByteArray(rr)
+	if err != nil {
+		return err
+	}
+	if len(data) != len(d.hash) {
+		return fmt.Errorf("BlockHash: expected %d bytes, got %d", len(d.hash), len(data))
+	}
+	copy(d.hash[:], data)
+	return nil
+}
+
+func DecodePKID(rr *bytes.Reader) (*PKID, error) {
+	decoder := &pkidDecoder{}
+	exists, err := DecodeFromBytes(decoder, rr)
+	if err != nil || !exists {
+		return nil, err
+	}
+	return &decoder.pkid, nil
+}
+
+func DecodeBlockHash(rr *bytes.Reader) (*BlockHash, error) {
+	decoder := &blockHashDecoder{}
+	exists, err := DecodeFromBytes(decoder, rr)
+	if err != nil || !exists {
+		return nil, err
+	}
+	return &decoder.hash, nil
+}
@@ -0,0 +1,434 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testEncoder writes entries the way core's EncodeToBytes and the helpers in
+// lib/db_utils.go do. The core release in go.mod can't write the DeSoEncoder
+// layout, so the fixtures below are built with it instead.
+type testEncoder struct {
+	bytes.Buffer
+}
+
+func (enc *testEncoder) uvarint(value uint64) *testEncoder {
+	enc.Write(binary.AppendUvarint(nil, value))
+	return enc
+}
+
+func (enc *testEncoder) boolByte(value bool) *testEncoder {
+	if value {
+		enc.WriteByte(1)
+	} else {
+		enc.WriteByte(0)
+	}
+	return enc
+}
+
+func (enc *testEncoder) byteArray(data []byte) *testEncoder {
+	enc.uvarint(uint64(len(data)))
+	enc.Write(data)
+	return enc
+}
+
+func (enc *testEncoder) uint256(value *big.Int) *testEncoder {
+	if value == nil {
+		return enc.boolByte(false)
+	}
+	return enc.boolByte(true).byteArray(value.Bytes())
+}
+
+// header starts an entry: the existence byte, the encoder type and version.
+// The decoders don't look at the type, so it is always 0.
+func (enc *testEncoder) header(version encoderVersion) *testEncoder {
+	enc.boolByte(true).uvarint(0)
+	enc.WriteByte(byte(version))
+	return enc
+}
+
+// pkid and blockHash write the nested PKID and BlockHash encoders.
+func (enc *testEncoder) pkid(pkid *PKID) *testEncoder {
+	return enc.header(encoderVersionDefault).byteArray(pkid[:])
+}
+
+func (enc *testEncoder) blockHash(hash *BlockHash) *testEncoder {
+	return enc.header(encoderVersionDefault).byteArray(hash[:])
+}
+
+func (enc *testEncoder) extraData(extraData map[string]string) *testEncoder {
+	enc.uvarint(uint64(len(extraData)))
+	for key, value := range extraData {
+		enc.byteArray([]byte(key)).byteArray([]byte(value))
+	}
+	return enc
+}
+
+func testPKID(id byte) *PKID {
+	pkid := &PKID{}
+	copy(pkid[:], testPublicKey(id))
+	return pkid
+}
+
+func testBlockHash(id byte) *BlockHash {
+	hash := &BlockHash{}
+	copy(hash[:], bytes.Repeat([]byte{id}, len(hash)))
+	return hash
+}
+
+func TestDecodeFromBytes(t *testing.T) {
+	tests := []struct {
+		name       string
+		data       []byte
+		wantExists bool
+		wantErr    string
+	}{
+		{"exists", new(testEncoder).pkid(testPKID(1)).Bytes(), true, ""},
+		{"doesn't exist", []byte{0}, false, ""},
+		{"latest version", new(testEncoder).header(latestEncoderVersion).byteArray(testPKID(1)[:]).Bytes(), true, ""},
+		{"newer version", new(testEncoder).header(latestEncoderVersion + 1).byteArray(testPKID(1)[:]).Bytes(), false,
+			"written with encoder version 6, the latest one this tool can read is 5"},
+		{"no version", []byte{1, 0}, false, "Problem reading encoder version"},
+		{"empty", nil, false, "Problem reading existence byte"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			decoder := &pkidDecoder{}
+			exists, err := DecodeFromBytes(decoder, bytes.NewReader(test.data))
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("got error %v, want one containing %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if exists != test.wantExists {
+				t.Errorf("got exists %v, want %v", exists, test.wantExists)
+			}
+			if exists && decoder.pkid != *testPKID(1) {
+				t.Errorf("got PKID %v, want %v", decoder.pkid, testPKID(1))
+			}
+		})
+	}
+}
+
+func TestDecodeEntries(t *testing.T) {
+	coinEntry := func(enc *testEncoder) *testEncoder {
+		enc.header(encoderVersionDefault).uvarint(1000).uvarint(5000000000).uvarint(3).
+			uint256(big.NewInt(2000000000)).uvarint(2500000000).boolByte(false)
+		enc.WriteByte(0)
+		return enc
+	}
+	profile := new(testEncoder).header(encoderVersionBalanceModel).byteArray(testPublicKey(1)).
+		byteArray([]byte("Alice")).byteArray([]byte("About Alice")).byteArray(nil).boolByte(false)
+	coinEntry(profile)
+	profile.header(encoderVersionDefault).uvarint(0).uvarint(0).uvarint(0).uint256(nil).uvarint(0).boolByte(true)
+	profile.WriteByte(2)
+	profile.extraData(map[string]string{"DisplayName": "Alice A."})
+	// From the ProofOfStake1StateSetup migration on, both coin entries end
+	// with LockupTransferRestrictionStatus.
+	posProfile := new(testEncoder).header(latestEncoderVersion).byteArray(testPublicKey(1)).
+		byteArray([]byte("Alice")).byteArray(nil).byteArray(nil).boolByte(false)
+	posProfile.header(encoderVersionProofOfStake1StateSetup).uvarint(1000).uvarint(5000000000).uvarint(3).
+		uint256(big.NewInt(2000000000)).uvarint(2500000000).boolByte(false)
+	posProfile.WriteByte(0)
+	posProfile.WriteByte(1)
+	posProfile.header(encoderVersionProofOfStake1StateSetup).uvarint(0).uvarint(0).uvarint(0).uint256(nil).uvarint(0).boolByte(true)
+	posProfile.WriteByte(2)
+	posProfile.WriteByte(3)
+	posProfile.extraData(map[string]string{"DisplayName": "Alice A."})
+	// 1.5 quote base units per base unit.
+	rate := new(big.Int).Mul(big.NewInt(15), new(big.Int).Exp(big.NewInt(10), big.NewInt(37), nil))
+
+	tests := []struct {
+		name    string
+		decoder DeSoDecoder
+		data    []byte
+		want    DeSoDecoder
+	}{
+		{"ProfileEntry", &ProfileEntry{}, profile.Bytes(), &ProfileEntry{
+			PublicKey:   testPublicKey(1),
+			Username:    "Alice",
+			Description: "About Alice",
+			CreatorCoinEntry: CoinEntry{
+				CreatorBasisPoints:      1000,
+				DeSoLockedNanos:         5000000000,
+				NumberOfHolders:         3,
+				CoinsInCirculationNanos: big.NewInt(2000000000),
+				CoinWatermarkNanos:      2500000000,
+			},
+			DAOCoinEntry: CoinEntry{MintingDisabled: true, TransferRestrictionStatus: 2},
+			ExtraData:    ExtraData{"DisplayName": []byte("Alice A.")},
+		}},
+		{"ProfileEntry latest version", &ProfileEntry{}, posProfile.Bytes(), &ProfileEntry{
+			PublicKey: testPublicKey(1),
+			Username:  "Alice",
+			CreatorCoinEntry: CoinEntry{
+				CreatorBasisPoints:              1000,
+				DeSoLockedNanos:                 5000000000,
+				NumberOfHolders:                 3,
+				CoinsInCirculationNanos:         big.NewInt(2000000000),
+				CoinWatermarkNanos:              2500000000,
+				LockupTransferRestrictionStatus: 1,
+			},
+			DAOCoinEntry: CoinEntry{MintingDisabled: true, TransferRestrictionStatus: 2, LockupTransferRestrictionStatus: 3},
+			ExtraData:    ExtraData{"DisplayName": []byte("Alice A.")},
+		}},
+		{"BalanceEntry",
+			&BalanceEntry{},
+			new(testEncoder).header(encoderVersionDefault).pkid(testPKID(2)).pkid(testPKID(1)).
+				uint256(big.NewInt(123456789)).boolByte(true).Bytes(),
+			&BalanceEntry{HODLerPKID: testPKID(2), CreatorPKID: testPKID(1), BalanceNanos: big.NewInt(123456789), HasPurchased: true}},
+		{"DAOCoinLimitOrderEntry",
+			&DAOCoinLimitOrderEntry{},
+			new(testEncoder).header(encoderVersionDefault).blockHash(testBlockHash(7)).pkid(testPKID(2)).
+				pkid(testPKID(1)).pkid(&PKID{}).uint256(rate).uint256(big.NewInt(250)).
+				uvarint(uint64(DAOCoinLimitOrderOperationTypeBID)).uvarint(1).uvarint(4294967195).Bytes(),
+			&DAOCoinLimitOrderEntry{
+				OrderID:                   testBlockHash(7),
+				TransactorPKID:            testPKID(2),
+				BuyingDAOCoinCreatorPKID:  testPKID(1),
+				SellingDAOCoinCreatorPKID: &PKID{},
+				ScaledExchangeRateCoinsToSellPerCoinToBuy: rate,
+				QuantityToFillInBaseUnits:                 big.NewInt(250),
+				OperationType:                             uint64(DAOCoinLimitOrderOperationTypeBID),
+				FillType:                                  1,
+				BlockHeight:                               4294967195,
+			}},
+		{"UtxoEntry",
+			&UtxoEntry{},
+			new(testEncoder).header(encoderVersionDefault).uvarint(1000).byteArray(testPublicKey(1)).uvarint(12).
+				boolByte(false).header(encoderVersionDefault).blockHash(testBlockHash(3)).uvarint(1).Bytes(),
+			&UtxoEntry{AmountNanos: 1000, PublicKey: testPublicKey(1), BlockHeight: 12,
+				UtxoKey: &UtxoKey{TxID: testBlockHash(3), Index: 1}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rr := bytes.NewReader(test.data)
+			exists, err := DecodeFromBytes(test.decoder, rr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !exists {
+				t.Fatal("the entry doesn't exist")
+			}
+			if rr.Len() != 0 {
+				t.Errorf("%d bytes were left", rr.Len())
+			}
+			if !reflect.DeepEqual(test.decoder, test.want) {
+				t.Errorf("got %+v, want %+v", test.decoder, test.want)
+			}
+		})
+	}
+}
+
+// TestDecodePostEntryVersions decodes a post written before and after the
+// migration that added IsFrozen. The older post is followed by another entry,
+// whose first byte must not be mistaken for IsFrozen.
+func TestDecodePostEntryVersions(t *testing.T) {
+	post := func(version encoderVersion) *testEncoder {
+		enc := new(testEncoder).header(version).blockHash(testBlockHash(1)).byteArray(testPublicKey(1)).
+			byteArray(nil).byteArray([]byte("gm")).boolByte(false).boolByte(false).
+			uvarint(0).uvarint(0).uvarint(12).uvarint(1700000000000000000).boolByte(false)
+		for i := 0; i < 5; i++ {
+			enc.uvarint(uint64(i))
+		}
+		enc.boolByte(false).boolByte(false).uvarint(0).uvarint(0).uvarint(0).boolByte(false).
+			uvarint(0).uvarint(0).uvarint(0).uvarint(0).extraData(nil)
+		return enc
+	}
+
+	older := post(encoderVersionUnlimitedDerivedKeys)
+	older.pkid(testPKID(9))
+	newer := post(encoderVersionAssociationsAndAccessGroups).boolByte(true)
+
+	for _, test := range []struct {
+		name         string
+		data         []byte
+		wantIsFrozen bool
+		wantLeft     int
+	}{
+		{"before IsFrozen", older.Bytes(), false, len(new(testEncoder).pkid(testPKID(9)).Bytes())},
+		{"with IsFrozen", newer.Bytes(), true, 0},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			rr := bytes.NewReader(test.data)
+			entry := &PostEntry{}
+			if _, err := DecodeFromBytes(entry, rr); err != nil {
+				t.Fatal(err)
+			}
+			if entry.Body != "gm" || entry.CommentCount != 4 || entry.IsFrozen != test.wantIsFrozen {
+				t.Errorf("got body %q, %d comments and IsFrozen %v, want %q, 4 and %v",
+					entry.Body, entry.CommentCount, entry.IsFrozen, "gm", test.wantIsFrozen)
+			}
+			if rr.Len() != test.wantLeft {
+				t.Errorf("got %d bytes left, want %d", rr.Len(), test.wantLeft)
+			}
+		})
+	}
+}
+
+// The hex fixtures below are written out field by field from the
+// RawEncodeWithoutMetadata methods in core's lib/block_view_types.go rather
+// than built with testEncoder, so that a mistake shared by testEncoder and the
+// decoders doesn't go unnoticed. The values are the hex `dbtool get` prints, so
+// a fixture can be swapped for an entry read from a node.
+const (
+	fixturePublicKey1 = "024dca182530bb1d6d132cded6237b2ed91e3f721fcb1971174494d6493c9d5c34"
+	fixturePublicKey2 = "03be31201e69fedaa0eee8b9997f5c7c2999fdafe593253cd654af4dfad71427a0"
+	fixtureHash1      = "aeb3fee9232f8af2211f9ee491c5b10becb5563bfc1e6f93427ecbc8fe2955e5"
+	fixtureHash2      = "cd8e46dc8ed4b7c2764d2a5a4d767706f85d8690024ad6bda3401be9c8cbccc9"
+)
+
+func fixtureBytes(t *testing.T, hexString string) []byte {
+	t.Helper()
+	data, err := hex.DecodeString(hexString)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestDecodeEntryHexFixtures(t *testing.T) {
+	tests := []struct {
+		name    string
+		decoder DeSoDecoder
+		value   string
+		want    func(t *testing.T) DeSoDecoder
+	}{
+		{"ProfileEntry", &ProfileEntry{}, "" +
+			"01" + "14" + "05" + // exists, encoder type, version
+			"21" + fixturePublicKey1 + // PublicKey
+			"05" + "416c696365" + // Username
+			"02" + "676d" + // Description
+			"00" + // ProfilePic
+			"00" + // IsHidden
+			"01" + "12" + "04" + // CreatorCoinEntry
+			"904e" + "80bcc1960b" + "c430" + "010608e9bd84d000" + "80a093ec9b9d02" + "00" + "00" + "00" +
+			"01" + "12" + "04" + // DAOCoinEntry
+			"00" + "00" + "00" + "0100" + "00" + "01" + "02" + "00" +
+			"00", // ExtraData
+			func(t *testing.T) DeSoDecoder {
+				return &ProfileEntry{
+					PublicKey:   fixtureBytes(t, fixturePublicKey1),
+					Username:    "Alice",
+					Description: "gm",
+					CreatorCoinEntry: CoinEntry{
+						CreatorBasisPoints:      10000,
+						DeSoLockedNanos:         3000000000,
+						NumberOfHolders:         6212,
+						CoinsInCirculationNanos: big.NewInt(9800000000000),
+						CoinWatermarkNanos:      9800000000000,
+					},
+					DAOCoinEntry: CoinEntry{
+						CoinsInCirculationNanos:   big.NewInt(0),
+						MintingDisabled:           true,
+						TransferRestrictionStatus: 2,
+					},
+				}
+			}},
+		{"BalanceEntry", &BalanceEntry{}, "" +
+			"01" + "11" + "00" + // exists, encoder type, version
+			"01" + "15" + "00" + "21" + fixturePublicKey2 + // HODLerPKID
+			"01" + "15" + "00" + "21" + fixturePublicKey1 + // CreatorPKID
+			"0104075bcd15" + // BalanceNanos
+			"01", // HasPurchased
+			func(t *testing.T) DeSoDecoder {
+				hodler, creator := &PKID{}, &PKID{}
+				copy(hodler[:], fixtureBytes(t, fixturePublicKey2))
+				copy(creator[:], fixtureBytes(t, fixturePublicKey1))
+				return &BalanceEntry{HODLerPKID: hodler, CreatorPKID: creator, BalanceNanos: big.NewInt(123456789), HasPurchased: true}
+			}},
+		{"PostEntry", &PostEntry{}, "" +
+			"01" + "10" + "02" + // exists, encoder type, version
+			"01" + "1b" + "00" + "20" + fixtureHash2 + // PostHash
+			"21" + fixturePublicKey1 + // PosterPublicKey
+			"00" + // ParentStakeID
+			"0d" + "7b22426f6479223a22676d227d" + // Body
+			"00" + "00" + // RepostedPostHash, IsQuotedRepost
+			"00" + "904e" + // CreatorBasisPoints, StakeMultipleBasisPoints
+			"95d60f" + "959a97ece39fe7cb17" + // ConfirmationBlockHeight, TimestampNanos
+			"00" + // IsHidden
+			"61" + "00" + "00" + "03" + "05" + // like, repost, quote repost, diamond and comment counts
+			"00" + "00" + "00" + "00" + "00" + "00" + // IsPinned, IsNFT, NFT copies, for sale, burned, HasUnlockable
+			"00" + "00" + "00" + "00" + // NFT royalties
+			"01" + "08" + "4c616e6775616765" + "02" + "656e" + // PostExtraData
+			"01", // IsFrozen
+			func(t *testing.T) DeSoDecoder {
+				postHash := &BlockHash{}
+				copy(postHash[:], fixtureBytes(t, fixtureHash2))
+				return &PostEntry{
+					PostHash:                 postHash,
+					PosterPublicKey:          fixtureBytes(t, fixturePublicKey1),
+					Body:                     `{"Body":"gm"}`,
+					StakeMultipleBasisPoints: 10000,
+					ConfirmationBlockHeight:  256789,
+					TimestampNanos:           1700000000123456789,
+					LikeCount:                97,
+					DiamondCount:             3,
+					CommentCount:             5,
+					PostExtraData:            ExtraData{"Language": []byte("en")},
+					IsFrozen:                 true,
+				}
+			}},
+		{"DAOCoinLimitOrderEntry", &DAOCoinLimitOrderEntry{}, "" +
+			"01" + "18" + "00" + // exists, encoder type, version
+			"01" + "1b" + "00" + "20" + fixtureHash1 + // OrderID
+			"01" + "15" + "00" + "21" + fixturePublicKey2 + // TransactorPKID
+			"01" + "15" + "00" + "21" + fixturePublicKey1 + // BuyingDAOCoinCreatorPKID
+			"01" + "15" + "00" + "21" + strings.Repeat("00", 33) + // SellingDAOCoinCreatorPKID, DeSo
+			"011070d8f2fc87ca26b70e4f336000000000" + // ScaledExchangeRateCoinsToSellPerCoinToBuy
+			"0101fa" + // QuantityToFillInBaseUnits
+			"01" + "01" + "95d60f", // OperationType, FillType, BlockHeight
+			func(t *testing.T) DeSoDecoder {
+				orderID, transactor, buying := &BlockHash{}, &PKID{}, &PKID{}
+				copy(orderID[:], fixtureBytes(t, fixtureHash1))
+				copy(transactor[:], fixtureBytes(t, fixturePublicKey2))
+				copy(buying[:], fixtureBytes(t, fixturePublicKey1))
+				rate, _ := new(big.Int).SetString("150000000000000000000000000000000000000", 10)
+				return &DAOCoinLimitOrderEntry{
+					OrderID:                   orderID,
+					TransactorPKID:            transactor,
+					BuyingDAOCoinCreatorPKID:  buying,
+					SellingDAOCoinCreatorPKID: &PKID{},
+					ScaledExchangeRateCoinsToSellPerCoinToBuy: rate,
+					QuantityToFillInBaseUnits:                 big.NewInt(250),
+					OperationType:                             uint64(DAOCoinLimitOrderOperationTypeASK),
+					FillType:                                  1,
+					BlockHeight:                               256789,
+				}
+			}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rr := bytes.NewReader(fixtureBytes(t, test.value))
+			if _, err := DecodeFromBytes(test.decoder, rr); err != nil {
+				t.Fatal(err)
+			}
+			if rr.Len() != 0 {
+				t.Errorf("%d bytes were left", rr.Len())
+			}
+			// The entries are compared as JSON, where a zero big.Int reads
+			// the same however it was built.
+			got, err := json.Marshal(test.decoder)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := json.Marshal(test.want(t))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("got %s, want %s", got, want)
+			}
+		})
+	}
+}
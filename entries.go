@@ -0,0 +1,482 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+)
+
+// The entry types below mirror the state entries in core's
+// lib/block_view_types.go, restricted to the fields a current node encodes.
+// Each one decodes the RawEncodeWithoutMetadata layout of its core
+// counterpart.
+
+func decodePublicKey(rr *bytes.Reader) (PublicKey, error) {
+	data, err := DecodeByteArray(rr)
+	return PublicKey(data), err
+}
+
+func decodeString(rr *bytes.Reader) (string, error) {
+	data, err := DecodeByteArray(rr)
+	return string(data), err
+}
+
+// decodePKIDUint64Map reads the royalty maps on PostEntry: the number of
+// entries, followed by each PKID as a byte array and its uvarint value.
+func decodePKIDUint64Map(rr *bytes.Reader) (map[string]uint64, error) {
+	length, err := ReadUvarint(rr)
+	if err != nil {
+		return nil, err
+	}
+	if length > uint64(rr.Len()) {
+		return nil, fmt.Errorf("decodePKIDUint64Map: %d entries can't fit in the %d bytes left", length, rr.Len())
+	}
+	if length == 0 {
+		return nil, nil
+	}
+	ret := make(map[string]uint64, length)
+	for ii := uint64(0); ii < length; ii++ {
+		pkidBytes, err := DecodeByteArray(rr)
+		if err != nil {
+			return nil, err
+		}
+		var pkid PKID
+		copy(pkid[:], pkidBytes)
+		value, err := ReadUvarint(rr)
+		if err != nil {
+			return nil, err
+		}
+		ret[pkid.String()] = value
+	}
+	return ret, nil
+}
+
+// CoinEntry holds the state of a creator coin or DAO coin.
+type CoinEntry struct {
+	CreatorBasisPoints        uint64
+	DeSoLockedNanos           uint64
+	NumberOfHolders           uint64
+	CoinsInCirculationNanos   *big.Int
+	CoinWatermarkNanos        uint64
+	MintingDisabled           bool
+	TransferRestrictionStatus uint8
+	// LockupTransferRestrictionStatus is only written from the
+	// ProofOfStake1StateSetup migration on.
+	LockupTransferRestrictionStatus uint8
+}
+
+func (ce *CoinEntry) RawDecodeWithoutMetadata(version encoderVersion, rr *bytes.Reader) error {
+	var err error
+	if ce.CreatorBasisPoints, err = ReadUvarint(rr); err != nil {
+		return fmt.Errorf("CoinEntry.Decode: Problem reading CreatorBasisPoints: %v", err)
+	}
+	if ce.DeSoLockedNanos, err = ReadUvarint(rr); err != nil {
+		return fmt.Errorf("CoinEntry.Decode: Problem reading DeSoLockedNanos: %v", err)
+	}
+	if ce.NumberOfHolders, err = ReadUvarint(rr); err != nil {
+		return fmt.Errorf("CoinEntry.Decode: Problem reading NumberOfHolders: %v", err)
+	}
+	if ce.CoinsInCirculationNanos, err = VariableDecodeUint256(rr); err != nil {
+		return fmt.Errorf("CoinEntry.Decode: Problem reading CoinsInCirculationNanos: %v", err)
+	}
+	if ce.CoinWatermarkNanos, err = ReadUvarint(rr); err != nil {
+		return fmt.Errorf("CoinEntry.Decode: Problem reading CoinWatermarkNanos: %v", err)
+	}
+	if ce.MintingDisabled, err = ReadBoolByte(rr); err != nil {
+		return fmt.Errorf("CoinEntry.Decode: Problem reading MintingDisabled: %v", err)
+	}
+	if ce.TransferRestrictionStatus, err = rr.ReadByte(); err != nil {
+		return fmt.Errorf("CoinEntry.Decode: Problem reading TransferRestrictionStatus: %v", err)
+	}
+	if version >= encoderVersionProofOfStake1StateSetup {
+		if ce.LockupTransferRestrictionStatus, err = rr.ReadByte(); err != nil {
+			return fmt.Errorf("CoinEntry.Decode: Problem reading LockupTransferRestrictionStatus: %v", err)
+		}
+	}
+	return nil
+}
+
+// ProfileEntry is stored under PrefixPKIDToProfileEntry.
+type ProfileEntry struct {
+	PublicKey        PublicKey
+	Username         string
+	Description      string
+	ProfilePic       string
+	IsHidden         bool
+	CreatorCoinEntry CoinEntry
+	DAOCoinEntry     CoinEntry
+	ExtraData        ExtraData
+}
+
+func (pe *ProfileEntry) RawDecodeWithoutMetadata(version encoderVersion, rr *bytes.Reader) error {
+	var err error
+	if pe.PublicKey, err = decodePublicKey(rr); err != nil {
+		return fmt.Errorf("ProfileEntry.Decode: Problem reading PublicKey: %v", err)
+	}
+	if pe.Username, err = decodeString(rr); err != nil {
+		return fmt.Errorf("ProfileEntry.Decode: Problem reading Username: %v", err)
+	}
+	if pe.Description, err = decodeString(rr); err != nil {
+		return fmt.Errorf("ProfileEntry.Decode: Problem reading Description: %v", err)
+	}
+	if pe.ProfilePic, err = decodeString(rr); err != nil {
+		return fmt.Errorf("ProfileEntry.Decode: Problem reading ProfilePic: %v", err)
+	}
+	if pe.IsHidden, err = ReadBoolByte(rr); err != nil {
+		return fmt.Errorf("ProfileEntry.Decode: Problem reading IsHidden: %v", err)
+	}
+	if _, err = DecodeFromBytes(&pe.CreatorCoinEntry, rr); err != nil {
+		return fmt.Errorf("ProfileEntry.Decode: Problem reading CreatorCoinEntry: %v", err)
+	}
+	if _, err = DecodeFromBytes(&pe.DAOCoinEntry, rr); err != nil {
+		return fmt.Errorf("ProfileEntry.Decode: Problem reading DAOCoinEntry: %v", err)
+	}
+	if pe.ExtraData, err = DecodeExtraData(rr); err != nil {
+		return fmt.Errorf("ProfileEntry.Decode: Problem reading ExtraData: %v", err)
+	}
+	return nil
+}
+
+// BalanceEntry is stored under the creator coin and DAO coin balance prefixes.
+type BalanceEntry struct {
+	HODLerPKID   *PKID
+	CreatorPKID  *PKID
+	BalanceNanos *big.Int
+	HasPurchased bool
+}
+
+func (be *BalanceEntry) RawDecodeWithoutMetadata(version encoderVersion, rr *bytes.Reader) error {
+	var err error
+	if be.HODLerPKID, err = DecodePKID(rr); err != nil {
+		return fmt.Errorf("BalanceEntry.Decode: Problem reading HODLerPKID: %v", err)
+	}
+	if be.CreatorPKID, err = DecodePKID(rr); err != nil {
+		return fmt.Errorf("BalanceEntry.Decode: Problem reading CreatorPKID: %v", err)
+	}
+	if be.BalanceNanos, err = VariableDecodeUint256(rr); err != nil {
+		return fmt.Errorf("BalanceEntry.Decode: Problem reading BalanceNanos: %v", err)
+	}
+	if be.HasPurchased, err = ReadBoolByte(rr); err != nil {
+		return fmt.Errorf("BalanceEntry.Decode: Problem reading HasPurchased: %v", err)
+	}
+	return nil
+}
+
+// UtxoKey identifies an output by the txid that created it and its index.
+type UtxoKey struct {
+	TxID  *BlockHash
+	Index uint32
+}
+
+func (key *UtxoKey) RawDecodeWithoutMetadata(version encoderVersion, rr *bytes.Reader) error {
+	var err error
+	if key.TxID, err = DecodeBlockHash(rr); err != nil {
+		return fmt.Errorf("UtxoKey.Decode: Problem reading TxID: %v", err)
+	}
+	index, err := ReadUvarint(rr)
+	if err != nil {
+		return fmt.Errorf("UtxoKey.Decode: Problem reading Index: %v", err)
+	}
+	key.Index = uint32(index)
+	return nil
+}
+
+// UtxoEntry is stored under PrefixUtxoKeyToUtxoEntry.
+type UtxoEntry struct {
+	AmountNanos uint64
+	PublicKey   PublicKey
+	BlockHeight uint32
+	UtxoType    uint8
+	UtxoKey     *UtxoKey
+}
+
+func (utxo *UtxoEntry) RawDecodeWithoutMetadata(version encoderVersion, rr *bytes.Reader) error {
+	var err error
+	if utxo.AmountNanos, err = ReadUvarint(rr); err != nil {
+		return fmt.Errorf("UtxoEntry.Decode: Problem reading AmountNanos: %v", err)
+	}
+	if utxo.PublicKey, err = decodePublicKey(rr); err != nil {
+		return fmt.Errorf("UtxoEntry.Decode: Problem reading PublicKey: %v", err)
+	}
+	blockHeight, err := ReadUvarint(rr)
+	if err != nil {
+		return fmt.Errorf("UtxoEntry.Decode: Problem reading BlockHeight: %v", err)
+	}
+	utxo.BlockHeight = uint32(blockHeight)
+	if utxo.UtxoType, err = rr.ReadByte(); err != nil {
+		return fmt.Errorf("UtxoEntry.Decode: Problem reading UtxoType: %v", err)
+	}
+	utxoKey := &UtxoKey{}
+	exists, err := DecodeFromBytes(utxoKey, rr)
+	if err != nil {
+		return fmt.Errorf("UtxoEntry.Decode: Problem reading UtxoKey: %v", err)
+	}
+	if exists {
+		utxo.UtxoKey = utxoKey
+	}
+	return nil
+}
+
+// PostEntry is stored under PrefixPostHashToPostEntry.
+type PostEntry struct {
+	PostHash                                    *BlockHash
+	PosterPublicKey                             PublicKey
+	ParentStakeID                               HexBytes
+	Body                                        string
+	RepostedPostHash                            *BlockHash
+	IsQuotedRepost                              bool
+	CreatorBasisPoints                          uint64
+	StakeMultipleBasisPoints                    uint64
+	ConfirmationBlockHeight                     uint32
+	TimestampNanos                              uint64
+	IsHidden                                    bool
+	LikeCount                                   uint64
+	RepostCount                                 uint64
+	QuoteRepostCount                            uint64
+	DiamondCount                                uint64
+	CommentCount                                uint64
+	IsPinned                                    bool
+	IsNFT                                       bool
+	NumNFTCopies                                uint64
+	NumNFTCopiesForSale                         uint64
+	NumNFTCopiesBurned                          uint64
+	HasUnlockable                               bool
+	NFTRoyaltyToCreatorBasisPoints              uint64
+	NFTRoyaltyToCoinBasisPoints                 uint64
+	AdditionalNFTRoyaltiesToCreatorsBasisPoints map[string]uint64
+	AdditionalNFTRoyaltiesToCoinsBasisPoints    map[string]uint64
+	PostExtraData                               ExtraData
+	IsFrozen                                    bool
+}
+
+func (pe *PostEntry) RawDecodeWithoutMetadata(version encoderVersion, rr *bytes.Reader) error {
+	var err error
+	if pe.PostHash, err = DecodeBlockHash(rr); err != nil {
+		return fmt.Errorf("PostEntry.Decode: Problem reading PostHash: %v", err)
+	}
+	if pe.PosterPublicKey, err = decodePublicKey(rr); err != nil {
+		return fmt.Errorf("PostEntry.Decode: Problem reading PosterPublicKey: %v", err)
+	}
+	if pe.ParentStakeID, err = DecodeByteArray(rr); err != nil {
+		return fmt.Errorf("PostEntry.Decode: Problem reading ParentStakeID: %v", err)
+	}
+	if pe.Body, err = decodeString(rr); err != nil {
+		return fmt.Errorf("PostEntry.Decode: Problem reading Body: %v", err)
+	}
+	if pe.RepostedPostHash, err = DecodeBlockHash(rr); err != nil {
+		return fmt.Errorf("PostEntry.Decode: Problem reading RepostedPostHash: %v", err)
+	}
+	if pe.IsQuotedRepost, err = ReadBoolByte(rr); err != nil {
+		return fmt.Errorf("PostEntry.Decode: Problem reading IsQuotedRepost: %v", err)
+	}
+	if pe.CreatorBasisPoints, err = ReadUvarint(rr); err != nil {
+		return fmt.Errorf("PostEntry.Decode: Problem reading CreatorBasisPoints: %v", err)
+	}
+	if pe.StakeMultipleBasisPoints, err = ReadUvarint(rr); err != nil {
+		return fmt.Errorf("PostEntry.Decode: Problem reading StakeMultipleBasisPoints: %v", err)
+	}
+	confirmationBlockHeight, err := ReadUvarint(rr)
+	if err != nil {
+		return fmt.Errorf("PostEntry.Decode: Problem reading ConfirmationBlockHeight: %v", err)
+	}
+	pe.ConfirmationBlockHeight = uint32(confirmationBlockHeight)
+	if pe.TimestampNanos, err = ReadUvarint(rr); err != nil {
+		return fmt.Errorf("PostEntry.Decode: Problem reading TimestampNanos: %v", err)
+	}
+	if pe.IsHidden, err = ReadBoolByte(rr); err != nil {
+		return fmt.Errorf("PostEntry.Decode: Problem reading IsHidden: %v", err)
+	}
+	for _, count := range []*uint64{&pe.LikeCount, &pe.RepostCount, &pe.QuoteRepostCount, &pe.DiamondCount, &pe.CommentCount} {
+		if *count, err = ReadUvarint(rr); err != nil {
+			return fmt.Errorf("PostEntry.Decode: Problem reading counts: %v", err)
+		}
+	}
+	if pe.IsPinned, err = ReadBoolByte(rr); err != nil {
+		return fmt.Errorf("PostEntry.Decode: Problem reading IsPinned: %v", err)
+	}
+	if pe.IsNFT, err = ReadBoolByte(rr); err != nil {
+		return fmt.Errorf("PostEntry.Decode: Problem reading IsNFT: %v", err)
+	}
+	for _, count := range []*uint64{&pe.NumNFTCopies, &pe.NumNFTCopiesForSale, &pe.NumNFTCopiesBurned} {
+		if *count, err = ReadUvarint(rr); err != nil {
+			return fmt.Errorf("PostEntry.Decode: Problem reading NFT copies: %v", err)
+		}
+	}
+	if pe.HasUnlockable, err = ReadBoolByte(rr); err != nil {
+		return fmt.Errorf("PostEntry.Decode: Problem reading HasUnlockable: %v", err)
+	}
+	if pe.NFTRoyaltyToCreatorBasisPoints, err = ReadUvarint(rr); err != nil {
+		return fmt.Errorf("PostEntry.Decode: Problem reading NFTRoyaltyToCreatorBasisPoints: %v", err)
+	}
+	if pe.NFTRoyaltyToCoinBasisPoints, err = ReadUvarint(rr); err != nil {
+		return fmt.Errorf("PostEntry.Decode: Problem reading NFTRoyaltyToCoinBasisPoints: %v", err)
+	}
+	if pe.AdditionalNFTRoyaltiesToCreatorsBasisPoints, err = decodePKIDUint64Map(rr); err != nil {
+		return fmt.Errorf("PostEntry.Decode: Problem reading AdditionalNFTRoyaltiesToCreatorsBasisPoints: %v", err)
+	}
+	if pe.AdditionalNFTRoyaltiesToCoinsBasisPoints, err = decodePKIDUint64Map(rr); err != nil {
+		return fmt.Errorf("PostEntry.Decode: Problem reading AdditionalNFTRoyaltiesToCoinsBasisPoints: %v", err)
+	}
+	if pe.PostExtraData, err = DecodeExtraData(rr); err != nil {
+		return fmt.Errorf("PostEntry.Decode: Problem reading PostExtraData: %v", err)
+	}
+	// IsFrozen was added by the associations and access groups migration.
+	if version >= encoderVersionAssociationsAndAccessGroups {
+		if pe.IsFrozen, err = ReadBoolByte(rr); err != nil {
+			return fmt.Errorf("PostEntry.Decode: Problem reading IsFrozen: %v", err)
+		}
+	}
+	return nil
+}
+
+// NFTEntry is stored under the NFT ownership prefixes.
+type NFTEntry struct {
+	LastOwnerPKID              *PKID
+	OwnerPKID                  *PKID
+	NFTPostHash                *BlockHash
+	SerialNumber               uint64
+	IsForSale                  bool
+	MinBidAmountNanos          uint64
+	UnlockableText             string
+	LastAcceptedBidAmountNanos uint64
+	IsPending                  bool
+	IsBuyNow                   bool
+	BuyNowPriceNanos           uint64
+	ExtraData                  ExtraData
+}
+
+func (nft *NFTEntry) RawDecodeWithoutMetadata(version encoderVersion, rr *bytes.Reader) error {
+	var err error
+	if nft.LastOwnerPKID, err = DecodePKID(rr); err != nil {
+		return fmt.Errorf("NFTEntry.Decode: Problem reading LastOwnerPKID: %v", err)
+	}
+	if nft.OwnerPKID, err = DecodePKID(rr); err != nil {
+		return fmt.Errorf("NFTEntry.Decode: Problem reading OwnerPKID: %v", err)
+	}
+	if nft.NFTPostHash, err = DecodeBlockHash(rr); err != nil {
+		return fmt.Errorf("NFTEntry.Decode: Problem reading NFTPostHash: %v", err)
+	}
+	if nft.SerialNumber, err = ReadUvarint(rr); err != nil {
+		return fmt.Errorf("NFTEntry.Decode: Problem reading SerialNumber: %v", err)
+	}
+	if nft.IsForSale, err = ReadBoolByte(rr); err != nil {
+		return fmt.Errorf("NFTEntry.Decode: Problem reading IsForSale: %v", err)
+	}
+	if nft.MinBidAmountNanos, err = ReadUvarint(rr); err != nil {
+		return fmt.Errorf("NFTEntry.Decode: Problem reading MinBidAmountNanos: %v", err)
+	}
+	if nft.UnlockableText, err = decodeString(rr); err != nil {
+		return fmt.Errorf("NFTEntry.Decode: Problem reading UnlockableText: %v", err)
+	}
+	if nft.LastAcceptedBidAmountNanos, err = ReadUvarint(rr); err != nil {
+		return fmt.Errorf("NFTEntry.Decode: Problem reading LastAcceptedBidAmountNanos: %v", err)
+	}
+	if nft.IsPending, err = ReadBoolByte(rr); err != nil {
+		return fmt.Errorf("NFTEntry.Decode: Problem reading IsPending: %v", err)
+	}
+	if nft.IsBuyNow, err = ReadBoolByte(rr); err != nil {
+		return fmt.Errorf("NFTEntry.Decode: Problem reading IsBuyNow: %v", err)
+	}
+	if nft.BuyNowPriceNanos, err = ReadUvarint(rr); err != nil {
+		return fmt.Errorf("NFTEntry.Decode: Problem reading BuyNowPriceNanos: %v", err)
+	}
+	if nft.ExtraData, err = DecodeExtraData(rr); err != nil {
+		return fmt.Errorf("NFTEntry.Decode: Problem reading ExtraData: %v", err)
+	}
+	return nil
+}
+
+// DiamondEntry is stored under both diamond prefixes.
+type DiamondEntry struct {
+	SenderPKID      *PKID
+	ReceiverPKID    *PKID
+	DiamondPostHash *BlockHash
+	DiamondLevel    int64
+}
+
+func (de *DiamondEntry) RawDecodeWithoutMetadata(version encoderVersion, rr *bytes.Reader) error {
+	var err error
+	if de.SenderPKID, err = DecodePKID(rr); err != nil {
+		return fmt.Errorf("DiamondEntry.Decode: Problem reading SenderPKID: %v", err)
+	}
+	if de.ReceiverPKID, err = DecodePKID(rr); err != nil {
+		return fmt.Errorf("DiamondEntry.Decode: Problem reading ReceiverPKID: %v", err)
+	}
+	if de.DiamondPostHash, err = DecodeBlockHash(rr); err != nil {
+		return fmt.Errorf("DiamondEntry.Decode: Problem reading DiamondPostHash: %v", err)
+	}
+	diamondLevel, err := ReadUvarint(rr)
+	if err != nil {
+		return fmt.Errorf("DiamondEntry.Decode: Problem reading DiamondLevel: %v", err)
+	}
+	de.DiamondLevel = int64(diamondLevel)
+	return nil
+}
+
+// RepostEntry is stored under PrefixReposterPubKeyRepostedPostHashToRepostPostHash.
+type RepostEntry struct {
+	ReposterPubKey   PublicKey
+	RepostPostHash   *BlockHash
+	RepostedPostHash *BlockHash
+}
+
+func (re *RepostEntry) RawDecodeWithoutMetadata(version encoderVersion, rr *bytes.Reader) error {
+	var err error
+	if re.ReposterPubKey, err = decodePublicKey(rr); err != nil {
+		return fmt.Errorf("RepostEntry.Decode: Problem reading ReposterPubKey: %v", err)
+	}
+	if re.RepostPostHash, err = DecodeBlockHash(rr); err != nil {
+		return fmt.Errorf("RepostEntry.Decode: Problem reading RepostPostHash: %v", err)
+	}
+	if re.RepostedPostHash, err = DecodeBlockHash(rr); err != nil {
+		return fmt.Errorf("RepostEntry.Decode: Problem reading RepostedPostHash: %v", err)
+	}
+	return nil
+}
+
+// DAOCoinLimitOrderEntry is stored under all three DAO coin limit order prefixes.
+type DAOCoinLimitOrderEntry struct {
+	OrderID                                   *BlockHash
+	TransactorPKID                            *PKID
+	BuyingDAOCoinCreatorPKID                  *PKID
+	SellingDAOCoinCreatorPKID                 *PKID
+	ScaledExchangeRateCoinsToSellPerCoinToBuy *big.Int
+	QuantityToFillInBaseUnits                 *big.Int
+	OperationType                             uint64
+	FillType                                  uint64
+	BlockHeight                               uint32
+}
+
+func (order *DAOCoinLimitOrderEntry) RawDecodeWithoutMetadata(version encoderVersion, rr *bytes.Reader) error {
+	var err error
+	if order.OrderID, err = DecodeBlockHash(rr); err != nil {
+		return fmt.Errorf("DAOCoinLimitOrderEntry.Decode: Problem reading OrderID: %v", err)
+	}
+	if order.TransactorPKID, err = DecodePKID(rr); err != nil {
+		return fmt.Errorf("DAOCoinLimitOrderEntry.Decode: Problem reading TransactorPKID: %v", err)
+	}
+	if order.BuyingDAOCoinCreatorPKID, err = DecodePKID(rr); err != nil {
+		return fmt.Errorf("DAOCoinLimitOrderEntry.Decode: Problem reading BuyingDAOCoinCreatorPKID: %v", err)
+	}
+	if order.SellingDAOCoinCreatorPKID, err = DecodePKID(rr); err != nil {
+		return fmt.Errorf("DAOCoinLimitOrderEntry.Decode: Problem reading SellingDAOCoinCreatorPKID: %v", err)
+	}
+	if order.ScaledExchangeRateCoinsToSellPerCoinToBuy, err = VariableDecodeUint256(rr); err != nil {
+		return fmt.Errorf("DAOCoinLimitOrderEntry.Decode: Problem reading ScaledExchangeRateCoinsToSellPerCoinToBuy: %v", err)
+	}
+	if order.QuantityToFillInBaseUnits, err = VariableDecodeUint256(rr); err != nil {
+		return fmt.Errorf("DAOCoinLimitOrderEntry.Decode: Problem reading QuantityToFillInBaseUnits: %v", err)
+	}
+	if order.OperationType, err = ReadUvarint(rr); err != nil {
+		return fmt.Errorf("DAOCoinLimitOrderEntry.Decode: Problem reading OperationType: %v", err)
+	}
+	if order.FillType, err = ReadUvarint(rr); err != nil {
+		return fmt.Errorf("DAOCoinLimitOrderEntry.Decode: Problem reading FillType: %v", err)
+	}
+	blockHeight, err := ReadUvarint(rr)
+	if err != nil {
+		return fmt.Errorf("DAOCoinLimitOrderEntry.Decode: Problem reading BlockHeight: %v", err)
+	}
+	order.BlockHeight = uint32(blockHeight)
+	return nil
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// The formats export writes.
+const (
+	exportFormatNDJSON = "ndjson"
+	// CSV and Parquet are only written for the prefixes in tableSchemas.
+	exportFormatCSV     = "csv"
+	exportFormatParquet = "parquet"
+)
+
+var exportFormats = []string{exportFormatNDJSON, exportFormatCSV, exportFormatParquet}
+
+// exportPrefix writes the entries stored under prefix to w in format and
+// returns how many it wrote.
+func exportPrefix(ctx context.Context, txn kvTxn, prefix *namedPrefix, iterOpts *iterateOptions, format string, w io.Writer) (int, error) {
+	if format == exportFormatNDJSON {
+		return exportNDJSON(ctx, txn, prefix, iterOpts, w)
+	}
+	schema := tableSchemas[prefix.Name]
+	if schema == nil {
+		return 0, fmt.Errorf("exportPrefix: %s can't be exported as %s, only %s can", prefix.Name, format, tabularPrefixNames())
+	}
+	if format == exportFormatCSV {
+		return exportCSV(ctx, txn, prefix, schema, iterOpts, w)
+	}
+	return exportParquet(ctx, txn, prefix, schema, iterOpts, w)
+}
+
+// exportNDJSON writes every entry stored under prefix to w as one JSON object
+// per line, in the shape dump -format json prints them. The raw value is left
+// out when it could be decoded. Entries are written as they are read, so the
+// memory used doesn't grow with the size of the prefix.
+func exportNDJSON(ctx context.Context, txn kvTxn, prefix *namedPrefix, iterOpts *iterateOptions, w io.Writer) (int, error) {
+	encoder := json.NewEncoder(w)
+	exported := 0
+	err := _iterateKeysForPrefixWithTxn(ctx, txn, prefix.Prefix, iterOpts, func(key []byte, val []byte) error {
+		e := newEntry(prefix, key, val)
+		if e.DecodedValue != nil {
+			e.Value = ""
+		}
+		exported++
+		return encoder.Encode(e)
+	})
+	return exported, err
+}
+
+// exportCSV writes the entries stored under prefix as CSV, with a header row
+// holding the column names of schema.
+func exportCSV(ctx context.Context, txn kvTxn, prefix *namedPrefix, schema *tableSchema, iterOpts *iterateOptions, w io.Writer) (int, error) {
+	writer := csv.NewWriter(w)
+	header := make([]string, len(schema.Columns))
+	for ii, column := range schema.Columns {
+		header[ii] = column.Name
+	}
+	if err := writer.Write(header); err != nil {
+		return 0, err
+	}
+
+	exported := 0
+	record := make([]string, len(schema.Columns))
+	err := _iterateKeysForPrefixWithTxn(ctx, txn, prefix.Prefix, iterOpts, func(key []byte, val []byte) error {
+		row, err := schema.tableRow(prefix, key, val)
+		if err != nil {
+			return fmt.Errorf("exportCSV: Problem decoding %x: %v", key, err)
+		}
+		for ii, cell := range row {
+			record[ii] = cellText(cell)
+		}
+		exported++
+		return writer.Write(record)
+	})
+	if err != nil {
+		return exported, err
+	}
+	writer.Flush()
+	return exported, writer.Error()
+}
+
+// exportParquet writes the entries stored under prefix as a Parquet file with
+// the columns of schema.
+func exportParquet(ctx context.Context, txn kvTxn, prefix *namedPrefix, schema *tableSchema, iterOpts *iterateOptions, w io.Writer) (int, error) {
+	writer, err := newParquetWriter(w, schema.Columns)
+	if err != nil {
+		return 0, err
+	}
+	exported := 0
+	err = _iterateKeysForPrefixWithTxn(ctx, txn, prefix.Prefix, iterOpts, func(key []byte, val []byte) error {
+		row, err := schema.tableRow(prefix, key, val)
+		if err != nil {
+			return fmt.Errorf("exportParquet: Problem decoding %x: %v", key, err)
+		}
+		exported++
+		return writer.Write(row)
+	})
+	if err != nil {
+		return exported, err
+	}
+	return exported, writer.Close()
+}
+
+// exportFile calls write with a buffered writer to path. It writes to a
+// temporary file next to path and only renames it once write succeeded, so
+// an interrupted export doesn't leave a truncated file behind. A path of "-"
+// writes to stdout.
+func exportFile(path string, write func(w io.Writer) error) error {
+	if path == "-" {
+		buffered := bufio.NewWriter(os.Stdout)
+		if err := write(buffered); err != nil {
+			return err
+		}
+		return buffered.Flush()
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("exportFile: Problem creating the directory of %s: %v", path, err)
+	}
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("exportFile: Problem creating %s: %v", path, err)
+	}
+	defer os.Remove(file.Name())
+	// CreateTemp makes the file readable by us only.
+	if err := file.Chmod(0644); err != nil {
+		file.Close()
+		return fmt.Errorf("exportFile: Problem creating %s: %v", path, err)
+	}
+
+	buffered := bufio.NewWriterSize(file, 1<<20)
+	err = write(buffered)
+	if err == nil {
+		err = buffered.Flush()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("exportFile: Problem writing %s: %v", path, err)
+	}
+	return os.Rename(file.Name(), path)
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+// newExportTestDB holds two [33] balance entries and a [52] DeSo balance.
+func newExportTestDB(t *testing.T) kvDB {
+	t.Helper()
+	balanceKey := func(hodler byte, creator byte) string {
+		key := append([]byte{33}, testPKID(hodler)[:]...)
+		return string(append(key, testPKID(creator)[:]...))
+	}
+	balance := func(hodler byte, creator byte, nanos int64, hasPurchased bool) []byte {
+		return new(testEncoder).header(encoderVersionDefault).pkid(testPKID(hodler)).pkid(testPKID(creator)).
+			uint256(big.NewInt(nanos)).boolByte(hasPurchased).Bytes()
+	}
+	return newTestDBWithEntries(t, map[string][]byte{
+		balanceKey(2, 1): balance(2, 1, 123456789, true),
+		balanceKey(3, 1): balance(3, 1, 5, false),
+		string(append([]byte{52}, testPublicKey(2)...)): binary.BigEndian.AppendUint64(nil, 1000),
+	})
+}
+
+func exportTestPrefix(t *testing.T, db kvDB, prefixName string, format string) (string, int, error) {
+	t.Helper()
+	prefix, err := findPrefix(prefixName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := &bytes.Buffer{}
+	var exported int
+	err = db.View(func(txn kvTxn) error {
+		var err error
+		exported, err = exportPrefix(context.Background(), txn, prefix, nil, format, buf)
+		return err
+	})
+	return buf.String(), exported, err
+}
+
+func TestExportCSV(t *testing.T) {
+	db := newExportTestDB(t)
+	tests := []struct {
+		prefix string
+		want   string
+	}{
+		{"PrefixHODLerPKIDCreatorPKIDToBalanceEntry", "" +
+			"HODLerPKID,CreatorPKID,BalanceNanos,HasPurchased\n" +
+			fmt.Sprintf("%s,%s,123456789,true\n", testPKID(2), testPKID(1)) +
+			fmt.Sprintf("%s,%s,5,false\n", testPKID(3), testPKID(1))},
+		{"PrefixPublicKeyToDeSoBalanceNanos", "" +
+			"PublicKey,BalanceNanos\n" +
+			fmt.Sprintf("%s,1000\n", PublicKey(testPublicKey(2)))},
+		// An empty prefix still gets its header.
+		{"PrefixPostHashToPostEntry", strings.Join(columnNames(tableSchemas["PrefixPostHashToPostEntry"]), ",") + "\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.prefix, func(t *testing.T) {
+			got, _, err := exportTestPrefix(t, db, test.prefix, exportFormatCSV)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.want {
+				t.Errorf("got\n%s\nwant\n%s", got, test.want)
+			}
+		})
+	}
+
+	if _, _, err := exportTestPrefix(t, db, "PrefixUtxoKeyToUtxoEntry", exportFormatCSV); err == nil ||
+		!strings.Contains(err.Error(), "can't be exported as csv") {
+		t.Errorf("got error %v exporting a prefix with no table schema, want one saying it can't be exported", err)
+	}
+}
+
+func columnNames(schema *tableSchema) []string {
+	var names []string
+	for _, column := range schema.Columns {
+		names = append(names, column.Name)
+	}
+	return names
+}
+
+// TestTableSchemaColumns checks that nested entries are flattened with an
+// underscore, and that key value prefixes start with the key fields.
+func TestTableSchemaColumns(t *testing.T) {
+	profile := strings.Join(columnNames(tableSchemas["PrefixPKIDToProfileEntry"]), ",")
+	want := "PublicKey,Username,Description,ProfilePic,IsHidden," +
+		"CreatorCoinEntry_CreatorBasisPoints,CreatorCoinEntry_DeSoLockedNanos,CreatorCoinEntry_NumberOfHolders,"
+	if !strings.HasPrefix(profile, want) || !strings.HasSuffix(profile, ",ExtraData") {
+		t.Errorf("got profile columns %s, want them to start with %s and end with ExtraData", profile, want)
+	}
+	balances := tableSchemas["PrefixPublicKeyToDeSoBalanceNanos"]
+	if got := strings.Join(columnNames(balances), ","); got != "PublicKey,BalanceNanos" || !balances.fromKey {
+		t.Errorf("got DeSo balance columns %s, want PublicKey,BalanceNanos read from the key", got)
+	}
+}
+
+func TestExportNDJSON(t *testing.T) {
+	got, exported, err := exportTestPrefix(t, newExportTestDB(t), "PrefixHODLerPKIDCreatorPKIDToBalanceEntry", exportFormatNDJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(got, "\n"), "\n")
+	if exported != 2 || len(lines) != 2 {
+		t.Fatalf("exported %d entries in %d lines, want 2", exported, len(lines))
+	}
+	var first map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil {
+		t.Fatal(err)
+	}
+	decoded, _ := first["decodedValue"].(map[string]interface{})
+	if first["prefix"] != "PrefixHODLerPKIDCreatorPKIDToBalanceEntry" || decoded["HODLerPKID"] != testPKID(2).String() {
+		t.Errorf("got %s, want the balance entry of %s", lines[0], testPKID(2))
+	}
+	// The raw value is left out once it is decoded.
+	if _, exists := first["value"]; exists {
+		t.Errorf("got %s, want no raw value", lines[0])
+	}
+}
+
+func TestExportParquet(t *testing.T) {
+	got, exported, err := exportTestPrefix(t, newExportTestDB(t), "PrefixHODLerPKIDCreatorPKIDToBalanceEntry", exportFormatParquet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	columns := tableSchemas["PrefixHODLerPKIDCreatorPKIDToBalanceEntry"].Columns
+	file := readParquetFile(t, []byte(got), columns)
+	if exported != 2 || file.meta[3] != int64(2) {
+		t.Fatalf("exported %d entries into %v rows, want 2", exported, file.meta[3])
+	}
+	want := [][]interface{}{
+		{testPKID(2).String(), testPKID(3).String()},
+		{testPKID(1).String(), testPKID(1).String()},
+		{"123456789", "5"},
+		{true, false},
+	}
+	for ii, column := range columns {
+		for jj := range want[ii] {
+			if file.columns[ii][jj] != want[ii][jj] {
+				t.Errorf("row %d of %s is %v, want %v", jj, column.Name, file.columns[ii][jj], want[ii][jj])
+			}
+		}
+	}
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// envFilters is read by forward when -filters isn't given.
+const envFilters = "WEBHOOK_FILTERS"
+
+const (
+	filterActionForward = "forward"
+	filterActionDrop    = "drop"
+)
+
+// txnFilter decides which mempool txns are posted to the webhook. It is read
+// from a YAML file, or a JSON one since YAML is a superset of JSON:
+//
+//	default: drop
+//	rules:
+//	  - name: big buys of alice
+//	    txnTypes: [CREATOR_COIN]
+//	    operationTypes: [buy]
+//	    profilePublicKeys: [BC1YL...]
+//	    minDeSoNanos: 1000000000
+//
+// Rules are tried in order and the first one that matches decides. Txns that
+// no rule matches get the default action, which is drop.
+type txnFilter struct {
+	Default string           `yaml:"default"`
+	Rules   []*txnFilterRule `yaml:"rules"`
+}
+
+// txnFilterRule matches a txn when every condition that is set holds. Lists
+// match if any of their items does.
+type txnFilterRule struct {
+	Name string `yaml:"name"`
+	// Action is forward, the default, or drop.
+	Action string `yaml:"action"`
+
+	// TxnTypes are names such as BASIC_TRANSFER or DAO_COIN_LIMIT_ORDER.
+	TxnTypes []string `yaml:"txnTypes"`
+	// OperationTypes are compared without case to the operation of the
+	// payload: buy, sell or add for creator coins, mint, burn, etc. for DAO
+	// coins, ASK or BID for limit orders, follow or unfollow and like or
+	// unlike.
+	OperationTypes []string `yaml:"operationTypes"`
+	// ProfilePublicKeys match the creator whose coin or profile the txn is
+	// about, either side of a limit order.
+	ProfilePublicKeys []string `yaml:"profilePublicKeys"`
+	// AffectedPublicKeys match any of the txn's affectedPublicKeys.
+	AffectedPublicKeys []string `yaml:"affectedPublicKeys"`
+
+	// The DeSo of a txn is what a creator coin buy spends or a sell is
+	// estimated to return, the DeSo added to a coin, what a basic transfer
+	// sends to others, or the amount of an NFT bid. Its creator coins are
+	// the coins sold or transferred, or the DAO coins minted, burned,
+	// transferred or ordered. Thresholds are inclusive.
+	MinDeSoNanos        *uint64 `yaml:"minDeSoNanos"`
+	MaxDeSoNanos        *uint64 `yaml:"maxDeSoNanos"`
+	MinCreatorCoinNanos *uint64 `yaml:"minCreatorCoinNanos"`
+	MaxCreatorCoinNanos *uint64 `yaml:"maxCreatorCoinNanos"`
+
+	txnTypes map[TxnType]bool
+}
+
+// loadTxnFilter reads the filter at path. An empty path returns a nil filter,
+// which forwards everything.
+func loadTxnFilter(path string) (*txnFilter, error) {
+	if path == "" {
+		return nil, nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("loadTxnFilter: Problem reading filter file: %v", err)
+	}
+	defer file.Close()
+
+	filter := &txnFilter{}
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(filter); err != nil {
+		return nil, fmt.Errorf("loadTxnFilter: Problem parsing filter file %s: %v", path, err)
+	}
+	if err := filter.validate(); err != nil {
+		return nil, fmt.Errorf("loadTxnFilter: %s: %v", path, err)
+	}
+	return filter, nil
+}
+
+// validate checks the rules and fills in the defaults.
+func (filter *txnFilter) validate() error {
+	if filter.Default == "" {
+		filter.Default = filterActionDrop
+	}
+	if filter.Default != filterActionForward && filter.Default != filterActionDrop {
+		return fmt.Errorf("default must be %s or %s, got %q", filterActionForward, filterActionDrop, filter.Default)
+	}
+
+	txnTypesByName := make(map[string]TxnType, len(txnTypeNames))
+	for txnType, name := range txnTypeNames {
+		txnTypesByName[name] = txnType
+	}
+	for ii, rule := range filter.Rules {
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("rule %d", ii+1)
+		}
+		if rule.Action == "" {
+			rule.Action = filterActionForward
+		}
+		if rule.Action != filterActionForward && rule.Action != filterActionDrop {
+			return fmt.Errorf("%s: action must be %s or %s, got %q", rule.Name, filterActionForward, filterActionDrop, rule.Action)
+		}
+		rule.txnTypes = make(map[TxnType]bool)
+		for _, name := range rule.TxnTypes {
+			txnType, exists := txnTypesByName[strings.ToUpper(name)]
+			if !exists {
+				return fmt.Errorf("%s: unknown txn type %q", rule.Name, name)
+			}
+			rule.txnTypes[txnType] = true
+		}
+		// Keys are compared the way they are printed, so hex and other
+		// network keys are converted to that.
+		for _, publicKeys := range [][]string{rule.ProfilePublicKeys, rule.AffectedPublicKeys} {
+			for jj, publicKey := range publicKeys {
+				decoded, err := parsePublicKey(publicKey)
+				if err != nil {
+					return fmt.Errorf("%s: invalid public key %q: %v", rule.Name, publicKey, err)
+				}
+				publicKeys[jj] = PkToString(decoded)
+			}
+		}
+		if rule.MinDeSoNanos != nil && rule.MaxDeSoNanos != nil && *rule.MinDeSoNanos > *rule.MaxDeSoNanos {
+			return fmt.Errorf("%s: minDeSoNanos is above maxDeSoNanos", rule.Name)
+		}
+		if rule.MinCreatorCoinNanos != nil && rule.MaxCreatorCoinNanos != nil && *rule.MinCreatorCoinNanos > *rule.MaxCreatorCoinNanos {
+			return fmt.Errorf("%s: minCreatorCoinNanos is above maxCreatorCoinNanos", rule.Name)
+		}
+	}
+	return nil
+}
+
+// Allow reports whether txn should be posted. A nil filter allows everything.
+func (filter *txnFilter) Allow(txn *MsgDeSoTxn, txnData *TransactionData) bool {
+	if filter == nil {
+		return true
+	}
+	fields := newTxnFilterFields(txn, txnData)
+	for _, rule := range filter.Rules {
+		if rule.matches(fields) {
+			return rule.Action == filterActionForward
+		}
+	}
+	return filter.Default == filterActionForward
+}
+
+func (rule *txnFilterRule) matches(fields *txnFilterFields) bool {
+	if len(rule.txnTypes) > 0 && !rule.txnTypes[fields.txnType] {
+		return false
+	}
+	if len(rule.OperationTypes) > 0 && !containsFold(rule.OperationTypes, fields.operationType) {
+		return false
+	}
+	if len(rule.ProfilePublicKeys) > 0 && !containsAny(rule.ProfilePublicKeys, fields.profilePublicKeys) {
+		return false
+	}
+	if len(rule.AffectedPublicKeys) > 0 && !containsAny(rule.AffectedPublicKeys, fields.affectedPublicKeys) {
+		return false
+	}
+	return inRange(fields.desoNanos, rule.MinDeSoNanos, rule.MaxDeSoNanos) &&
+		inRange(fields.creatorCoinNanos, rule.MinCreatorCoinNanos, rule.MaxCreatorCoinNanos)
+}
+
+// txnFilterFields are the values of a txn that rules match on.
+type txnFilterFields struct {
+	txnType            TxnType
+	operationType      string
+	profilePublicKeys  []string
+	affectedPublicKeys []string
+	desoNanos          uint64
+	creatorCoinNanos   uint64
+}
+
+func newTxnFilterFields(txn *MsgDeSoTxn, txnData *TransactionData) *txnFilterFields {
+	fields := &txnFilterFields{txnType: txn.TxnType}
+	for _, node := range txnData.AffectedPublicKeys.Nodes {
+		fields.affectedPublicKeys = append(fields.affectedPublicKeys, node.PublicKey)
+	}
+
+	switch payload := txnData.Payload.(type) {
+	case *BasicTransferPayload:
+		// Change going back to the transactor isn't sent anywhere.
+		transactor := PkToString(txn.PublicKey)
+		for _, output := range payload.Outputs {
+			if output.PublicKey != transactor {
+				fields.desoNanos += output.AmountNanos
+			}
+		}
+	case *FollowPayload:
+		fields.operationType = "follow"
+		if payload.IsUnfollow {
+			fields.operationType = "unfollow"
+		}
+	case *LikePayload:
+		fields.operationType = "like"
+		if payload.IsUnlike {
+			fields.operationType = "unlike"
+		}
+	case *UpdateProfilePayload:
+		fields.profilePublicKeys = []string{payload.ProfilePublicKey}
+	case *CreatorCoinPayload:
+		fields.operationType = payload.OperationType
+		fields.profilePublicKeys = []string{payload.ProfilePublicKey}
+		switch payload.OperationType {
+		case CreatorCoinOperationTypeBuy.String():
+			fields.desoNanos = payload.DeSoToSellNanos
+		case CreatorCoinOperationTypeSell.String():
+			fields.creatorCoinNanos = payload.CreatorCoinToSellNanos
+			if diff := txnData.TxIndexMetadata.DESOLockedNanosDiff; diff < 0 {
+				fields.desoNanos = uint64(-diff)
+			}
+		case CreatorCoinOperationTypeAddDeSo.String():
+			fields.desoNanos = payload.DeSoToAddNanos
+		}
+	case *CreatorCoinTransferPayload:
+		fields.profilePublicKeys = []string{payload.ProfilePublicKey}
+		fields.creatorCoinNanos = payload.CreatorCoinToTransferNanos
+	case *NFTBidPayload:
+		fields.desoNanos = payload.BidAmountNanos
+	case *AcceptNFTBidPayload:
+		fields.desoNanos = payload.BidAmountNanos
+	case *DAOCoinPayload:
+		fields.operationType = payload.OperationType
+		fields.profilePublicKeys = []string{payload.ProfilePublicKey}
+		fields.creatorCoinNanos = decimalToUint64(payload.CoinsToMintNanos) + decimalToUint64(payload.CoinsToBurnNanos)
+	case *DAOCoinTransferPayload:
+		fields.profilePublicKeys = []string{payload.ProfilePublicKey}
+		fields.creatorCoinNanos = decimalToUint64(payload.DAOCoinToTransferNanos)
+	case *DAOCoinLimitOrderPayload:
+		fields.operationType = payload.OperationType
+		fields.profilePublicKeys = []string{payload.BuyingDAOCoinCreatorPublicKey, payload.SellingDAOCoinCreatorPublicKey}
+		fields.creatorCoinNanos = decimalToUint64(payload.QuantityToFillInBaseUnits)
+	}
+	return fields
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAny(values []string, candidates []string) bool {
+	for _, candidate := range candidates {
+		for _, v := range values {
+			if candidate != "" && v == candidate {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func inRange(value uint64, min *uint64, max *uint64) bool {
+	return (min == nil || value >= *min) && (max == nil || value <= *max)
+}
+
+// decimalToUint64 parses the decimal uint256 strings of the DAO coin
+// payloads, capping them at the max uint64.
+func decimalToUint64(value string) uint64 {
+	number, ok := new(big.Int).SetString(value, 10)
+	if !ok {
+		return 0
+	}
+	return uint64OrMax(number)
+}
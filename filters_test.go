@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func loadTestTxnFilter(t *testing.T, name string, config string) (*txnFilter, error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return loadTxnFilter(path)
+}
+
+// filterTestTxn is a mempool txn sent by testPublicKey(9), with the payload
+// forward would build for it.
+func filterTestTxn(txnType TxnType, payload TxnPayload, affected ...byte) (*MsgDeSoTxn, *TransactionData) {
+	txn := &MsgDeSoTxn{TxnType: txnType, PublicKey: testPublicKey(9)}
+	txnData := &TransactionData{TxnType: txnType, Payload: payload}
+	for _, id := range append([]byte{9}, affected...) {
+		txnData.AffectedPublicKeys.Nodes = append(txnData.AffectedPublicKeys.Nodes,
+			AffectedPublicKey{PublicKey: PkToString(testPublicKey(id))})
+	}
+	return txn, txnData
+}
+
+func creatorCoinTestTxn(creator byte, operation CreatorCoinOperationType, nanos uint64) (*MsgDeSoTxn, *TransactionData) {
+	payload := &CreatorCoinPayload{ProfilePublicKey: PkToString(testPublicKey(creator)), OperationType: operation.String()}
+	switch operation {
+	case CreatorCoinOperationTypeBuy:
+		payload.DeSoToSellNanos = nanos
+	case CreatorCoinOperationTypeSell:
+		payload.CreatorCoinToSellNanos = nanos
+	}
+	txn, txnData := filterTestTxn(TxnTypeCreatorCoin, payload, creator)
+	if operation == CreatorCoinOperationTypeSell {
+		// Selling returns about half the coins' worth in DeSo.
+		txnData.TxIndexMetadata.DESOLockedNanosDiff = -int64(nanos / 2)
+	}
+	return txn, txnData
+}
+
+func buy100() (*MsgDeSoTxn, *TransactionData) {
+	return creatorCoinTestTxn(1, CreatorCoinOperationTypeBuy, 100)
+}
+
+func TestTxnFilterAllow(t *testing.T) {
+	alice, bob := PkToString(testPublicKey(1)), PkToString(testPublicKey(2))
+	buy := func(creator byte, nanos uint64) func() (*MsgDeSoTxn, *TransactionData) {
+		return func() (*MsgDeSoTxn, *TransactionData) {
+			return creatorCoinTestTxn(creator, CreatorCoinOperationTypeBuy, nanos)
+		}
+	}
+	sell := func(creator byte, nanos uint64) func() (*MsgDeSoTxn, *TransactionData) {
+		return func() (*MsgDeSoTxn, *TransactionData) {
+			return creatorCoinTestTxn(creator, CreatorCoinOperationTypeSell, nanos)
+		}
+	}
+	transfer := func(to byte, nanos uint64, change uint64) func() (*MsgDeSoTxn, *TransactionData) {
+		return func() (*MsgDeSoTxn, *TransactionData) {
+			return filterTestTxn(TxnTypeBasicTransfer, &BasicTransferPayload{Outputs: []*OutputPayload{
+				{PublicKey: PkToString(testPublicKey(to)), AmountNanos: nanos},
+				{PublicKey: PkToString(testPublicKey(9)), AmountNanos: change},
+			}}, to)
+		}
+	}
+	follow := func(unfollow bool) func() (*MsgDeSoTxn, *TransactionData) {
+		return func() (*MsgDeSoTxn, *TransactionData) {
+			return filterTestTxn(TxnTypeFollow, &FollowPayload{FollowedPublicKey: alice, IsUnfollow: unfollow}, 1)
+		}
+	}
+	limitOrder := func(buying string, selling string, quantity string) func() (*MsgDeSoTxn, *TransactionData) {
+		return func() (*MsgDeSoTxn, *TransactionData) {
+			return filterTestTxn(TxnTypeDAOCoinLimitOrder, &DAOCoinLimitOrderPayload{
+				BuyingDAOCoinCreatorPublicKey:  buying,
+				SellingDAOCoinCreatorPublicKey: selling,
+				QuantityToFillInBaseUnits:      quantity,
+				OperationType:                  "BID",
+			})
+		}
+	}
+
+	tests := []struct {
+		name   string
+		config string
+		txn    func() (*MsgDeSoTxn, *TransactionData)
+		want   bool
+	}{
+		{"no rules drop by default", "rules: []", buy(1, 100), false},
+		{"no rules forward by default", "default: forward", buy(1, 100), true},
+		{"txn type", "rules: [{txnTypes: [creator_coin]}]", buy(1, 100), true},
+		{"other txn type", "rules: [{txnTypes: [CREATOR_COIN]}]", follow(false), false},
+		{"operation type ignores case", "rules: [{operationTypes: [BUY]}]", buy(1, 100), true},
+		{"other operation type", "rules: [{operationTypes: [buy]}]", sell(1, 100), false},
+		{"unfollow", "rules: [{operationTypes: [unfollow]}]", follow(true), true},
+		{"profile", "rules: [{profilePublicKeys: [" + alice + "]}]", buy(1, 100), true},
+		{"other profile", "rules: [{profilePublicKeys: [" + alice + "]}]", buy(2, 100), false},
+		{"profile given as hex", "rules: [{profilePublicKeys: [" + hex.EncodeToString(testPublicKey(2)) + "]}]", buy(2, 100), true},
+		{"either side of a limit order", "rules: [{profilePublicKeys: [" + bob + "]}]", limitOrder(alice, bob, "5"), true},
+		{"DeSo side of a limit order", "rules: [{profilePublicKeys: [" + bob + "]}]", limitOrder(alice, "", "5"), false},
+		{"affected public key", "rules: [{affectedPublicKeys: [" + alice + "]}]", follow(false), true},
+		{"other affected public key", "rules: [{affectedPublicKeys: [" + bob + "]}]", follow(false), false},
+		{"min DeSo is inclusive", "rules: [{minDeSoNanos: 100}]", buy(1, 100), true},
+		{"below min DeSo", "rules: [{minDeSoNanos: 101}]", buy(1, 100), false},
+		{"max DeSo is inclusive", "rules: [{maxDeSoNanos: 100}]", buy(1, 100), true},
+		{"above max DeSo", "rules: [{maxDeSoNanos: 99}]", buy(1, 100), false},
+		{"sell DeSo is the estimated return", "rules: [{minDeSoNanos: 50, maxDeSoNanos: 50}]", sell(1, 100), true},
+		{"transfer DeSo leaves out the change", "rules: [{maxDeSoNanos: 100}]", transfer(1, 100, 5000), true},
+		{"creator coins of a sell", "rules: [{minCreatorCoinNanos: 100}]", sell(1, 100), true},
+		{"below min creator coins", "rules: [{minCreatorCoinNanos: 101}]", sell(1, 100), false},
+		{"limit order quantity", "rules: [{maxCreatorCoinNanos: 4}]", limitOrder(alice, bob, "5"), false},
+		{"first match wins", "" +
+			"default: forward\n" +
+			"rules:\n" +
+			"  - {action: drop, txnTypes: [CREATOR_COIN], maxDeSoNanos: 1000}\n" +
+			"  - {txnTypes: [CREATOR_COIN]}\n",
+			buy(1, 100), false},
+		{"later rule matches", "" +
+			"rules:\n" +
+			"  - {action: drop, txnTypes: [CREATOR_COIN], maxDeSoNanos: 10}\n" +
+			"  - {txnTypes: [CREATOR_COIN]}\n",
+			buy(1, 100), true},
+		{"all conditions must hold", "rules: [{txnTypes: [CREATOR_COIN], operationTypes: [sell]}]", buy(1, 100), false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			filter, err := loadTestTxnFilter(t, "filters.yaml", test.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := filter.Allow(test.txn()); got != test.want {
+				t.Errorf("Allow returned %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestLoadTxnFilter(t *testing.T) {
+	filter, err := loadTestTxnFilter(t, "filters.json",
+		`{"default": "forward", "rules": [{"name": "no follows", "action": "drop", "txnTypes": ["FOLLOW"]}]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filter.Allow(filterTestTxn(TxnTypeFollow, &FollowPayload{})) || !filter.Allow(buy100()) {
+		t.Error("the JSON filter doesn't drop follows and forward the rest")
+	}
+	if filter.Rules[0].Action != filterActionDrop || filter.Rules[0].Name != "no follows" {
+		t.Errorf("got rule %+v", filter.Rules[0])
+	}
+
+	filter, err = loadTestTxnFilter(t, "filters.yaml", "rules: [{txnTypes: [FOLLOW]}]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filter.Default != filterActionDrop || filter.Rules[0].Action != filterActionForward || filter.Rules[0].Name != "rule 1" {
+		t.Errorf("got default %q and rule %+v, want drop and a forward rule named rule 1", filter.Default, filter.Rules[0])
+	}
+
+	// Without a filter everything is forwarded.
+	if filter, err := loadTxnFilter(""); err != nil || filter != nil || !filter.Allow(buy100()) {
+		t.Errorf("got filter %v and error %v for no path, want a nil filter that allows everything", filter, err)
+	}
+}
+
+func TestLoadTxnFilterErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		wantErr string
+	}{
+		{"malformed YAML", "rules: [", "Problem parsing filter file"},
+		{"unknown field", "rules: [{txnType: [FOLLOW]}]", "field txnType not found"},
+		{"default", "default: allow", `default must be forward or drop, got "allow"`},
+		{"action", "rules: [{name: r, action: allow}]", `r: action must be forward or drop, got "allow"`},
+		{"txn type", "rules: [{txnTypes: [FOLOW]}]", `rule 1: unknown txn type "FOLOW"`},
+		{"public key", "rules: [{profilePublicKeys: [BC1YLnope]}]", `rule 1: invalid public key "BC1YLnope"`},
+		{"DeSo range", "rules: [{minDeSoNanos: 2, maxDeSoNanos: 1}]", "minDeSoNanos is above maxDeSoNanos"},
+		{"creator coin range", "rules: [{minCreatorCoinNanos: 2, maxCreatorCoinNanos: 1}]", "minCreatorCoinNanos is above maxCreatorCoinNanos"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := loadTestTxnFilter(t, "filters.yaml", test.config)
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("got error %v, want one containing %q", err, test.wantErr)
+			}
+		})
+	}
+	if _, err := loadTxnFilter(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("loading a missing file succeeded")
+	}
+}
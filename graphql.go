@@ -0,0 +1,524 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"reflect"
+	"strconv"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// The GraphQL schema served at /graphql. It follows the shape of the indexer
+// the trade bot was written against: lists are connections whose items are
+// under nodes, and transactions carry txnMeta, txIndexMetadata and
+// affectedPublicKeys.nodes like TransactionData does. Object fields resolve
+// to the fields of the decoded entries of the same name, so the schema only
+// names them.
+
+// bigIntScalar holds amounts as decimal strings, since nanos and uint256
+// amounts don't fit GraphQL's 32-bit Int.
+var bigIntScalar = graphql.NewScalar(graphql.ScalarConfig{
+	Name:        "BigInt",
+	Description: "An unsigned integer of up to 256 bits, as a decimal string.",
+	Serialize: func(value interface{}) interface{} {
+		switch v := value.(type) {
+		case uint64:
+			return strconv.FormatUint(v, 10)
+		case uint32:
+			return strconv.FormatUint(uint64(v), 10)
+		case int64:
+			return strconv.FormatInt(v, 10)
+		case *big.Int:
+			if v == nil {
+				return nil
+			}
+			return v.String()
+		}
+		return nil
+	},
+	ParseValue: func(value interface{}) interface{} {
+		if v, ok := value.(string); ok {
+			return v
+		}
+		return nil
+	},
+	ParseLiteral: func(valueAST ast.Value) interface{} {
+		switch v := valueAST.(type) {
+		case *ast.StringValue:
+			return v.Value
+		case *ast.IntValue:
+			return v.Value
+		}
+		return nil
+	},
+})
+
+// jsonScalar passes decoded values through as they are marshaled elsewhere,
+// for payloads and extra data whose shape depends on the txn type.
+var jsonScalar = graphql.NewScalar(graphql.ScalarConfig{
+	Name:        "JSON",
+	Description: "Any JSON value.",
+	Serialize: func(value interface{}) interface{} {
+		return value
+	},
+	ParseValue: func(value interface{}) interface{} {
+		return value
+	},
+	ParseLiteral: func(valueAST ast.Value) interface{} {
+		return nil
+	},
+})
+
+// stringerField resolves a field holding a key, hash or id to the way it is
+// printed everywhere else, and to null when it is unset.
+var stringerField = &graphql.Field{
+	Type: graphql.String,
+	Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+		value, err := graphql.DefaultResolveFn(p)
+		if err != nil || value == nil {
+			return nil, err
+		}
+		if v := reflect.ValueOf(value); (v.Kind() == reflect.Pointer || v.Kind() == reflect.Slice) && v.IsNil() {
+			return nil, nil
+		}
+		switch v := value.(type) {
+		case fmt.Stringer:
+			return v.String(), nil
+		case HexBytes:
+			return hex.EncodeToString(v), nil
+		}
+		return value, nil
+	},
+}
+
+func scalarField(fieldType graphql.Output) *graphql.Field {
+	return &graphql.Field{Type: fieldType}
+}
+
+var pageInfoType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "PageInfo",
+	Fields: graphql.Fields{
+		"hasNextPage": scalarField(graphql.NewNonNull(graphql.Boolean)),
+		// endCursor is passed as after to get the next page.
+		"endCursor": scalarField(graphql.String),
+	},
+})
+
+// graphQLConnection is a page of nodes.
+type graphQLConnection struct {
+	Nodes    []interface{}    `json:"nodes"`
+	PageInfo *graphQLPageInfo `json:"pageInfo"`
+}
+
+type graphQLPageInfo struct {
+	HasNextPage bool    `json:"hasNextPage"`
+	EndCursor   *string `json:"endCursor"`
+}
+
+func connectionType(node *graphql.Object) *graphql.Object {
+	return graphql.NewObject(graphql.ObjectConfig{
+		Name: node.Name() + "Connection",
+		Fields: graphql.Fields{
+			"nodes":    scalarField(graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(node)))),
+			"pageInfo": scalarField(graphql.NewNonNull(pageInfoType)),
+		},
+	})
+}
+
+var connectionArgs = graphql.FieldConfigArgument{
+	"first": &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: apiDefaultPageSize},
+	"after": &graphql.ArgumentConfig{Type: graphql.String},
+}
+
+func withConnectionArgs(args graphql.FieldConfigArgument) graphql.FieldConfigArgument {
+	for name, arg := range connectionArgs {
+		args[name] = arg
+	}
+	return args
+}
+
+var coinEntryType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "CoinEntry",
+	Fields: graphql.Fields{
+		"creatorBasisPoints":        scalarField(graphql.Int),
+		"deSoLockedNanos":           scalarField(bigIntScalar),
+		"numberOfHolders":           scalarField(bigIntScalar),
+		"coinsInCirculationNanos":   scalarField(bigIntScalar),
+		"coinWatermarkNanos":        scalarField(bigIntScalar),
+		"mintingDisabled":           scalarField(graphql.Boolean),
+		"transferRestrictionStatus": scalarField(graphql.Int),
+	},
+})
+
+var profileType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Profile",
+	Fields: graphql.Fields{
+		"pkid":             stringerField,
+		"publicKey":        stringerField,
+		"username":         scalarField(graphql.String),
+		"description":      scalarField(graphql.String),
+		"profilePic":       scalarField(graphql.String),
+		"isHidden":         scalarField(graphql.Boolean),
+		"creatorCoinEntry": scalarField(coinEntryType),
+		"daoCoinEntry":     scalarField(coinEntryType),
+		"extraData":        scalarField(jsonScalar),
+	},
+})
+
+var balanceType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Balance",
+	Fields: graphql.Fields{
+		"hodlerPKID":   stringerField,
+		"creatorPKID":  stringerField,
+		"balanceNanos": scalarField(bigIntScalar),
+		"hasPurchased": scalarField(graphql.Boolean),
+	},
+})
+
+var postType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Post",
+	Fields: graphql.Fields{
+		"postHash":                stringerField,
+		"posterPublicKey":         stringerField,
+		"parentStakeID":           stringerField,
+		"body":                    scalarField(graphql.String),
+		"repostedPostHash":        stringerField,
+		"isQuotedRepost":          scalarField(graphql.Boolean),
+		"confirmationBlockHeight": scalarField(graphql.Int),
+		"timestampNanos":          scalarField(bigIntScalar),
+		"isHidden":                scalarField(graphql.Boolean),
+		"likeCount":               scalarField(bigIntScalar),
+		"repostCount":             scalarField(bigIntScalar),
+		"quoteRepostCount":        scalarField(bigIntScalar),
+		"diamondCount":            scalarField(bigIntScalar),
+		"commentCount":            scalarField(bigIntScalar),
+		"isPinned":                scalarField(graphql.Boolean),
+		"isNFT":                   scalarField(graphql.Boolean),
+		"numNFTCopies":            scalarField(bigIntScalar),
+		"postExtraData":           scalarField(jsonScalar),
+	},
+})
+
+var affectedPublicKeyType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "AffectedPublicKey",
+	Fields: graphql.Fields{
+		"publicKey": scalarField(graphql.NewNonNull(graphql.String)),
+	},
+})
+
+var transactionType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Transaction",
+	Fields: graphql.Fields{
+		"transactionId": scalarField(graphql.NewNonNull(graphql.String)),
+		"txnType":       scalarField(graphql.NewNonNull(graphql.String)),
+		// txnMeta and txIndexMetadata are only set for creator coin txns,
+		// as in TransactionData.
+		"txnMeta": {
+			Type: jsonScalar,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				if txnData := p.Source.(*TransactionData); txnData.TxnType == TxnTypeCreatorCoin {
+					return txnData.TxnMeta, nil
+				}
+				return nil, nil
+			},
+		},
+		"txIndexMetadata": {
+			Type: jsonScalar,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				if txnData := p.Source.(*TransactionData); txnData.TxnType == TxnTypeCreatorCoin {
+					return txnData.TxIndexMetadata, nil
+				}
+				return nil, nil
+			},
+		},
+		"affectedPublicKeys": {
+			Type: graphql.NewNonNull(graphql.NewObject(graphql.ObjectConfig{
+				Name: "AffectedPublicKeyConnection",
+				Fields: graphql.Fields{
+					"nodes": scalarField(graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(affectedPublicKeyType)))),
+				},
+			})),
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				nodes := []AffectedPublicKey{}
+				nodes = append(nodes, p.Source.(*TransactionData).AffectedPublicKeys.Nodes...)
+				return map[string]interface{}{"nodes": nodes}, nil
+			},
+		},
+		"payload":      scalarField(jsonScalar),
+		"payloadError": scalarField(graphql.String),
+	},
+})
+
+// graphQLResolver resolves the queries against the DB.
+type graphQLResolver struct {
+	db *nodeDB
+}
+
+// newGraphQLSchema builds the schema, resolving against db:
+//
+//	transactions(first, after)                         the mempool
+//	profiles(first, after), profile(username | pkid)
+//	balances(creatorPKID | hodlerPKID, daoCoin, first, after)
+//	posts(first, after)
+func newGraphQLSchema(db *nodeDB) (graphql.Schema, error) {
+	resolver := &graphQLResolver{db: db}
+	return graphql.NewSchema(graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{
+			Name: "Query",
+			Fields: graphql.Fields{
+				"transactions": {
+					Type:    graphql.NewNonNull(connectionType(transactionType)),
+					Args:    withConnectionArgs(graphql.FieldConfigArgument{}),
+					Resolve: resolver.transactions,
+				},
+				"profiles": {
+					Type:    graphql.NewNonNull(connectionType(profileType)),
+					Args:    withConnectionArgs(graphql.FieldConfigArgument{}),
+					Resolve: resolver.profiles,
+				},
+				"profile": {
+					Type: profileType,
+					Args: graphql.FieldConfigArgument{
+						"username": &graphql.ArgumentConfig{Type: graphql.String},
+						"pkid":     &graphql.ArgumentConfig{Type: graphql.String},
+					},
+					Resolve: resolver.profile,
+				},
+				"balances": {
+					Type: graphql.NewNonNull(connectionType(balanceType)),
+					Args: withConnectionArgs(graphql.FieldConfigArgument{
+						"creatorPKID": &graphql.ArgumentConfig{Type: graphql.String},
+						"hodlerPKID":  &graphql.ArgumentConfig{Type: graphql.String},
+						"daoCoin":     &graphql.ArgumentConfig{Type: graphql.Boolean, DefaultValue: false},
+					}),
+					Resolve: resolver.balances,
+				},
+				"posts": {
+					Type:    graphql.NewNonNull(connectionType(postType)),
+					Args:    withConnectionArgs(graphql.FieldConfigArgument{}),
+					Resolve: resolver.posts,
+				},
+			},
+		}),
+	})
+}
+
+// connection reads a page of the entries stored under dbPrefix, turning each
+// into a node with fn, according to the first and after arguments of p.
+func (r *graphQLResolver) connection(p graphql.ResolveParams, dbPrefix []byte, fn func(txn kvTxn, key []byte, val []byte) (interface{}, error)) (*graphQLConnection, error) {
+	first, _ := p.Args["first"].(int)
+	if first <= 0 || first > apiMaxPageSize {
+		return nil, fmt.Errorf("first must be between 1 and %d", apiMaxPageSize)
+	}
+	iterOpts := &iterateOptions{}
+	if after, ok := p.Args["after"].(string); ok && after != "" {
+		cursor, err := hex.DecodeString(after)
+		if err != nil {
+			return nil, fmt.Errorf("after must be a cursor returned as endCursor: %v", err)
+		}
+		afterCursor(iterOpts, cursor)
+	}
+
+	connection := &graphQLConnection{Nodes: []interface{}{}, PageInfo: &graphQLPageInfo{}}
+	err := r.db.View(func(txn kvTxn) error {
+		var lastKey []byte
+		nextCursor, err := readPage(p.Context, txn, dbPrefix, iterOpts, first, func(key []byte, val []byte) error {
+			node, err := fn(txn, key, val)
+			if err != nil {
+				return err
+			}
+			if node != nil {
+				connection.Nodes = append(connection.Nodes, node)
+			}
+			lastKey = append(lastKey[:0], key...)
+			return nil
+		})
+		connection.PageInfo.HasNextPage = nextCursor != nil
+		if lastKey != nil {
+			endCursor := hex.EncodeToString(lastKey)
+			connection.PageInfo.EndCursor = &endCursor
+		}
+		return err
+	})
+	return connection, err
+}
+
+func (r *graphQLResolver) transactions(p graphql.ResolveParams) (interface{}, error) {
+	return r.connection(p, GetPrefixes().PrefixMempoolTxnHashToMsgDeSoTxn, func(txn kvTxn, key []byte, val []byte) (interface{}, error) {
+		txnHash, err := mempoolTxnHashFromKey(key)
+		if err != nil {
+			return nil, err
+		}
+		msg := &MsgDeSoTxn{}
+		if err := msg.FromBytes(val); err != nil {
+			return nil, fmt.Errorf("transactions: Problem decoding txn %v: %v", txnHash, err)
+		}
+		return newTransactionData(txn, txnHash, msg)
+	})
+}
+
+func (r *graphQLResolver) profiles(p graphql.ResolveParams) (interface{}, error) {
+	return r.connection(p, GetPrefixes().PrefixPKIDToProfileEntry, func(txn kvTxn, key []byte, val []byte) (interface{}, error) {
+		pkid := &PKID{}
+		copy(pkid[:], key[1:])
+		return decodeGraphQLProfile(pkid, val)
+	})
+}
+
+// graphQLProfile is a profile with the PKID it is stored under.
+type graphQLProfile struct {
+	PKID *PKID
+	*ProfileEntry
+}
+
+// Resolve resolves the fields of the ProfileEntry, since the default resolver
+// doesn't look into embedded structs.
+func (profile *graphQLProfile) Resolve(p graphql.ResolveParams) (interface{}, error) {
+	if p.Info.FieldName == "pkid" {
+		return profile.PKID, nil
+	}
+	p.Source = profile.ProfileEntry
+	return graphql.DefaultResolveFn(p)
+}
+
+func decodeGraphQLProfile(pkid *PKID, val []byte) (*graphQLProfile, error) {
+	profile := &ProfileEntry{}
+	if _, err := DecodeFromBytes(profile, bytes.NewReader(val)); err != nil {
+		return nil, fmt.Errorf("profiles: Problem decoding the profile of %v: %v", pkid, err)
+	}
+	return &graphQLProfile{PKID: pkid, ProfileEntry: profile}, nil
+}
+
+func (r *graphQLResolver) profile(p graphql.ResolveParams) (interface{}, error) {
+	username, _ := p.Args["username"].(string)
+	pkidArg, _ := p.Args["pkid"].(string)
+	if (username == "") == (pkidArg == "") {
+		return nil, fmt.Errorf("profile takes either username or pkid")
+	}
+	var profile *graphQLProfile
+	err := r.db.View(func(txn kvTxn) error {
+		pkid, err := parsePKIDArg(pkidArg)
+		if username != "" {
+			pkid, err = DBGetPKIDForUsernameWithTxn(txn, username)
+		}
+		if err != nil || pkid == nil {
+			return err
+		}
+		entry, err := DBGetProfileEntryForPKIDWithTxn(txn, pkid)
+		if err != nil || entry == nil {
+			return err
+		}
+		profile = &graphQLProfile{PKID: pkid, ProfileEntry: entry}
+		return nil
+	})
+	if profile == nil {
+		return nil, err
+	}
+	return profile, err
+}
+
+func parsePKIDArg(value string) (*PKID, error) {
+	if value == "" {
+		return nil, nil
+	}
+	return parsePKID(value)
+}
+
+// balances walks the balances of a creator, or those of a holder, using the
+// index whose key starts with the PKID that was given.
+func (r *graphQLResolver) balances(p graphql.ResolveParams) (interface{}, error) {
+	creatorArg, _ := p.Args["creatorPKID"].(string)
+	hodlerArg, _ := p.Args["hodlerPKID"].(string)
+	daoCoin, _ := p.Args["daoCoin"].(bool)
+	if creatorArg != "" && hodlerArg != "" {
+		return nil, fmt.Errorf("balances takes either creatorPKID or hodlerPKID")
+	}
+
+	prefixes := GetPrefixes()
+	dbPrefix := prefixes.PrefixCreatorPKIDHODLerPKIDToBalanceEntry
+	pkidArg := creatorArg
+	switch {
+	case hodlerArg != "" && daoCoin:
+		dbPrefix, pkidArg = prefixes.PrefixHODLerPKIDCreatorPKIDToDAOCoinBalanceEntry, hodlerArg
+	case hodlerArg != "":
+		dbPrefix, pkidArg = prefixes.PrefixHODLerPKIDCreatorPKIDToBalanceEntry, hodlerArg
+	case daoCoin:
+		dbPrefix = prefixes.PrefixCreatorPKIDHODLerPKIDToDAOCoinBalanceEntry
+	}
+	pkid, err := parsePKIDArg(pkidArg)
+	if err != nil {
+		return nil, err
+	}
+	if pkid != nil {
+		dbPrefix = append(append([]byte{}, dbPrefix...), pkid[:]...)
+	}
+	return r.connection(p, dbPrefix, func(txn kvTxn, key []byte, val []byte) (interface{}, error) {
+		balance := &BalanceEntry{}
+		if _, err := DecodeFromBytes(balance, bytes.NewReader(val)); err != nil {
+			return nil, fmt.Errorf("balances: Problem decoding %x: %v", key, err)
+		}
+		return balance, nil
+	})
+}
+
+func (r *graphQLResolver) posts(p graphql.ResolveParams) (interface{}, error) {
+	return r.connection(p, GetPrefixes().PrefixPostHashToPostEntry, func(txn kvTxn, key []byte, val []byte) (interface{}, error) {
+		post := &PostEntry{}
+		if _, err := DecodeFromBytes(post, bytes.NewReader(val)); err != nil {
+			return nil, fmt.Errorf("posts: Problem decoding %x: %v", key, err)
+		}
+		return post, nil
+	})
+}
+
+// graphQLRequest is the body of a GraphQL request, or its query string for
+// GET requests.
+type graphQLRequest struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables"`
+	OperationName string                 `json:"operationName"`
+}
+
+// handleGraphQL runs the query of a GET or POST request against schema.
+func handleGraphQL(schema graphql.Schema) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		request := &graphQLRequest{}
+		switch r.Method {
+		case http.MethodGet:
+			query := r.URL.Query()
+			request.Query = query.Get("query")
+			request.OperationName = query.Get("operationName")
+			if variables := query.Get("variables"); variables != "" {
+				if err := json.Unmarshal([]byte(variables), &request.Variables); err != nil {
+					http.Error(w, "variables must be a JSON object", http.StatusBadRequest)
+					return
+				}
+			}
+		case http.MethodPost:
+			if err := json.NewDecoder(r.Body).Decode(request); err != nil {
+				http.Error(w, "the body must be a JSON object with a query", http.StatusBadRequest)
+				return
+			}
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, "GraphQL requests must be GET or POST", http.StatusMethodNotAllowed)
+			return
+		}
+
+		result := graphql.Do(graphql.Params{
+			Schema:         schema,
+			RequestString:  request.Query,
+			VariableValues: request.Variables,
+			OperationName:  request.OperationName,
+			Context:        r.Context(),
+		})
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	}
+}
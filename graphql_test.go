@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"testing"
+
+	"github.com/deso-protocol/core/lib"
+	"github.com/graphql-go/graphql"
+)
+
+// testPublicKey returns a public key ending in id.
+func testPublicKey(id byte) []byte {
+	publicKey := make([]byte, 33)
+	publicKey[0], publicKey[32] = 2, id
+	return publicKey
+}
+
+// mempoolKey returns the PrefixMempoolTxnHashToMsgDeSoTxn key of a txn:
+// the prefix, the time it was added and its hash.
+func mempoolKey(timeAdded uint64, txnHash []byte) []byte {
+	key := append([]byte{}, GetPrefixes().PrefixMempoolTxnHashToMsgDeSoTxn...)
+	key = binary.BigEndian.AppendUint64(key, timeAdded)
+	return append(key, txnHash...)
+}
+
+func TestGraphQLTransactions(t *testing.T) {
+	coreTxn := &lib.MsgDeSoTxn{
+		TxOutputs: []*lib.DeSoOutput{{PublicKey: testPublicKey(2), AmountNanos: 500}},
+		TxnMeta:   &lib.BasicTransferMetadata{},
+		PublicKey: testPublicKey(1),
+	}
+	val, err := coreTxn.ToBytes(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	txnHash := bytes.Repeat([]byte{0xab}, 32)
+	db := newTestDBWithEntries(t, map[string][]byte{
+		string(mempoolKey(1700000000000000000, txnHash)): val,
+	})
+	schema, err := newGraphQLSchema(&nodeDB{kvDB: db})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := graphql.Do(graphql.Params{
+		Schema:        schema,
+		RequestString: `{ transactions { nodes { transactionId affectedPublicKeys { nodes { publicKey } } } } }`,
+		Context:       context.Background(),
+	})
+	if len(result.Errors) > 0 {
+		t.Fatal(result.Errors)
+	}
+	nodes := result.Data.(map[string]interface{})["transactions"].(map[string]interface{})["nodes"].([]interface{})
+	if len(nodes) != 1 {
+		t.Fatalf("got %d transactions, want 1", len(nodes))
+	}
+	node := nodes[0].(map[string]interface{})
+	if want := Base58CheckEncodeWithPrefix(txnHash, keyNetwork.PublicKeyPrefix); node["transactionId"] != want {
+		t.Errorf("got transactionId %v, want %v", node["transactionId"], want)
+	}
+	affected := node["affectedPublicKeys"].(map[string]interface{})["nodes"].([]interface{})
+	if len(affected) != 2 {
+		t.Errorf("got affected public keys %v, want the sender and the receiver", affected)
+	}
+}
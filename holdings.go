@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+)
+
+// coinHolding is a creator coin balance valued in DeSo.
+type coinHolding struct {
+	HODLerPKID      *PKID  `json:"hodlerPKID"`
+	HODLerUsername  string `json:"hodlerUsername"`
+	CreatorPKID     *PKID  `json:"creatorPKID"`
+	CreatorUsername string `json:"creatorUsername"`
+	BalanceNanos    string `json:"balanceNanos"`
+	HasPurchased    bool   `json:"hasPurchased"`
+	// ValueNanos is the DeSo selling the whole balance would return before
+	// fees, on the bonding curve of the creator's profile as it is now. Each
+	// holding is valued on its own, as if no one else sold first.
+	ValueNanos uint64 `json:"valueNanos"`
+
+	balance *big.Int
+}
+
+// coinHoldings is every holding of or in a PKID, largest balance first.
+type coinHoldings struct {
+	PKID            *PKID          `json:"pkid"`
+	Holdings        []*coinHolding `json:"holdings"`
+	TotalValueNanos uint64         `json:"totalValueNanos"`
+}
+
+// creatorCoinHoldersWithTxn returns who holds the creator coin of
+// creatorPKID, read from [34].
+func creatorCoinHoldersWithTxn(ctx context.Context, txn kvTxn, creatorPKID *PKID) (*coinHoldings, error) {
+	return readCoinHoldingsWithTxn(ctx, txn, GetPrefixes().PrefixCreatorPKIDHODLerPKIDToBalanceEntry, creatorPKID)
+}
+
+// creatorCoinHoldingsWithTxn returns the creator coins hodlerPKID holds, read
+// from [33].
+func creatorCoinHoldingsWithTxn(ctx context.Context, txn kvTxn, hodlerPKID *PKID) (*coinHoldings, error) {
+	return readCoinHoldingsWithTxn(ctx, txn, GetPrefixes().PrefixHODLerPKIDCreatorPKIDToBalanceEntry, hodlerPKID)
+}
+
+// readCoinHoldingsWithTxn reads the balance entries stored under dbPrefix and
+// pkid, names both sides after their profiles and values them with the
+// profile of their creator. Empty balances,
+// which core keeps around after a holder sells out, are skipped.
+func readCoinHoldingsWithTxn(ctx context.Context, txn kvTxn, dbPrefix []byte, pkid *PKID) (*coinHoldings, error) {
+	holdings := &coinHoldings{PKID: pkid, Holdings: []*coinHolding{}}
+	profiles := make(map[PKID]*ProfileEntry)
+	getProfile := func(pkid *PKID) (*ProfileEntry, error) {
+		if profile, cached := profiles[*pkid]; cached {
+			return profile, nil
+		}
+		profile, err := DBGetProfileEntryForPKIDWithTxn(txn, pkid)
+		if err != nil {
+			return nil, fmt.Errorf("readCoinHoldingsWithTxn: Problem reading the profile of %v: %v", pkid, err)
+		}
+		profiles[*pkid] = profile
+		return profile, nil
+	}
+	pkidPrefix := append(append([]byte{}, dbPrefix...), pkid[:]...)
+	err := _iterateKeysForPrefixWithTxn(ctx, txn, pkidPrefix, &iterateOptions{}, func(key []byte, val []byte) error {
+		balance := &BalanceEntry{}
+		exists, err := DecodeFromBytes(balance, bytes.NewReader(val))
+		if err != nil {
+			return fmt.Errorf("readCoinHoldingsWithTxn: Problem decoding %x: %v", key, err)
+		}
+		if !exists || balance.BalanceNanos == nil || balance.BalanceNanos.Sign() == 0 {
+			return nil
+		}
+
+		hodler, err := getProfile(balance.HODLerPKID)
+		if err != nil {
+			return err
+		}
+		profile, err := getProfile(balance.CreatorPKID)
+		if err != nil {
+			return err
+		}
+		holding := &coinHolding{
+			HODLerPKID:   balance.HODLerPKID,
+			CreatorPKID:  balance.CreatorPKID,
+			BalanceNanos: balance.BalanceNanos.String(),
+			HasPurchased: balance.HasPurchased,
+			balance:      balance.BalanceNanos,
+		}
+		if hodler != nil {
+			holding.HODLerUsername = hodler.Username
+		}
+		if profile != nil {
+			coin := &profile.CreatorCoinEntry
+			holding.CreatorUsername = profile.Username
+			holding.ValueNanos = calculateDeSoToReturn(
+				uint64OrMax(balance.BalanceNanos), uint64OrMax(coin.CoinsInCirculationNanos), coin.DeSoLockedNanos)
+		}
+		holdings.Holdings = append(holdings.Holdings, holding)
+		if holdings.TotalValueNanos > math.MaxUint64-holding.ValueNanos {
+			holdings.TotalValueNanos = math.MaxUint64
+		} else {
+			holdings.TotalValueNanos += holding.ValueNanos
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(holdings.Holdings, func(ii, jj int) bool {
+		return holdings.Holdings[ii].balance.Cmp(holdings.Holdings[jj].balance) > 0
+	})
+	return holdings, nil
+}
+
+// truncate keeps the limit largest holdings. The total still covers every
+// holding.
+func (h *coinHoldings) truncate(limit int) {
+	if limit > 0 && len(h.Holdings) > limit {
+		h.Holdings = h.Holdings[:limit]
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"math/big"
+	"testing"
+)
+
+// testProfile is the [23] entry of testPKID(id), with a creator coin of
+// coinsInCirculation nanos backed by desoLocked nanos.
+func testProfile(id byte, username string, coinsInCirculation uint64, desoLocked uint64) (string, []byte) {
+	key := string(append([]byte{23}, testPKID(id)[:]...))
+	profile := new(testEncoder).header(encoderVersionBalanceModel).byteArray(testPublicKey(id)).
+		byteArray([]byte(username)).byteArray(nil).byteArray(nil).boolByte(false)
+	profile.header(encoderVersionDefault).uvarint(0).uvarint(desoLocked).uvarint(0).
+		uint256(new(big.Int).SetUint64(coinsInCirculation)).uvarint(coinsInCirculation).boolByte(false)
+	profile.WriteByte(0)
+	profile.header(encoderVersionDefault).uvarint(0).uvarint(0).uvarint(0).uint256(nil).uvarint(0).boolByte(false)
+	profile.WriteByte(0)
+	profile.extraData(nil)
+	return key, profile.Bytes()
+}
+
+// newHoldingsTestDB has Alice (1) and Bob (2) with profiles. Alice's coin is
+// held by Bob, Carol (3), who has no profile, and Dave (4), who sold out.
+// Alice also holds some of Bob's coin.
+func newHoldingsTestDB(t *testing.T) kvDB {
+	t.Helper()
+	entries := make(map[string][]byte)
+	addBalance := func(hodler byte, creator byte, nanos int64) {
+		balance := new(testEncoder).header(encoderVersionDefault).pkid(testPKID(hodler)).pkid(testPKID(creator)).
+			uint256(big.NewInt(nanos)).boolByte(true).Bytes()
+		hodlerKey := append(append([]byte{33}, testPKID(hodler)[:]...), testPKID(creator)[:]...)
+		creatorKey := append(append([]byte{34}, testPKID(creator)[:]...), testPKID(hodler)[:]...)
+		entries[string(hodlerKey)] = balance
+		entries[string(creatorKey)] = balance
+	}
+	for _, profile := range []struct {
+		id       byte
+		username string
+	}{{1, "alice"}, {2, "bob"}} {
+		key, value := testProfile(profile.id, profile.username, 10832150315, 1270996343)
+		entries[key] = value
+	}
+	addBalance(2, 1, 1000)
+	addBalance(3, 1, 1e9)
+	addBalance(4, 1, 0)
+	addBalance(1, 2, 5e9)
+	addBalance(1, 1, 1e6)
+	return newTestDBWithEntries(t, entries)
+}
+
+func TestCreatorCoinHolders(t *testing.T) {
+	var holders *coinHoldings
+	err := newHoldingsTestDB(t).View(func(txn kvTxn) error {
+		var err error
+		holders, err = creatorCoinHoldersWithTxn(context.Background(), txn, testPKID(1))
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Largest first, without Dave's empty balance.
+	want := []struct {
+		hodler   byte
+		username string
+		balance  string
+	}{{3, "", "1000000000"}, {1, "alice", "1000000"}, {2, "bob", "1000"}}
+	if len(holders.Holdings) != len(want) {
+		t.Fatalf("got %d holders, want %d", len(holders.Holdings), len(want))
+	}
+	var total uint64
+	for ii, holding := range holders.Holdings {
+		if *holding.HODLerPKID != *testPKID(want[ii].hodler) || holding.HODLerUsername != want[ii].username ||
+			holding.BalanceNanos != want[ii].balance || holding.CreatorUsername != "alice" {
+			t.Errorf("holder %d is %+v, want %+v", ii, holding, want[ii])
+		}
+		if wantValue := calculateDeSoToReturn(holding.balance.Uint64(), 10832150315, 1270996343); holding.ValueNanos != wantValue {
+			t.Errorf("holder %d is worth %d nanos, want %d", ii, holding.ValueNanos, wantValue)
+		}
+		total += holding.ValueNanos
+	}
+	if holders.TotalValueNanos != total {
+		t.Errorf("got a total of %d nanos, want %d", holders.TotalValueNanos, total)
+	}
+
+	// The total still counts the holders truncate drops.
+	holders.truncate(1)
+	if len(holders.Holdings) != 1 || holders.TotalValueNanos != total {
+		t.Errorf("truncated to %d holders worth %d nanos, want 1 worth %d", len(holders.Holdings), holders.TotalValueNanos, total)
+	}
+}
+
+func TestCreatorCoinHoldings(t *testing.T) {
+	db := newHoldingsTestDB(t)
+	var holdings, empty *coinHoldings
+	err := db.View(func(txn kvTxn) error {
+		var err error
+		if holdings, err = creatorCoinHoldingsWithTxn(context.Background(), txn, testPKID(1)); err != nil {
+			return err
+		}
+		empty, err = creatorCoinHoldingsWithTxn(context.Background(), txn, testPKID(5))
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(holdings.Holdings) != 2 {
+		t.Fatalf("got %d holdings, want 2", len(holdings.Holdings))
+	}
+	if bob := holdings.Holdings[0]; *bob.CreatorPKID != *testPKID(2) || bob.CreatorUsername != "bob" || bob.BalanceNanos != "5000000000" {
+		t.Errorf("got %+v first, want the holding of Bob's coin", bob)
+	}
+	if own := holdings.Holdings[1]; *own.CreatorPKID != *testPKID(1) || own.HODLerUsername != "alice" {
+		t.Errorf("got %+v second, want Alice's own coin", own)
+	}
+	if empty.Holdings == nil || len(empty.Holdings) != 0 || empty.TotalValueNanos != 0 {
+		t.Errorf("got %+v for a PKID with no holdings, want an empty list", empty)
+	}
+}
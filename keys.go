@@ -0,0 +1,290 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// keyPartType is the type of a single component of a key, after the prefix.
+type keyPartType int
+
+const (
+	// keyPKID is a 33-byte PKID.
+	keyPKID keyPartType = iota
+	// keyPublicKey is a 33-byte compressed public key.
+	keyPublicKey
+	// keyBlockHash is a 32-byte BlockHash. Post hashes, txids and order ids all use it.
+	keyBlockHash
+	// keyUint8 is a single byte.
+	keyUint8
+	// keyBool is a single byte that is either 0 or 1.
+	keyBool
+	// keyUint32 is a big-endian uint32.
+	keyUint32
+	// keyMaxUint32MinusUint32 is a big-endian uint32 stored as MaxUint32 - value
+	// so that iterating the prefix forward returns the highest values first.
+	keyMaxUint32MinusUint32
+	// keyUint64 is a big-endian uint64.
+	keyUint64
+	// keyTimestamp is a big-endian uint64 holding unix nanoseconds.
+	keyTimestamp
+	// keyUint256 is a fixed-width, big-endian 32-byte unsigned integer.
+	keyUint256
+	// keyGroupKeyName is a 32-byte access group key name, right-padded with zeros.
+	keyGroupKeyName
+	// keyNullTerminatedString is a string followed by a single 0 byte.
+	keyNullTerminatedString
+	// keyString is a string that takes up the rest of the key.
+	keyString
+	// keyVarBytes is a byte slice whose length is whatever is left once the
+	// fixed-width parts after it have been accounted for.
+	keyVarBytes
+)
+
+var keyPartTypeNames = map[keyPartType]string{
+	keyPKID:                 "PKID",
+	keyPublicKey:            "PublicKey",
+	keyBlockHash:            "BlockHash",
+	keyUint8:                "uint8",
+	keyBool:                 "bool",
+	keyUint32:               "uint32",
+	keyMaxUint32MinusUint32: "uint32",
+	keyUint64:               "uint64",
+	keyTimestamp:            "timestamp",
+	keyUint256:              "uint256",
+	keyGroupKeyName:         "GroupKeyName",
+	keyNullTerminatedString: "string",
+	keyString:               "string",
+	keyVarBytes:             "bytes",
+}
+
+func (t keyPartType) String() string {
+	return keyPartTypeNames[t]
+}
+
+// size returns the number of bytes taken by a part, or -1 if the part is
+// variable length.
+func (t keyPartType) size() int {
+	switch t {
+	case keyPKID, keyPublicKey:
+		return 33
+	case keyBlockHash, keyUint256, keyGroupKeyName:
+		return 32
+	case keyUint8, keyBool:
+		return 1
+	case keyUint32, keyMaxUint32MinusUint32:
+		return 4
+	case keyUint64, keyTimestamp:
+		return 8
+	}
+	return -1
+}
+
+// keyPart is a single named component of a key.
+type keyPart struct {
+	Name string
+	Type keyPartType
+}
+
+// keySchemas maps every DBPrefixes field name to the layout of the key after
+// the prefix byte. The layouts follow the Key format comments on DBPrefixes,
+// except where core writes something different than the comment says, in which
+// case we follow core.
+var keySchemas = map[string][]keyPart{
+	"PrefixBlockHashToBlock":            {{"hash", keyBlockHash}},
+	"PrefixHeightHashToNodeInfo":        {{"height", keyUint32}, {"hash", keyBlockHash}},
+	"PrefixBitcoinHeightHashToNodeInfo": {{"height", keyUint32}, {"hash", keyBlockHash}},
+	"PrefixBestDeSoBlockHash":           {},
+	"PrefixBestBitcoinHeaderHash":       {},
+
+	"PrefixUtxoKeyToUtxoEntry":             {{"txid", keyBlockHash}, {"index", keyUint32}},
+	"PrefixPubKeyUtxoKey":                  {{"publicKey", keyPublicKey}, {"txid", keyBlockHash}, {"index", keyUint32}},
+	"PrefixUtxoNumEntries":                 {},
+	"PrefixBlockHashToUtxoOperations":      {{"hash", keyBlockHash}},
+	"PrefixNanosPurchased":                 {},
+	"PrefixUSDCentsPerBitcoinExchangeRate": {},
+	"PrefixGlobalParams":                   {},
+	"PrefixBitcoinBurnTxIDs":               {{"bitcoinTxid", keyBlockHash}},
+
+	"PrefixPublicKeyTimestampToPrivateMessage": {{"publicKey", keyPublicKey}, {"tstampNanos", keyTimestamp}},
+
+	"PrefixTransactionIndexTip":            {},
+	"PrefixTransactionIDToMetadata":        {{"txid", keyBlockHash}},
+	"PrefixPublicKeyIndexToTransactionIDs": {{"publicKey", keyPublicKey}, {"index", keyUint32}},
+	"PrefixPublicKeyToNextIndex":           {{"publicKey", keyPublicKey}},
+
+	"PrefixPostHashToPostEntry":            {{"postHash", keyBlockHash}},
+	"PrefixPosterPublicKeyPostHash":        {{"posterPublicKey", keyPublicKey}, {"postHash", keyBlockHash}},
+	"PrefixTstampNanosPostHash":            {{"tstampNanos", keyTimestamp}, {"postHash", keyBlockHash}},
+	"PrefixCreatorBpsPostHash":             {{"creatorBps", keyUint64}, {"postHash", keyBlockHash}},
+	"PrefixMultipleBpsPostHash":            {{"multipleBps", keyUint64}, {"postHash", keyBlockHash}},
+	"PrefixCommentParentStakeIDToPostHash": {{"parentStakeID", keyVarBytes}, {"tstampNanos", keyTimestamp}, {"postHash", keyBlockHash}},
+
+	"PrefixPKIDToProfileEntry":                {{"pkid", keyPKID}},
+	"PrefixProfileUsernameToPKID":             {{"username", keyString}},
+	"PrefixCreatorDeSoLockedNanosCreatorPKID": {{"desoLockedNanos", keyUint64}, {"creatorPKID", keyPKID}},
+	"PrefixStakeIDTypeAmountStakeIDIndex":     {{"stakeIDType", keyUint8}, {"amountNanos", keyUint64}, {"stakeID", keyVarBytes}},
+
+	"PrefixFollowerPKIDToFollowedPKID": {{"followerPKID", keyPKID}, {"followedPKID", keyPKID}},
+	"PrefixFollowedPKIDToFollowerPKID": {{"followedPKID", keyPKID}, {"followerPKID", keyPKID}},
+
+	"PrefixLikerPubKeyToLikedPostHash": {{"likerPublicKey", keyPublicKey}, {"likedPostHash", keyBlockHash}},
+	"PrefixLikedPostHashToLikerPubKey": {{"likedPostHash", keyBlockHash}, {"likerPublicKey", keyPublicKey}},
+
+	"PrefixHODLerPKIDCreatorPKIDToBalanceEntry": {{"hodlerPKID", keyPKID}, {"creatorPKID", keyPKID}},
+	"PrefixCreatorPKIDHODLerPKIDToBalanceEntry": {{"creatorPKID", keyPKID}, {"hodlerPKID", keyPKID}},
+
+	"PrefixPosterPublicKeyTimestampPostHash": {{"posterPublicKey", keyPublicKey}, {"tstampNanos", keyTimestamp}, {"postHash", keyBlockHash}},
+	"PrefixPublicKeyToPKID":                  {{"publicKey", keyPublicKey}},
+	"PrefixPKIDToPublicKey":                  {{"pkid", keyPKID}},
+	// Core puts the time the txn was added in front of the hash, which the
+	// comment on DBPrefixes leaves out.
+	"PrefixMempoolTxnHashToMsgDeSoTxn": {{"timeAdded", keyTimestamp}, {"txnHash", keyBlockHash}},
+
+	"PrefixReposterPubKeyRepostedPostHashToRepostPostHash": {{"reposterPublicKey", keyPublicKey}, {"repostedPostHash", keyBlockHash}},
+	"PrefixDiamondReceiverPKIDDiamondSenderPKIDPostHash":   {{"receiverPKID", keyPKID}, {"senderPKID", keyPKID}, {"postHash", keyBlockHash}},
+	"PrefixDiamondSenderPKIDDiamondReceiverPKIDPostHash":   {{"senderPKID", keyPKID}, {"receiverPKID", keyPKID}, {"postHash", keyBlockHash}},
+	"PrefixForbiddenBlockSignaturePubKeys":                 {{"publicKey", keyPublicKey}},
+
+	"PrefixRepostedPostHashReposterPubKey":               {{"repostedPostHash", keyBlockHash}, {"reposterPublicKey", keyPublicKey}},
+	"PrefixRepostedPostHashReposterPubKeyRepostPostHash": {{"repostedPostHash", keyBlockHash}, {"reposterPublicKey", keyPublicKey}, {"repostPostHash", keyBlockHash}},
+	"PrefixDiamondedPostHashDiamonderPKIDDiamondLevel":   {{"diamondedPostHash", keyBlockHash}, {"diamonderPKID", keyPKID}, {"diamondLevel", keyUint64}},
+
+	"PrefixPostHashSerialNumberToNFTEntry":                            {{"nftPostHash", keyBlockHash}, {"serialNumber", keyUint64}},
+	"PrefixPKIDIsForSaleBidAmountNanosPostHashSerialNumberToNFTEntry": {{"pkid", keyPKID}, {"isForSale", keyBool}, {"bidAmountNanos", keyUint64}, {"nftPostHash", keyBlockHash}, {"serialNumber", keyUint64}},
+	"PrefixPostHashSerialNumberBidNanosBidderPKID":                    {{"nftPostHash", keyBlockHash}, {"serialNumber", keyUint64}, {"bidNanos", keyUint64}, {"bidderPKID", keyPKID}},
+	"PrefixBidderPKIDPostHashSerialNumberToBidNanos":                  {{"bidderPKID", keyPKID}, {"nftPostHash", keyBlockHash}, {"serialNumber", keyUint64}},
+
+	"PrefixPublicKeyToDeSoBalanceNanos": {{"publicKey", keyPublicKey}},
+	// Core writes the public key first, the comment on DBPrefixes only
+	// mentions the hash.
+	"PrefixPublicKeyBlockHashToBlockReward":          {{"publicKey", keyPublicKey}, {"blockHash", keyBlockHash}},
+	"PrefixPostHashSerialNumberToAcceptedBidEntries": {{"nftPostHash", keyBlockHash}, {"serialNumber", keyUint64}},
+
+	"PrefixHODLerPKIDCreatorPKIDToDAOCoinBalanceEntry": {{"hodlerPKID", keyPKID}, {"creatorPKID", keyPKID}},
+	"PrefixCreatorPKIDHODLerPKIDToDAOCoinBalanceEntry": {{"creatorPKID", keyPKID}, {"hodlerPKID", keyPKID}},
+
+	"PrefixMessagingGroupEntriesByOwnerPubKeyAndGroupKeyName":           {{"ownerPublicKey", keyPublicKey}, {"groupKeyName", keyGroupKeyName}},
+	"PrefixMessagingGroupMetadataByMemberPubKeyAndGroupMessagingPubKey": {{"ownerPublicKey", keyPublicKey}, {"groupMessagingPublicKey", keyPublicKey}},
+	"PrefixAuthorizeDerivedKey":                                         {{"ownerPublicKey", keyPublicKey}, {"derivedPublicKey", keyPublicKey}},
+
+	// The block height is stored as MaxUint32 - height so that older orders at
+	// the same price are matched first.
+	"PrefixDAOCoinLimitOrder":                 {{"buyingDAOCoinCreatorPKID", keyPKID}, {"sellingDAOCoinCreatorPKID", keyPKID}, {"scaledExchangeRateCoinsToSellPerCoinToBuy", keyUint256}, {"blockHeight", keyMaxUint32MinusUint32}, {"orderID", keyBlockHash}},
+	"PrefixDAOCoinLimitOrderByTransactorPKID": {{"transactorPKID", keyPKID}, {"buyingDAOCoinCreatorPKID", keyPKID}, {"sellingDAOCoinCreatorPKID", keyPKID}, {"orderID", keyBlockHash}},
+	"PrefixDAOCoinLimitOrderByOrderID":        {{"orderID", keyBlockHash}},
+
+	"PrefixUserAssociationByID":         {{"associationID", keyBlockHash}},
+	"PrefixUserAssociationByTransactor": {{"transactorPKID", keyPKID}, {"associationType", keyNullTerminatedString}, {"associationValue", keyNullTerminatedString}, {"targetUserPKID", keyPKID}, {"appPKID", keyPKID}},
+	"PrefixUserAssociationByTargetUser": {{"targetUserPKID", keyPKID}, {"associationType", keyNullTerminatedString}, {"associationValue", keyNullTerminatedString}, {"transactorPKID", keyPKID}, {"appPKID", keyPKID}},
+	"PrefixUserAssociationByUsers":      {{"transactorPKID", keyPKID}, {"targetUserPKID", keyPKID}, {"associationType", keyNullTerminatedString}, {"associationValue", keyNullTerminatedString}, {"appPKID", keyPKID}},
+
+	"PrefixPostAssociationByID":         {{"associationID", keyBlockHash}},
+	"PrefixPostAssociationByTransactor": {{"transactorPKID", keyPKID}, {"associationType", keyNullTerminatedString}, {"associationValue", keyNullTerminatedString}, {"postHash", keyBlockHash}, {"appPKID", keyPKID}},
+	"PrefixPostAssociationByPost":       {{"postHash", keyBlockHash}, {"associationType", keyNullTerminatedString}, {"associationValue", keyNullTerminatedString}, {"transactorPKID", keyPKID}, {"appPKID", keyPKID}},
+	"PrefixPostAssociationByType":       {{"associationType", keyNullTerminatedString}, {"associationValue", keyNullTerminatedString}, {"postHash", keyBlockHash}, {"transactorPKID", keyPKID}, {"appPKID", keyPKID}},
+
+	"PrefixAccessGroupEntriesByAccessGroupId": {{"accessGroupOwnerPublicKey", keyPublicKey}, {"groupKeyName", keyGroupKeyName}},
+	"PrefixAccessGroupMembershipIndex":        {{"accessGroupMemberPublicKey", keyPublicKey}, {"accessGroupOwnerPublicKey", keyPublicKey}, {"groupKeyName", keyGroupKeyName}},
+	"PrefixAccessGroupMemberEnumerationIndex": {{"accessGroupOwnerPublicKey", keyPublicKey}, {"groupKeyName", keyGroupKeyName}, {"accessGroupMemberPublicKey", keyPublicKey}},
+	"PrefixGroupChatMessagesIndex":            {{"accessGroupOwnerPublicKey", keyPublicKey}, {"groupKeyName", keyGroupKeyName}, {"tstampNanos", keyTimestamp}},
+	"PrefixDmMessagesIndex":                   {{"minorAccessGroupOwnerPublicKey", keyPublicKey}, {"minorGroupKeyName", keyGroupKeyName}, {"majorAccessGroupOwnerPublicKey", keyPublicKey}, {"majorGroupKeyName", keyGroupKeyName}, {"tstampNanos", keyTimestamp}},
+	"PrefixDmThreadIndex":                     {{"userAccessGroupOwnerPublicKey", keyPublicKey}, {"userGroupKeyName", keyGroupKeyName}, {"partyAccessGroupOwnerPublicKey", keyPublicKey}, {"partyGroupKeyName", keyGroupKeyName}},
+
+	"PrefixNoncePKIDIndex":   {{"expirationBlockHeight", keyUint64}, {"pkid", keyPKID}, {"partialID", keyUint64}},
+	"PrefixTxnHashToTxn":     {{"txnHash", keyBlockHash}},
+	"PrefixTxnHashToUtxoOps": {{"txnHash", keyBlockHash}},
+}
+
+// keyField is a single decoded component of a key.
+type keyField struct {
+	Name  string      `json:"name"`
+	Type  string      `json:"type"`
+	Value interface{} `json:"value"`
+}
+
+func (f *keyField) String() string {
+	return fmt.Sprintf("%s=%v", f.Name, f.Value)
+}
+
+// decodeKey splits a key stored under prefix into the named components of its
+// schema. Bytes that are left over once the schema is exhausted are returned as
+// a trailing "rest" field so that nothing in the key is hidden.
+func decodeKey(prefix *namedPrefix, key []byte) ([]*keyField, error) {
+	if prefix == nil || !bytes.HasPrefix(key, prefix.Prefix) {
+		return nil, fmt.Errorf("decodeKey: key %x does not start with the prefix", key)
+	}
+	parts, exists := keySchemas[prefix.Name]
+	if !exists {
+		return nil, fmt.Errorf("decodeKey: no key schema for %s", prefix.Name)
+	}
+
+	rest := key[len(prefix.Prefix):]
+	var fields []*keyField
+	for ii, part := range parts {
+		size := part.Type.size()
+		switch part.Type {
+		case keyNullTerminatedString:
+			size = bytes.IndexByte(rest, 0) + 1
+			if size == 0 {
+				return fields, fmt.Errorf("decodeKey: no null terminator for %s in %s", part.Name, prefix.Name)
+			}
+		case keyString:
+			size = len(rest)
+		case keyVarBytes:
+			size = len(rest)
+			for _, after := range parts[ii+1:] {
+				size -= after.Type.size()
+			}
+		}
+		if size < 0 || size > len(rest) {
+			return fields, fmt.Errorf("decodeKey: key too short for %s in %s, %d bytes left", part.Name, prefix.Name, len(rest))
+		}
+
+		fields = append(fields, &keyField{
+			Name:  part.Name,
+			Type:  part.Type.String(),
+			Value: decodeKeyPart(part.Type, rest[:size]),
+		})
+		rest = rest[size:]
+	}
+	if len(rest) > 0 {
+		fields = append(fields, &keyField{Name: "rest", Type: keyVarBytes.String(), Value: hex.EncodeToString(rest)})
+	}
+	return fields, nil
+}
+
+// decodeKeyPart converts the raw bytes of a single part into a printable value.
+func decodeKeyPart(partType keyPartType, data []byte) interface{} {
+	switch partType {
+	case keyPKID, keyPublicKey:
+		return PkToString(data)
+	case keyUint8:
+		return data[0]
+	case keyBool:
+		return data[0] != 0
+	case keyUint32:
+		return binary.BigEndian.Uint32(data)
+	case keyMaxUint32MinusUint32:
+		return math.MaxUint32 - binary.BigEndian.Uint32(data)
+	case keyUint64:
+		return binary.BigEndian.Uint64(data)
+	case keyTimestamp:
+		return time.Unix(0, int64(binary.BigEndian.Uint64(data))).UTC().Format(time.RFC3339Nano)
+	case keyUint256:
+		return new(big.Int).SetBytes(data).String()
+	case keyGroupKeyName:
+		return strings.TrimRight(string(data), "\x00")
+	case keyNullTerminatedString:
+		return string(data[:len(data)-1])
+	case keyString:
+		return string(data)
+	}
+	return hex.EncodeToString(data)
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/binary"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/deso-protocol/core/lib"
+)
+
+// TestKeySchemasCoverPrefixes checks every DBPrefixes field has a key schema,
+// so that no key is printed as hex only because its prefix was added without
+// one, and that every schema belongs to a field.
+func TestKeySchemasCoverPrefixes(t *testing.T) {
+	names := make(map[string]bool)
+	for _, prefix := range listPrefixes() {
+		names[prefix.Name] = true
+		if _, exists := keySchemas[prefix.Name]; !exists {
+			t.Errorf("no key schema for %s %v", prefix.Name, prefix.Prefix)
+		}
+	}
+	for name := range keySchemas {
+		if !names[name] {
+			t.Errorf("key schema for %s, which isn't in DBPrefixes", name)
+		}
+	}
+}
+
+// testKey appends parts to the prefix of name.
+func testKey(t *testing.T, name string, parts ...[]byte) (*namedPrefix, []byte) {
+	t.Helper()
+	prefix, err := findPrefix(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := append([]byte{}, prefix.Prefix...)
+	for _, part := range parts {
+		key = append(key, part...)
+	}
+	return prefix, key
+}
+
+func uint32Bytes(value uint32) []byte {
+	return binary.BigEndian.AppendUint32(nil, value)
+}
+
+func uint64Bytes(value uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, value)
+}
+
+// TestDecodeKey builds composite keys the way core writes them, with core's
+// own functions where it exports one, and checks decodeKey gets back the
+// values they were built from.
+func TestDecodeKey(t *testing.T) {
+	timeAdded := time.Date(2023, 5, 1, 12, 30, 0, 123456789, time.UTC)
+	alice, bob := PkToString(testPublicKey(1)), PkToString(testPublicKey(2))
+	hash := testBlockHash(7)
+	hashHex := strings.Repeat("07", 32)
+	rate := testRate(3, 2)
+	groupKeyName := make([]byte, 32)
+	copy(groupKeyName, "friends")
+
+	tests := []struct {
+		name string
+		key  func(t *testing.T) (*namedPrefix, []byte)
+		want []string
+	}{
+		{"mempool txn", func(t *testing.T) (*namedPrefix, []byte) {
+			prefix, _ := testKey(t, "PrefixMempoolTxnHashToMsgDeSoTxn")
+			return prefix, mempoolKey(uint64(timeAdded.UnixNano()), hash[:])
+		}, []string{"timeAdded=2023-05-01T12:30:00.123456789Z", "txnHash=" + hashHex}},
+		{"limit order", func(t *testing.T) (*namedPrefix, []byte) {
+			order := &testLimitOrder{id: 7, transactor: 3, buying: testPKID(1), selling: testPKID(2), rate: rate, height: 1000}
+			prefix, _ := testKey(t, "PrefixDAOCoinLimitOrder")
+			return prefix, []byte(order.bookKey())
+		}, []string{"buyingDAOCoinCreatorPKID=" + alice, "sellingDAOCoinCreatorPKID=" + bob,
+			"scaledExchangeRateCoinsToSellPerCoinToBuy=" + rate.String(), "blockHeight=1000", "orderID=" + hashHex}},
+		{"limit order by transactor", func(t *testing.T) (*namedPrefix, []byte) {
+			order := &testLimitOrder{id: 7, transactor: 3, buying: testPKID(1), selling: testPKID(2), rate: rate}
+			prefix, _ := testKey(t, "PrefixDAOCoinLimitOrderByTransactorPKID")
+			return prefix, []byte(order.transactorKey())
+		}, []string{"transactorPKID=" + PkToString(testPublicKey(3)), "buyingDAOCoinCreatorPKID=" + alice,
+			"sellingDAOCoinCreatorPKID=" + bob, "orderID=" + hashHex}},
+		{"block reward", func(t *testing.T) (*namedPrefix, []byte) {
+			prefix, _ := testKey(t, "PrefixPublicKeyBlockHashToBlockReward")
+			return prefix, lib.PublicKeyBlockHashToBlockRewardKey(testPublicKey(1), (*lib.BlockHash)(hash))
+		}, []string{"publicKey=" + alice, "blockHash=" + hashHex}},
+		{"txindex", func(t *testing.T) (*namedPrefix, []byte) {
+			prefix, _ := testKey(t, "PrefixPublicKeyIndexToTransactionIDs")
+			return prefix, lib.DbTxindexPublicKeyIndexToTxnKey(testPublicKey(1), 42)
+		}, []string{"publicKey=" + alice, "index=42"}},
+		{"NFT by owner", func(t *testing.T) (*namedPrefix, []byte) {
+			return testKey(t, "PrefixPKIDIsForSaleBidAmountNanosPostHashSerialNumberToNFTEntry",
+				testPKID(1)[:], []byte{1}, uint64Bytes(5e9), hash[:], uint64Bytes(3))
+		}, []string{"pkid=" + alice, "isForSale=true", "bidAmountNanos=5000000000", "nftPostHash=" + hashHex, "serialNumber=3"}},
+		{"comment", func(t *testing.T) (*namedPrefix, []byte) {
+			return testKey(t, "PrefixCommentParentStakeIDToPostHash",
+				hash[:], uint64Bytes(uint64(timeAdded.UnixNano())), testBlockHash(8)[:])
+		}, []string{"parentStakeID=" + hashHex, "tstampNanos=2023-05-01T12:30:00.123456789Z", "postHash=" + strings.Repeat("08", 32)}},
+		{"user association", func(t *testing.T) (*namedPrefix, []byte) {
+			return testKey(t, "PrefixUserAssociationByTransactor",
+				testPKID(1)[:], []byte("ENDORSEMENT\x00"), []byte("go\x00"), testPKID(2)[:], testPKID(3)[:])
+		}, []string{"transactorPKID=" + alice, "associationType=ENDORSEMENT", "associationValue=go",
+			"targetUserPKID=" + bob, "appPKID=" + PkToString(testPublicKey(3))}},
+		{"group chat message", func(t *testing.T) (*namedPrefix, []byte) {
+			return testKey(t, "PrefixGroupChatMessagesIndex",
+				testPublicKey(1), groupKeyName, uint64Bytes(uint64(timeAdded.UnixNano())))
+		}, []string{"accessGroupOwnerPublicKey=" + alice, "groupKeyName=friends", "tstampNanos=2023-05-01T12:30:00.123456789Z"}},
+		{"height", func(t *testing.T) (*namedPrefix, []byte) {
+			return testKey(t, "PrefixHeightHashToNodeInfo", uint32Bytes(math.MaxUint32), hash[:])
+		}, []string{"height=4294967295", "hash=" + hashHex}},
+		{"bytes past the schema", func(t *testing.T) (*namedPrefix, []byte) {
+			return testKey(t, "PrefixPKIDToProfileEntry", testPKID(1)[:], []byte{0xab})
+		}, []string{"pkid=" + alice, "rest=ab"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			prefix, key := test.key(t)
+			fields, err := decodeKey(prefix, key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, field := range fields {
+				got = append(got, field.String())
+			}
+			if strings.Join(got, " ") != strings.Join(test.want, " ") {
+				t.Errorf("got\n%v\nwant\n%v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDecodeKeyErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		prefix  string
+		parts   [][]byte
+		wantErr string
+	}{
+		{"truncated", "PrefixDAOCoinLimitOrder", [][]byte{testPKID(1)[:], testPKID(2)[:], make([]byte, 31)},
+			"key too short for scaledExchangeRateCoinsToSellPerCoinToBuy"},
+		{"no null terminator", "PrefixUserAssociationByTransactor", [][]byte{testPKID(1)[:], []byte("ENDORSEMENT")},
+			"no null terminator for associationType"},
+		{"var bytes shorter than the parts after them", "PrefixCommentParentStakeIDToPostHash", [][]byte{make([]byte, 39)},
+			"key too short for parentStakeID"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			prefix, key := testKey(t, test.prefix, test.parts...)
+			if _, err := decodeKey(prefix, key); err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("got error %v, want one containing %q", err, test.wantErr)
+			}
+		})
+	}
+
+	prefix, _ := testKey(t, "PrefixPKIDToProfileEntry")
+	if _, err := decodeKey(prefix, []byte{24, 1}); err == nil {
+		t.Error("decoded a key under another prefix")
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// The lookups below mirror core's DBGet*WithTxn functions for the few entries
+// the tool needs to resolve on its own. They return nil without an error when
+// the entry doesn't exist.
+
+// DBGetPKIDForPublicKeyWithTxn returns the PKID of a public key. Keys that
+// never swapped identities have no [36] entry, and their PKID is the public
+// key itself, as in core.
+func DBGetPKIDForPublicKeyWithTxn(txn kvTxn, publicKey []byte) (*PKID, error) {
+	key := append(append([]byte{}, GetPrefixes().PrefixPublicKeyToPKID...), publicKey...)
+	pkid := &PKID{}
+	val, err := txn.Get(key)
+	if err == errKeyNotFound {
+		copy(pkid[:], publicKey)
+		return pkid, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	copy(pkid[:], val)
+	return pkid, nil
+}
+
+// DBGetPublicKeyForPKIDWithTxn returns the public key a PKID currently
+// belongs to. PKIDs without a [37] entry are the public key itself, as in
+// core.
+func DBGetPublicKeyForPKIDWithTxn(txn kvTxn, pkid *PKID) (PublicKey, error) {
+	key := append(append([]byte{}, GetPrefixes().PrefixPKIDToPublicKey...), pkid[:]...)
+	val, err := txn.Get(key)
+	if err == errKeyNotFound {
+		return PublicKey(append([]byte{}, pkid[:]...)), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return PublicKey(val), nil
+}
+
+func DBGetProfileEntryForPKIDWithTxn(txn kvTxn, pkid *PKID) (*ProfileEntry, error) {
+	key := append(append([]byte{}, GetPrefixes().PrefixPKIDToProfileEntry...), pkid[:]...)
+	val, err := txn.Get(key)
+	if err == errKeyNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	profile := &ProfileEntry{}
+	exists, err := DecodeFromBytes(profile, bytes.NewReader(val))
+	if err != nil || !exists {
+		return nil, err
+	}
+	return profile, nil
+}
+
+func DBGetProfileEntryForPublicKeyWithTxn(txn kvTxn, publicKey []byte) (*ProfileEntry, error) {
+	pkid, err := DBGetPKIDForPublicKeyWithTxn(txn, publicKey)
+	if err != nil {
+		return nil, err
+	}
+	return DBGetProfileEntryForPKIDWithTxn(txn, pkid)
+}
+
+// DBGetPKIDForUsernameWithTxn returns the PKID of the profile with username.
+// Core stores usernames lowercased in [25], so the lookup is case-insensitive.
+func DBGetPKIDForUsernameWithTxn(txn kvTxn, username string) (*PKID, error) {
+	key := append(append([]byte{}, GetPrefixes().PrefixProfileUsernameToPKID...), strings.ToLower(username)...)
+	val, err := txn.Get(key)
+	if err == errKeyNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	pkid := &PKID{}
+	copy(pkid[:], val)
+	return pkid, nil
+}
+
+// DBGetDeSoBalanceNanosForPublicKeyWithTxn returns the DeSo balance of a
+// public key, which is 0 when it has no [52] entry.
+func DBGetDeSoBalanceNanosForPublicKeyWithTxn(txn kvTxn, publicKey []byte) (uint64, error) {
+	key := append(append([]byte{}, GetPrefixes().PrefixPublicKeyToDeSoBalanceNanos...), publicKey...)
+	val, err := txn.Get(key)
+	if err == errKeyNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if len(val) != 8 {
+		return 0, fmt.Errorf("DBGetDeSoBalanceNanosForPublicKeyWithTxn: balance of %v has %d bytes, expected 8", PublicKey(publicKey), len(val))
+	}
+	return binary.BigEndian.Uint64(val), nil
+}
+
+// keyConversion is a public key and its PKID in every encoding we print keys
+// in.
+type keyConversion struct {
+	PublicKeyMainnet string `json:"publicKeyMainnet"`
+	PublicKeyTestnet string `json:"publicKeyTestnet"`
+	PublicKeyHex     string `json:"publicKeyHex"`
+	PKID             string `json:"pkid"`
+	PKIDHex          string `json:"pkidHex"`
+}
+
+// resolveKeyWithTxn reads input with parsePublicKey and converts it. When
+// isPKID is set input is a PKID, and its public key is looked up instead.
+func resolveKeyWithTxn(txn kvTxn, input string, isPKID bool) (*keyConversion, error) {
+	decoded, err := parsePublicKey(input)
+	if err != nil {
+		return nil, err
+	}
+	publicKey := PublicKey(decoded)
+	pkid := &PKID{}
+	copy(pkid[:], decoded)
+	if isPKID {
+		publicKey, err = DBGetPublicKeyForPKIDWithTxn(txn, pkid)
+	} else {
+		pkid, err = DBGetPKIDForPublicKeyWithTxn(txn, publicKey)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("resolveKeyWithTxn: Problem resolving %s: %v", input, err)
+	}
+	return &keyConversion{
+		PublicKeyMainnet: Base58CheckEncodeWithPrefix(publicKey, networkMainnet.PublicKeyPrefix),
+		PublicKeyTestnet: Base58CheckEncodeWithPrefix(publicKey, networkTestnet.PublicKeyPrefix),
+		PublicKeyHex:     hex.EncodeToString(publicKey),
+		PKID:             pkid.String(),
+		PKIDHex:          hex.EncodeToString(pkid[:]),
+	}, nil
+}
+
+// resolvePKIDWithTxn returns the PKID query names. query is a public key or
+// PKID, as Base58Check or hex, or else a username. It returns nil without an
+// error when there is no profile with that username.
+func resolvePKIDWithTxn(txn kvTxn, query string) (*PKID, error) {
+	if publicKey, err := parsePublicKey(query); err == nil {
+		return DBGetPKIDForPublicKeyWithTxn(txn, publicKey)
+	}
+	return DBGetPKIDForUsernameWithTxn(txn, query)
+}
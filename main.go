@@ -1,12 +1,14 @@
 package main
 
 import (
-	_ "context"
-	"encoding/json"
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
-	"github.com/dgraph-io/badger/v4"
 	"log"
-	"reflect"
+	"os"
+	"os/signal"
+	"sync"
 	_ "time"
 )
 
@@ -37,6 +39,8 @@ type DBPrefixes struct {
 	// Value format: BlockHash
 	PrefixBestDeSoBlockHash []byte `prefix_id:"[3]"`
 
+	// The hash of the Bitcoin header at the tip of the best chain.
+	// Value format: BlockHash
 	PrefixBestBitcoinHeaderHash []byte `prefix_id:"[4]"`
 
 	// Utxo table.
@@ -137,6 +141,8 @@ type DBPrefixes struct {
 	PrefixHODLerPKIDCreatorPKIDToBalanceEntry []byte `prefix_id:"[33]" is_state:"true"`
 	PrefixCreatorPKIDHODLerPKIDToBalanceEntry []byte `prefix_id:"[34]" is_state:"true" core_state:"true"`
 
+	// The posts of a public key in the order they were made:
+	// <prefix_id, poster public key [33]byte, timestamp uint64, post hash [32]byte> -> <>
 	PrefixPosterPublicKeyTimestampPostHash []byte `prefix_id:"[35]" is_state:"true"`
 	// If no mapping exists for a particular public key, then the PKID is simply
 	// the public key itself.
@@ -448,103 +454,175 @@ type DBPrefixes struct {
 }
 
 func main() {
-	// Create a new Badger DB instance.
-	db, err := badger.Open(badger.DefaultOptions("\\\\wsl.localhost\\docker-desktop-data\\data\\docker\\volumes\\run_db\\_data\\v-00000\\badgerdb"))
-	if err != nil {
-		log.Fatalf("Error opening Badger database: %v", err)
+	// Cancel long scans and watchers cleanly on Ctrl-C.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if err := checkPrefixes(); err != nil {
+		log.Fatalf("%v", err)
 	}
-	defer func(db *badger.DB) {
-		err := db.Close()
-		if err != nil {
+	if err := runCommand(ctx, os.Args[1:]); err != nil {
+		log.Fatalf("%v", err)
+	}
+}
 
-		}
-	}(db)
+// errStopIteration can be returned by the callback passed to
+// _iterateKeysForPrefixWithTxn to stop iterating without an error.
+var errStopIteration = errors.New("stop iteration")
+
+// iterateOptions controls which keys _iterateKeysForPrefixWithTxn visits.
+type iterateOptions struct {
+	// KeysOnly skips reading values, the callback is passed a nil value.
+	KeysOnly bool
+	// Start and End are full keys, including the prefix, that bound the
+	// iteration. Start is inclusive and End is exclusive. Either can be nil.
+	Start []byte
+	End   []byte
+	// Reverse visits keys from the largest to the smallest.
+	Reverse bool
+	// Limit stops the iteration after this many keys, 0 means no limit.
+	Limit int
+}
 
-	var newTnx = db.NewTransaction(false)
-	prefixes := GetPrefixes()
-	prefixElements := reflect.ValueOf(prefixes).Elem()
-	structFields := prefixElements.Type()
+// _iterateKeysForPrefixWithTxn calls fn for every key stored under dbPrefix
+// without holding more than one key and value in memory. The slices passed to
+// fn are only valid until it returns, so fn must copy anything it keeps.
+func _iterateKeysForPrefixWithTxn(ctx context.Context, txn kvTxn, dbPrefix []byte,
+	opts *iterateOptions, fn func(key []byte, val []byte) error) error {
 
-	for i := 0; i < prefixElements.NumField(); i++ {
-		field := prefixElements.Field(i)
-		fieldName := structFields.Field(i).Name
+	if opts == nil {
+		opts = &iterateOptions{}
+	}
+	nodeIterator := txn.NewIterator(kvIteratorOptions{
+		Prefix:         dbPrefix,
+		PrefetchValues: !opts.KeysOnly,
+		Reverse:        opts.Reverse,
+	})
+	defer nodeIterator.Close()
 
-		// if fieldName is not than continue "PrefixMempoolTxnHashToMsgDeSoTxn"
-		if fieldName != "PrefixMempoolTxnHashToMsgDeSoTxn" {
-			//log the prefix
-			fmt.Printf("Field Name: %s, Prefix ID: %v\n", fieldName, field.Bytes())
-			continue
+	// Going forward we seek to the first key >= seekKey. Going backwards we
+	// seek to the last key <= seekKey, so we start from just past the end of
+	// the range and skip the end key itself since End is exclusive.
+	seekKey := dbPrefix
+	if !opts.Reverse && opts.Start != nil && bytes.Compare(opts.Start, seekKey) > 0 {
+		seekKey = opts.Start
+	}
+	if opts.Reverse {
+		seekKey = _prefixUpperBound(dbPrefix)
+		if opts.End != nil && bytes.Compare(opts.End, seekKey) < 0 {
+			seekKey = opts.End
 		}
-		fmt.Printf("Field Name: %s, Prefix ID: %v\n", fieldName, field.Bytes())
-		prefixCopy := append([]byte{}, field.Bytes()...)
+	}
 
-		txn, _, err := _enumerateKeysForPrefixWithTxn(newTnx, prefixCopy)
-		if err != nil {
-			return
-		}
+	nodeIterator.Seek(seekKey)
+	// Backwards, Seek lands on seekKey itself when it exists. The upper bound
+	// of dbPrefix is the first key of the next prefix, such as [4] for [3],
+	// and doesn't start with dbPrefix, which would end the loop before it
+	// starts. No other key lies between it and the last key of dbPrefix, so
+	// one step is enough.
+	if opts.Reverse && nodeIterator.HasItem() && !nodeIterator.ValidForPrefix(dbPrefix) {
+		nodeIterator.Next()
+	}
 
-		for i, key := range txn {
-			log.Printf("Key: %s, Value: %s\n", key, i)
+	visited := 0
+	for ; nodeIterator.ValidForPrefix(dbPrefix); nodeIterator.Next() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		key := nodeIterator.Key()
+		if opts.End != nil && bytes.Compare(key, opts.End) >= 0 {
+			if opts.Reverse {
+				continue
+			}
+			break
+		}
+		if opts.Start != nil && bytes.Compare(key, opts.Start) < 0 {
+			if opts.Reverse {
+				break
+			}
+			continue
 		}
 
-		// log the length of the transactions
-		log.Printf("Length of transactions: %d\n", len(txn))
+		var val []byte
+		if !opts.KeysOnly {
+			var err error
+			if val, err = nodeIterator.Value(); err != nil {
+				return err
+			}
+		}
+		if err := fn(key, val); err != nil {
+			if err == errStopIteration {
+				return nil
+			}
+			return err
+		}
+		visited++
+		if opts.Limit > 0 && visited >= opts.Limit {
+			break
+		}
 	}
+	return nil
+}
 
+// _prefixUpperBound returns the smallest key that is larger than every key
+// starting with dbPrefix.
+func _prefixUpperBound(dbPrefix []byte) []byte {
+	upperBound := append([]byte{}, dbPrefix...)
+	for ii := len(upperBound) - 1; ii >= 0; ii-- {
+		if upperBound[ii] < 0xff {
+			upperBound[ii]++
+			return upperBound[:ii+1]
+		}
+	}
+	// The prefix is all 0xff bytes, so no key of the same length is larger.
+	// Pad it instead, which is larger than any key badger will hold.
+	return append(upperBound, bytes.Repeat([]byte{0xff}, 1<<16)...)
 }
 
-func _enumerateKeysForPrefixWithTxn(txn *badger.Txn, dbPrefix []byte) (_keysFound [][]byte, _valsFound [][]byte, _err error) {
+// _enumerateKeysForPrefixWithTxn returns every key and value stored under
+// dbPrefix. It loads the whole prefix into memory, so it should only be used on
+// small prefixes. Use _iterateKeysForPrefixWithTxn for everything else.
+func _enumerateKeysForPrefixWithTxn(txn kvTxn, dbPrefix []byte) (_keysFound [][]byte, _valsFound [][]byte, _err error) {
 	var keysFound [][]byte
 	var valsFound [][]byte
 
-	opts := badger.DefaultIteratorOptions
-	nodeIterator := txn.NewIterator(opts)
-	defer nodeIterator.Close()
-	prefix := dbPrefix
-	for nodeIterator.Seek(prefix); nodeIterator.ValidForPrefix(prefix); nodeIterator.Next() {
-		key := nodeIterator.Item().Key()
-		keyCopy := make([]byte, len(key))
-		copy(keyCopy[:], key[:])
-
-		valCopy, err := nodeIterator.Item().ValueCopy(nil)
-		if err != nil {
-			return nil, nil, err
-		}
-		keysFound = append(keysFound, keyCopy)
-		valsFound = append(valsFound, valCopy)
+	err := _iterateKeysForPrefixWithTxn(context.Background(), txn, dbPrefix, nil, func(key []byte, val []byte) error {
+		keysFound = append(keysFound, append([]byte{}, key...))
+		valsFound = append(valsFound, val)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
 	}
 	return keysFound, valsFound, nil
 }
 
+var (
+	dbPrefixesOnce sync.Once
+	dbPrefixes     *DBPrefixes
+	dbPrefixesErr  error
+)
+
 // GetPrefixes loads all prefix_id byte array values into a DBPrefixes struct, and returns it.
+// The struct is only loaded once and shared by every caller, so it must not be modified.
+// If a tag is unknown or malformed, or two prefixes share an id, every field is left nil;
+// checkPrefixes returns why, and main runs it before any command.
 func GetPrefixes() *DBPrefixes {
-	prefixes := &DBPrefixes{}
-
-	// Iterate over all DBPrefixes fields and parse their prefix_id tags.
-	prefixElements := reflect.ValueOf(prefixes).Elem()
-	structFields := prefixElements.Type()
-	for i := 0; i < structFields.NumField(); i++ {
-		prefixField := prefixElements.Field(i)
-		prefixId := getPrefixIdValue(structFields.Field(i), prefixField.Type())
-		prefixField.Set(prefixId)
-	}
-	return prefixes
+	loadPrefixes()
+	return dbPrefixes
 }
 
-// getPrefixIdValue parses the DBPrefixes struct tags to fetch the prefix_id values.
-func getPrefixIdValue(structFields reflect.StructField, fieldType reflect.Type) (prefixId reflect.Value) {
-	var ref reflect.Value
-	// Get the prefix_id tag and parse it as byte array.
-	if value := structFields.Tag.Get("prefix_id"); value != "-" {
-		ref = reflect.New(fieldType)
-		ref.Elem().Set(reflect.MakeSlice(fieldType, 0, 0))
-		if value != "" && value != "[]" {
-			if err := json.Unmarshal([]byte(value), ref.Interface()); err != nil {
-				panic(any(err))
-			}
+// checkPrefixes returns the error GetPrefixes ran into loading DBPrefixes, if any.
+func checkPrefixes() error {
+	loadPrefixes()
+	return dbPrefixesErr
+}
+
+func loadPrefixes() {
+	dbPrefixesOnce.Do(func() {
+		dbPrefixes = &DBPrefixes{}
+		if err := fillPrefixes(dbPrefixes); err != nil {
+			dbPrefixesErr = fmt.Errorf("GetPrefixes: %v", err)
 		}
-	} else {
-		panic(any(fmt.Errorf("prefix_id cannot be empty")))
-	}
-	return ref.Elem()
+	})
 }
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// newTestDB returns an in-memory DB holding keys, each stored with itself as
+// the value.
+func newTestDB(t *testing.T, keys ...[]byte) kvDB {
+	t.Helper()
+	entries := make(map[string][]byte)
+	for _, key := range keys {
+		entries[string(key)] = key
+	}
+	return newTestDBWithEntries(t, entries)
+}
+
+// newTestDBWithEntries returns an in-memory DB holding entries, which map
+// keys to values.
+func newTestDBWithEntries(t *testing.T, entries map[string][]byte) kvDB {
+	t.Helper()
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	if err != nil {
+		t.Fatalf("opening an in-memory DB: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	err = db.Update(func(txn *badger.Txn) error {
+		for key, val := range entries {
+			if err := txn.Set([]byte(key), val); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("seeding the DB: %v", err)
+	}
+	return &badgerV4DB{db: db}
+}
+
+// runCommandOutput runs the command in args and returns what it printed.
+func runCommandOutput(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = writer
+	defer func() { os.Stdout = stdout }()
+	output := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(reader)
+		output <- string(data)
+	}()
+	err = runCommand(context.Background(), args)
+	writer.Close()
+	return <-output, err
+}
+
+func TestIterateKeysForPrefix(t *testing.T) {
+	// The prefixes on both sides of [3] hold keys too, including the one
+	// byte keys a reverse scan of [3] seeks to, and so does [3, 0xff].
+	db := newTestDB(t,
+		[]byte{2}, []byte{2, 1},
+		[]byte{3, 1}, []byte{3, 2}, []byte{3, 2, 0}, []byte{3, 0xff}, []byte{3, 0xff, 0xff},
+		[]byte{4}, []byte{4, 1},
+	)
+	tests := []struct {
+		name   string
+		prefix []byte
+		opts   *iterateOptions
+		want   [][]byte
+	}{
+		{"forward", []byte{3}, nil,
+			[][]byte{{3, 1}, {3, 2}, {3, 2, 0}, {3, 0xff}, {3, 0xff, 0xff}}},
+		{"reverse", []byte{3}, &iterateOptions{Reverse: true},
+			[][]byte{{3, 0xff, 0xff}, {3, 0xff}, {3, 2, 0}, {3, 2}, {3, 1}}},
+		{"reverse with a trailing 0xff prefix", []byte{3, 0xff}, &iterateOptions{Reverse: true},
+			[][]byte{{3, 0xff, 0xff}, {3, 0xff}}},
+		{"reverse past the last prefix", []byte{4}, &iterateOptions{Reverse: true},
+			[][]byte{{4, 1}, {4}}},
+		{"bounds", []byte{3}, &iterateOptions{Start: []byte{3, 2}, End: []byte{3, 0xff}},
+			[][]byte{{3, 2}, {3, 2, 0}}},
+		{"reverse bounds", []byte{3}, &iterateOptions{Start: []byte{3, 2}, End: []byte{3, 0xff}, Reverse: true},
+			[][]byte{{3, 2, 0}, {3, 2}}},
+		{"reverse with an end past the prefix", []byte{3}, &iterateOptions{End: []byte{4, 1}, Reverse: true},
+			[][]byte{{3, 0xff, 0xff}, {3, 0xff}, {3, 2, 0}, {3, 2}, {3, 1}}},
+		{"reverse limit", []byte{3}, &iterateOptions{Reverse: true, Limit: 2},
+			[][]byte{{3, 0xff, 0xff}, {3, 0xff}}},
+		{"keys only", []byte{2}, &iterateOptions{KeysOnly: true},
+			[][]byte{{2}, {2, 1}}},
+		{"empty prefix", []byte{5}, &iterateOptions{Reverse: true}, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var got [][]byte
+			err := db.View(func(txn kvTxn) error {
+				return _iterateKeysForPrefixWithTxn(context.Background(), txn, test.prefix, test.opts, func(key []byte, val []byte) error {
+					if test.opts != nil && test.opts.KeysOnly && val != nil {
+						t.Errorf("got value %x for %x with KeysOnly", val, key)
+					}
+					if (test.opts == nil || !test.opts.KeysOnly) && !bytes.Equal(key, val) {
+						t.Errorf("got value %x for %x", val, key)
+					}
+					got = append(got, append([]byte{}, key...))
+					return nil
+				})
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(test.want) {
+				t.Fatalf("got keys %x, want %x", got, test.want)
+			}
+			for ii := range got {
+				if !bytes.Equal(got[ii], test.want[ii]) {
+					t.Fatalf("got keys %x, want %x", got, test.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// mempoolTxnHandler is called once for every transaction that shows up in the
+// mempool while a mempoolWatcher is running. db is the DB the transaction was
+// read from, which stays open until the handler returns.
+type mempoolTxnHandler func(db kvDB, txnHash BlockHash, txn *MsgDeSoTxn) error
+
+// errTxnPending is returned by a mempoolTxnHandler that handed the txn on to
+// be finished later, such as to the webhook's workers. The txn is then only
+// saved as seen once txnDone is called for it.
+var errTxnPending = errors.New("txn pending")
+
+// mempoolDBOpener opens the node's DB as it is now, see dbPoller.
+type mempoolDBOpener func() (kvDB, error)
+
+// mempoolWatcher detects transactions as they are added to
+// PrefixMempoolTxnHashToMsgDeSoTxn and hands each of them to a handler once.
+//
+// New keys are picked up by polling. The DB is opened again for every poll,
+// since a DB opened once never sees what the node writes after that.
+type mempoolWatcher struct {
+	open     mempoolDBOpener
+	prefix   []byte
+	interval time.Duration
+	handler  mempoolTxnHandler
+
+	// When set, the transactions already in the mempool when the watcher
+	// starts for the first time are handled too. Otherwise they are only
+	// marked as seen. A watcher that saved its seen set before handles
+	// whatever arrived while it was down either way.
+	backfill bool
+	// store keeps the seen set across restarts. When nil it is only kept in
+	// memory.
+	store *seenStore
+
+	// mtx guards seen and poll. txnDone is called from other goroutines, such
+	// as the webhook's workers.
+	mtx sync.Mutex
+	// seen maps the hash of every transaction we have handled, or are still
+	// handling, to the last poll it was still in the mempool. Hashes that
+	// drop out of the mempool are forgotten so the set doesn't grow forever.
+	seen map[BlockHash]uint64
+	poll uint64
+}
+
+func newMempoolWatcher(open mempoolDBOpener, interval time.Duration, handler mempoolTxnHandler) *mempoolWatcher {
+	return &mempoolWatcher{
+		open:     open,
+		prefix:   GetPrefixes().PrefixMempoolTxnHashToMsgDeSoTxn,
+		interval: interval,
+		handler:  handler,
+		seen:     make(map[BlockHash]uint64),
+	}
+}
+
+// Run watches the mempool until ctx is cancelled or reading the DB fails.
+// Transactions whose handler fails are handled again on the next poll, for as
+// long as they stay in the mempool.
+func (mw *mempoolWatcher) Run(ctx context.Context) error {
+	if err := mw.start(ctx); err != nil {
+		return err
+	}
+	ticker := time.NewTicker(mw.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := mw.pollOnce(ctx, true); err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+				return err
+			}
+		}
+	}
+}
+
+// start loads the saved seen set and makes the first poll. backfill decides
+// what happens to the transactions that are already there, unless a watcher
+// ran before.
+func (mw *mempoolWatcher) start(ctx context.Context) error {
+	handleExisting := mw.backfill
+	if mw.store != nil {
+		hashes, started, err := mw.store.Load()
+		if err != nil {
+			return err
+		}
+		// The saved hashes get poll 0, so the first poll forgets the ones
+		// that left the mempool while we were down.
+		for txnHash := range hashes {
+			mw.seen[txnHash] = 0
+		}
+		handleExisting = handleExisting || started
+	}
+	if err := mw.pollOnce(ctx, handleExisting); err != nil {
+		return err
+	}
+	if mw.store != nil {
+		return mw.store.Add()
+	}
+	return nil
+}
+
+// pollOnce reads the keys of the mempool prefix and handles the transactions
+// we have not seen yet. When handle is false they are only marked as seen.
+func (mw *mempoolWatcher) pollOnce(ctx context.Context, handle bool) error {
+	db, err := mw.open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	mw.mtx.Lock()
+	mw.poll++
+	poll := mw.poll
+	mw.mtx.Unlock()
+
+	type newTxn struct {
+		hash BlockHash
+		key  []byte
+		val  []byte
+	}
+	var newTxns []*newTxn
+	var skipped []BlockHash
+	err = db.View(func(txn kvTxn) error {
+		iterOpts := &iterateOptions{KeysOnly: true}
+		err := _iterateKeysForPrefixWithTxn(ctx, txn, mw.prefix, iterOpts, func(key []byte, _ []byte) error {
+			txnHash, err := mempoolTxnHashFromKey(key)
+			if err != nil {
+				return err
+			}
+			mw.mtx.Lock()
+			_, seen := mw.seen[txnHash]
+			if seen || !handle {
+				mw.seen[txnHash] = poll
+			}
+			mw.mtx.Unlock()
+			switch {
+			case seen:
+			case handle:
+				newTxns = append(newTxns, &newTxn{hash: txnHash, key: append([]byte{}, key...)})
+			default:
+				skipped = append(skipped, txnHash)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, nt := range newTxns {
+			val, err := txn.Get(nt.key)
+			if err == errKeyNotFound {
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("mempoolWatcher.pollOnce: Problem getting txn %v: %v", nt.hash, err)
+			}
+			nt.val = val
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if mw.store != nil && len(skipped) > 0 {
+		if err := mw.store.Add(skipped...); err != nil {
+			return fmt.Errorf("mempoolWatcher.pollOnce: Problem saving seen txns: %v", err)
+		}
+	}
+
+	// The handler may be slow, so it runs after the read txn is closed.
+	for _, nt := range newTxns {
+		if nt.val != nil {
+			if err := mw.handleTxn(db, nt.hash, nt.val, poll); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Forget the transactions that have left the mempool since the last poll.
+	var gone []BlockHash
+	mw.mtx.Lock()
+	for txnHash, lastPoll := range mw.seen {
+		if lastPoll < poll {
+			delete(mw.seen, txnHash)
+			gone = append(gone, txnHash)
+		}
+	}
+	mw.mtx.Unlock()
+	if mw.store != nil && len(gone) > 0 {
+		if err := mw.store.Remove(gone...); err != nil {
+			return fmt.Errorf("mempoolWatcher.pollOnce: Problem forgetting txns: %v", err)
+		}
+	}
+	return nil
+}
+
+// handleTxn decodes a mempool value and passes it to the handler. The hash
+// is marked as seen while the handler runs, and is only saved once the
+// handler succeeds, or once txnDone is called if the handler returns
+// errTxnPending. A failed txn is forgotten so the next poll handles it again.
+// The error returned is that of saving the hash, the handler's is only
+// logged.
+func (mw *mempoolWatcher) handleTxn(db kvDB, txnHash BlockHash, val []byte, poll uint64) error {
+	mw.mtx.Lock()
+	mw.seen[txnHash] = poll
+	mw.mtx.Unlock()
+
+	txn := &MsgDeSoTxn{}
+	if err := txn.FromBytes(val); err != nil {
+		// It would fail the same way on every poll.
+		log.Printf("mempoolWatcher: Problem decoding txn %v, skipping it: %v", txnHash, err)
+	} else if err := mw.handler(db, txnHash, txn); err == errTxnPending {
+		return nil
+	} else if err != nil {
+		log.Printf("mempoolWatcher: Problem handling txn %v, retrying on the next poll: %v", txnHash, err)
+		mw.forget(txnHash)
+		return nil
+	}
+	return mw.save(txnHash)
+}
+
+// txnDone finishes a txn whose handler returned errTxnPending. With a nil err
+// the txn is saved as seen, otherwise it is forgotten so the next poll
+// handles it again if it is still in the mempool.
+func (mw *mempoolWatcher) txnDone(txnHash BlockHash, err error) {
+	if err != nil {
+		log.Printf("mempoolWatcher: Txn %v was not delivered, retrying on the next poll: %v", txnHash, err)
+		mw.forget(txnHash)
+		return
+	}
+	if err := mw.save(txnHash); err != nil {
+		log.Printf("%v", err)
+	}
+}
+
+// save adds txnHash to the store, unless it left the mempool in the meantime.
+func (mw *mempoolWatcher) save(txnHash BlockHash) error {
+	mw.mtx.Lock()
+	_, seen := mw.seen[txnHash]
+	mw.mtx.Unlock()
+	if mw.store == nil || !seen {
+		return nil
+	}
+	if err := mw.store.Add(txnHash); err != nil {
+		return fmt.Errorf("mempoolWatcher: Problem saving txn %v as seen: %v", txnHash, err)
+	}
+	return nil
+}
+
+func (mw *mempoolWatcher) forget(txnHash BlockHash) {
+	mw.mtx.Lock()
+	delete(mw.seen, txnHash)
+	mw.mtx.Unlock()
+}
+
+// mempoolTxnHashFromKey returns the txn hash at the end of a
+// PrefixMempoolTxnHashToMsgDeSoTxn key, after the prefix and time added.
+func mempoolTxnHashFromKey(key []byte) (BlockHash, error) {
+	var txnHash BlockHash
+	if len(key) < len(txnHash) {
+		return txnHash, fmt.Errorf("mempoolTxnHashFromKey: key %x is too short", key)
+	}
+	copy(txnHash[:], key[len(key)-len(txnHash):])
+	return txnHash, nil
+}
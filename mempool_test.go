@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/deso-protocol/core/lib"
+	"github.com/dgraph-io/badger/v4"
+)
+
+// testMempoolTxn returns a basic transfer from the key ending in id, and the
+// value core stores for it under PrefixMempoolTxnHashToMsgDeSoTxn.
+func testMempoolTxn(t *testing.T, id byte) (BlockHash, []byte) {
+	t.Helper()
+	coreTxn := &lib.MsgDeSoTxn{
+		TxnMeta:   &lib.BasicTransferMetadata{},
+		PublicKey: testPublicKey(id),
+	}
+	val, err := coreTxn.ToBytes(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var txnHash BlockHash
+	copy(txnHash[:], bytes.Repeat([]byte{id}, len(txnHash)))
+	return txnHash, val
+}
+
+// TestMempoolWatcherSnapshot watches the mempool of a DB that is held open
+// and written to, like the DB of a running node, through a snapshot.
+func TestMempoolWatcherSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	node, err := badger.Open(badger.DefaultOptions(dir).WithLogger(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer node.Close()
+	addTxn := func(id byte) BlockHash {
+		t.Helper()
+		txnHash, val := testMempoolTxn(t, id)
+		err := node.Update(func(txn *badger.Txn) error {
+			return txn.Set(mempoolKey(uint64(id), txnHash[:]), val)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return txnHash
+	}
+
+	poller := newDBPoller(dir, openModeSnapshot, t.TempDir())
+	defer poller.Close()
+	var handled []BlockHash
+	watcher := newMempoolWatcher(func() (kvDB, error) {
+		return poller.Open()
+	}, 0, func(db kvDB, txnHash BlockHash, txn *MsgDeSoTxn) error {
+		// The DB the txn was read from is still open.
+		if err := db.View(func(kvTxn) error { return nil }); err != nil {
+			return err
+		}
+		handled = append(handled, txnHash)
+		return nil
+	})
+
+	addTxn(1)
+	if err := watcher.pollOnce(context.Background(), false); err != nil {
+		t.Fatal(err)
+	}
+	want := addTxn(2)
+	if err := watcher.pollOnce(context.Background(), true); err != nil {
+		t.Fatal(err)
+	}
+	if len(handled) != 1 || handled[0] != want {
+		t.Errorf("handled %v, want only %v", handled, want)
+	}
+}
+
+// testMempoolDB is an in-memory badger DB the mempool is written to, read
+// through the watcher's opener like the node's DB.
+type testMempoolDB struct {
+	t  *testing.T
+	db *badger.DB
+}
+
+// nopCloseDB keeps the watcher from closing the DB the test writes to.
+type nopCloseDB struct {
+	kvDB
+}
+
+func (nopCloseDB) Close() error {
+	return nil
+}
+
+func newTestMempoolDB(t *testing.T) *testMempoolDB {
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return &testMempoolDB{t: t, db: db}
+}
+
+func (mdb *testMempoolDB) open() (kvDB, error) {
+	return nopCloseDB{&badgerV4DB{db: mdb.db}}, nil
+}
+
+func (mdb *testMempoolDB) add(id byte) BlockHash {
+	mdb.t.Helper()
+	txnHash, val := testMempoolTxn(mdb.t, id)
+	err := mdb.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(mempoolKey(uint64(id), txnHash[:]), val)
+	})
+	if err != nil {
+		mdb.t.Fatal(err)
+	}
+	return txnHash
+}
+
+func (mdb *testMempoolDB) remove(id byte) {
+	mdb.t.Helper()
+	txnHash, _ := testMempoolTxn(mdb.t, id)
+	err := mdb.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete(mempoolKey(uint64(id), txnHash[:]))
+	})
+	if err != nil {
+		mdb.t.Fatal(err)
+	}
+}
+
+// TestMempoolWatcherHandlerError checks that a txn whose handler fails is
+// handled again by the next poll, and only until it succeeds.
+func TestMempoolWatcherHandlerError(t *testing.T) {
+	mdb := newTestMempoolDB(t)
+	calls := 0
+	watcher := newMempoolWatcher(mdb.open, 0, func(db kvDB, txnHash BlockHash, txn *MsgDeSoTxn) error {
+		calls++
+		if calls == 1 {
+			return fmt.Errorf("webhook is down")
+		}
+		return nil
+	})
+	mdb.add(1)
+	for poll := 1; poll <= 3; poll++ {
+		if err := watcher.pollOnce(context.Background(), true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if calls != 2 {
+		t.Errorf("the handler was called %d times, want 2", calls)
+	}
+}
+
+// TestMempoolWatcherRestart runs a watcher, stops it and starts another on
+// the same seen set. The second one must skip what the first handled and
+// handle what arrived in between, backfill or not.
+func TestMempoolWatcherRestart(t *testing.T) {
+	mdb := newTestMempoolDB(t)
+	storeDir := t.TempDir()
+	var handled []BlockHash
+	run := func(polls int, backfill bool) {
+		t.Helper()
+		store, err := openSeenStore(storeDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer store.Close()
+		watcher := newMempoolWatcher(mdb.open, 0, func(db kvDB, txnHash BlockHash, txn *MsgDeSoTxn) error {
+			handled = append(handled, txnHash)
+			return nil
+		})
+		watcher.backfill = backfill
+		watcher.store = store
+		if err := watcher.start(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		for ; polls > 0; polls-- {
+			if err := watcher.pollOnce(context.Background(), true); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// The first run skips what is there already, unless it backfills.
+	mdb.add(1)
+	run(0, false)
+	if len(handled) != 0 {
+		t.Fatalf("handled %v on the first run without backfill", handled)
+	}
+	second := mdb.add(2)
+	run(1, false)
+	// 1 leaves the mempool while the watcher is down and 3 arrives.
+	mdb.remove(1)
+	third := mdb.add(3)
+	run(1, false)
+	if want := []BlockHash{second, third}; !reflect.DeepEqual(handled, want) {
+		t.Errorf("handled %v, want %v", handled, want)
+	}
+
+	store, err := openSeenStore(storeDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	hashes, started, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[BlockHash]bool{second: true, third: true}
+	if !started || !reflect.DeepEqual(hashes, want) {
+		t.Errorf("saved %v (started %v), want %v", hashes, started, want)
+	}
+}
+
+// TestMempoolWatcherPending hands txns on with errTxnPending. They must not
+// be handled again while pending, and only be saved as seen once done.
+func TestMempoolWatcherPending(t *testing.T) {
+	mdb := newTestMempoolDB(t)
+	store, err := openSeenStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	calls := make(map[BlockHash]int)
+	watcher := newMempoolWatcher(mdb.open, 0, func(db kvDB, txnHash BlockHash, txn *MsgDeSoTxn) error {
+		calls[txnHash]++
+		return errTxnPending
+	})
+	watcher.store = store
+	saved := func() map[BlockHash]bool {
+		t.Helper()
+		hashes, _, err := store.Load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return hashes
+	}
+
+	delivered, failed := mdb.add(1), mdb.add(2)
+	for poll := 1; poll <= 2; poll++ {
+		if err := watcher.pollOnce(context.Background(), true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if calls[delivered] != 1 || calls[failed] != 1 || len(saved()) != 0 {
+		t.Fatalf("got calls %v and saved %v while pending, want one call each and nothing saved", calls, saved())
+	}
+
+	watcher.txnDone(delivered, nil)
+	watcher.txnDone(failed, fmt.Errorf("dead-lettering failed"))
+	if err := watcher.pollOnce(context.Background(), true); err != nil {
+		t.Fatal(err)
+	}
+	if want := map[BlockHash]bool{delivered: true}; !reflect.DeepEqual(saved(), want) {
+		t.Errorf("saved %v, want %v", saved(), want)
+	}
+	if calls[delivered] != 1 || calls[failed] != 2 {
+		t.Errorf("got calls %v, want the failed txn handled again", calls)
+	}
+
+	// A txn that leaves the mempool while pending isn't saved.
+	mdb.remove(2)
+	if err := watcher.pollOnce(context.Background(), true); err != nil {
+		t.Fatal(err)
+	}
+	watcher.txnDone(failed, nil)
+	if _, exists := saved()[failed]; exists {
+		t.Error("a txn that left the mempool was saved")
+	}
+}
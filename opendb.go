@@ -0,0 +1,366 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// The ways openNodeDB can open the node's DB. None of them ever writes to
+// the directory the node owns.
+const (
+	// openModeReadOnly opens the directory itself with badger's ReadOnly
+	// option. That takes a shared lock on it, so it fails while the node has
+	// it open, and it refuses memtables that weren't flushed by a clean
+	// shutdown.
+	openModeReadOnly = "readonly"
+	// openModeSnapshot copies the directory first and opens the copy, which
+	// works while the node is running. The copy is removed on Close.
+	openModeSnapshot = "snapshot"
+	// openModeAuto opens the directory read-only, and reads a snapshot instead
+	// while the node holds its lock or where badger can't open it read-only.
+	openModeAuto = "auto"
+)
+
+// errDirLocked is returned by checkDirLock.
+var errDirLocked = errors.New("the directory is locked by another process")
+
+// nodeDB is the node's DB as opened by openNodeDB or a dbPoller.
+type nodeDB struct {
+	kvDB
+	// Format is the format detected from the MANIFEST.
+	Format *badgerFormat
+	// poller is the poller openNodeDB opened the DB with, which is closed
+	// along with it to remove its snapshot.
+	poller *dbPoller
+}
+
+// Close closes the DB and removes its snapshot, if it has one of its own.
+func (db *nodeDB) Close() error {
+	err := db.kvDB.Close()
+	if db.poller != nil {
+		if closeErr := db.poller.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// openNodeDB opens dir in the given mode, with the format detected from its
+// MANIFEST. Snapshots are created under snapshotParent, or the temp dir if it
+// is empty.
+func openNodeDB(dir string, mode string, snapshotParent string) (*nodeDB, error) {
+	poller := newDBPoller(dir, mode, snapshotParent)
+	db, err := poller.Open()
+	if err != nil {
+		poller.Close()
+		return nil, err
+	}
+	db.poller = poller
+	return db, nil
+}
+
+// dbPoller opens the node's DB again for every poll of a command that keeps
+// running, so that each poll sees what the node wrote since the last one. A
+// DB opened once would not: a read-only open only sees what was on disk when
+// it was opened, and a snapshot is frozen when it is copied.
+//
+// In snapshot mode the poller keeps a single snapshot and refreshes it before
+// every open, which only copies the files that changed since. In read-only
+// mode every open fails while the node is running, just like the first one.
+// In auto mode the poller switches to snapshots the first time a read-only
+// open fails, and keeps to them.
+type dbPoller struct {
+	dir            string
+	mode           string
+	snapshotParent string
+	snapshot       *dbSnapshot
+}
+
+func newDBPoller(dir string, mode string, snapshotParent string) *dbPoller {
+	return &dbPoller{dir: dir, mode: mode, snapshotParent: snapshotParent}
+}
+
+// Open opens the DB as it is now. The DB has to be closed before the next
+// call to Open.
+func (p *dbPoller) Open() (*nodeDB, error) {
+	format, err := detectBadgerFormat(p.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	switch p.mode {
+	case openModeReadOnly:
+		db, err := p.openReadOnly(format)
+		if err != nil {
+			return nil, explainOpenError(p.dir, err)
+		}
+		return db, nil
+
+	case openModeAuto:
+		if p.snapshot == nil {
+			db, err := p.openReadOnly(format)
+			if err == nil {
+				return db, nil
+			}
+			if !needsSnapshot(err) {
+				return nil, explainOpenError(p.dir, err)
+			}
+			log.Printf("openNodeDB: Can't open %s read-only, reading a snapshot of it instead: %v", p.dir, firstLine(err))
+		}
+		return p.openSnapshot(format)
+
+	case openModeSnapshot:
+		return p.openSnapshot(format)
+	}
+	return nil, fmt.Errorf("openNodeDB: unknown open mode %q, expected %s, %s or %s",
+		p.mode, openModeAuto, openModeReadOnly, openModeSnapshot)
+}
+
+func (p *dbPoller) openReadOnly(format *badgerFormat) (*nodeDB, error) {
+	if err := checkDirLock(p.dir); err != nil {
+		return nil, err
+	}
+	db, err := openBadger(p.dir, format, true)
+	if err != nil {
+		return nil, err
+	}
+	return &nodeDB{kvDB: db, Format: format}, nil
+}
+
+func (p *dbPoller) openSnapshot(format *badgerFormat) (*nodeDB, error) {
+	var err error
+	if p.snapshot == nil {
+		p.snapshot, err = newDBSnapshot(p.dir, p.snapshotParent)
+	} else {
+		err = p.snapshot.Refresh()
+	}
+	if err != nil {
+		return nil, err
+	}
+	// The copy is ours, so badger is free to truncate whatever the node
+	// was in the middle of writing when it was taken.
+	db, err := openBadger(p.snapshot.dir, format, false)
+	if err != nil {
+		return nil, fmt.Errorf("openNodeDB: Problem opening snapshot of %s: %v", p.dir, firstLine(err))
+	}
+	return &nodeDB{kvDB: db, Format: format}, nil
+}
+
+// Close removes the snapshot, if any.
+func (p *dbPoller) Close() error {
+	if p.snapshot == nil {
+		return nil
+	}
+	err := p.snapshot.Remove()
+	p.snapshot = nil
+	return err
+}
+
+func openBadger(dir string, format *badgerFormat, readOnly bool) (kvDB, error) {
+	return openBadgerV4(dir, readOnly, format.ExternalMagic)
+}
+
+// needsSnapshot reports whether a read-only open failed in a way reading a
+// snapshot gets around.
+func needsSnapshot(err error) bool {
+	return errors.Is(err, errDirLocked) || errors.Is(err, badger.ErrWindowsNotSupported) ||
+		errors.Is(err, badger.ErrPlan9NotSupported)
+}
+
+// explainOpenError turns the errors of a read-only open that a snapshot gets
+// around into ones that say so. The lock is checked by checkDirLock before
+// badger tries to take it, since badger flattens the errors it wraps into
+// strings.
+func explainOpenError(dir string, err error) error {
+	switch {
+	case errors.Is(err, errDirLocked):
+		return fmt.Errorf("openNodeDB: %s is locked by another process, most likely the running node. "+
+			"Use -open %s or %s to read a copy of it instead", dir, openModeAuto, openModeSnapshot)
+	case errors.Is(err, badger.ErrWindowsNotSupported), errors.Is(err, badger.ErrPlan9NotSupported):
+		return fmt.Errorf("openNodeDB: badger can't open a DB read-only on this OS. "+
+			"Use -open %s or %s to read a copy of %s instead", openModeAuto, openModeSnapshot, dir)
+	}
+	return fmt.Errorf("openNodeDB: Problem opening %s: %v", dir, firstLine(err))
+}
+
+// firstLine drops the stack trace badger appends to some of its errors.
+func firstLine(err error) string {
+	line, _, _ := strings.Cut(err.Error(), "\n")
+	return line
+}
+
+// snapshotAttempts is how many times a snapshot is retried when the node
+// deletes a file while it is being copied.
+const snapshotAttempts = 3
+
+// dbSnapshot is a copy of a badger directory that can be brought up to date
+// without copying all of it again.
+//
+// The MANIFEST is copied first, so every table it lists is still around when
+// the tables are copied unless a compaction removed it in the meantime, in
+// which case the copy is retried. Nothing is hard linked since badger opens
+// the tables of the copy for writing.
+type dbSnapshot struct {
+	src string
+	dir string
+	// files holds every file copied to dir, by name.
+	files map[string]*snapshotFile
+}
+
+// snapshotFile is what a copied file looked like in src when it was copied,
+// and in the snapshot right after. Badger changes the copy too, by truncating
+// value logs and replacing tables, so both have to match for the copy to be
+// reused.
+type snapshotFile struct {
+	src fileStamp
+	dst fileStamp
+}
+
+// fileStamp tells whether a file changed, the way rsync does by default.
+type fileStamp struct {
+	size    int64
+	modTime time.Time
+}
+
+func stampFile(info os.FileInfo) fileStamp {
+	return fileStamp{size: info.Size(), modTime: info.ModTime()}
+}
+
+// newDBSnapshot copies the badger directory src into a new directory under
+// parent.
+func newDBSnapshot(src string, parent string) (*dbSnapshot, error) {
+	dir, err := os.MkdirTemp(parent, "badger-snapshot-")
+	if err != nil {
+		return nil, fmt.Errorf("newDBSnapshot: Problem creating snapshot dir: %v", err)
+	}
+	snapshot := &dbSnapshot{src: src, dir: dir, files: make(map[string]*snapshotFile)}
+	if err := snapshot.Refresh(); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// Refresh brings the snapshot up to date with src. The DB opened from the
+// snapshot has to be closed first.
+func (s *dbSnapshot) Refresh() error {
+	var err error
+	for attempt := 1; attempt <= snapshotAttempts; attempt++ {
+		if err = s.copyChangedFiles(); err == nil || !errors.Is(err, os.ErrNotExist) {
+			break
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("dbSnapshot.Refresh: Problem copying %s: %v", s.src, err)
+	}
+	return nil
+}
+
+// copyChangedFiles copies the files of src that may have changed since they
+// were last copied, and removes the files src no longer has along with those
+// badger created in the snapshot.
+func (s *dbSnapshot) copyChangedFiles() error {
+	if err := s.copyIfChanged("MANIFEST", false); err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(s.src)
+	if err != nil {
+		return err
+	}
+	// Only the last value log is appended to.
+	lastValueLog := ""
+	for _, entry := range entries {
+		if name := entry.Name(); strings.HasSuffix(name, ".vlog") && name > lastValueLog {
+			lastValueLog = name
+		}
+	}
+	inSrc := map[string]bool{"MANIFEST": true}
+	for _, entry := range entries {
+		name := entry.Name()
+		// The LOCK file holds the pid of the node, the copy is unlocked.
+		if entry.IsDir() || name == "MANIFEST" || name == "LOCK" {
+			continue
+		}
+		inSrc[name] = true
+		// Tables and full value logs are never written to again. Memtables
+		// and the last value log are written in place through mmap, at a
+		// size fixed up front, so they are copied every time.
+		reusable := strings.HasSuffix(name, ".sst") || (strings.HasSuffix(name, ".vlog") && name != lastValueLog)
+		if err := s.copyIfChanged(name, reusable); err != nil {
+			return err
+		}
+	}
+
+	copies, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range copies {
+		if name := entry.Name(); !inSrc[name] {
+			if err := os.RemoveAll(filepath.Join(s.dir, name)); err != nil {
+				return err
+			}
+			delete(s.files, name)
+		}
+	}
+	return nil
+}
+
+// copyIfChanged copies a file of src, unless it is reusable and neither side
+// changed since it was last copied.
+func (s *dbSnapshot) copyIfChanged(name string, reusable bool) error {
+	srcPath, dstPath := filepath.Join(s.src, name), filepath.Join(s.dir, name)
+	srcInfo, err := os.Stat(srcPath)
+	if err != nil {
+		return err
+	}
+	if copied := s.files[name]; reusable && copied != nil && copied.src == stampFile(srcInfo) {
+		if dstInfo, err := os.Stat(dstPath); err == nil && copied.dst == stampFile(dstInfo) {
+			return nil
+		}
+	}
+	// A file that fails to copy is copied again on the next refresh.
+	delete(s.files, name)
+	if err := copyFile(srcPath, dstPath); err != nil {
+		return err
+	}
+	dstInfo, err := os.Stat(dstPath)
+	if err != nil {
+		return err
+	}
+	s.files[name] = &snapshotFile{src: stampFile(srcInfo), dst: stampFile(dstInfo)}
+	return nil
+}
+
+// Remove deletes the snapshot.
+func (s *dbSnapshot) Remove() error {
+	return os.RemoveAll(s.dir)
+}
+
+func copyFile(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if err := copyFileData(out, in, info.Size()); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
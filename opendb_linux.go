@@ -0,0 +1,44 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// copyFileData copies the first size bytes of in to out, leaving the holes of
+// in as holes in out. badger preallocates the value log and memtables it
+// writes through mmap as sparse files of up to 2GB, most of which are holes,
+// so copying them byte by byte would write gigabytes on every snapshot.
+func copyFileData(out *os.File, in *os.File, size int64) error {
+	for offset := int64(0); offset < size; {
+		start, err := in.Seek(offset, unix.SEEK_DATA)
+		if errors.Is(err, unix.ENXIO) {
+			// The rest of the file is a hole.
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if start >= size {
+			break
+		}
+		end, err := in.Seek(start, unix.SEEK_HOLE)
+		if err != nil {
+			return err
+		}
+		if end > size {
+			end = size
+		}
+		if _, err := out.Seek(start, io.SeekStart); err != nil {
+			return err
+		}
+		if _, err := io.Copy(out, io.NewSectionReader(in, start, end-start)); err != nil {
+			return err
+		}
+		offset = end
+	}
+	return out.Truncate(size)
+}
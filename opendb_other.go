@@ -0,0 +1,15 @@
+//go:build !linux
+
+package main
+
+import (
+	"io"
+	"os"
+)
+
+// copyFileData copies the first size bytes of in to out. Holes are only
+// skipped on Linux, elsewhere they are copied as zeros.
+func copyFileData(out *os.File, in *os.File, size int64) error {
+	_, err := io.Copy(out, io.LimitReader(in, size))
+	return err
+}
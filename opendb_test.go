@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// TestDBPollerSnapshot polls a DB that is held open and written to, like the
+// DB of a running node, and checks every poll sees the writes made before it.
+func TestDBPollerSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	node, err := badger.Open(badger.DefaultOptions(dir).WithLogger(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer node.Close()
+	set := func(key string) {
+		t.Helper()
+		err := node.Update(func(txn *badger.Txn) error {
+			return txn.Set([]byte(key), []byte(key))
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := newDBPoller(dir, openModeReadOnly, "").Open(); err == nil || !strings.Contains(err.Error(), "is locked by another process") {
+		t.Fatalf("got error %v opening a locked DB read-only, want one saying it is locked", err)
+	}
+	if err := checkDirLock(dir); !errors.Is(err, errDirLocked) {
+		t.Fatalf("got %v checking the lock of an open DB, want errDirLocked", err)
+	}
+
+	poller := newDBPoller(dir, openModeSnapshot, t.TempDir())
+	for _, key := range []string{"first", "second"} {
+		set(key)
+		db, err := poller.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = db.View(func(txn kvTxn) error {
+			_, err := txn.Get([]byte(key))
+			return err
+		})
+		db.Close()
+		if err != nil {
+			t.Fatalf("reading %q from the snapshot: %v", key, err)
+		}
+	}
+
+	snapshotDir := poller.snapshot.dir
+	if err := poller.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(snapshotDir); !os.IsNotExist(err) {
+		t.Errorf("snapshot %s still exists after Close: %v", snapshotDir, err)
+	}
+}
+
+// TestDBPollerAuto checks auto mode opens a DB read-only while no one holds it
+// and reads a snapshot of it once the node does.
+func TestDBPollerAuto(t *testing.T) {
+	dir := t.TempDir()
+	node, err := badger.Open(badger.DefaultOptions(dir).WithLogger(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := node.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	poller := newDBPoller(dir, openModeAuto, t.TempDir())
+	defer poller.Close()
+	db, err := poller.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	if poller.snapshot != nil {
+		t.Fatal("copied a DB no one holds")
+	}
+
+	node, err = badger.Open(badger.DefaultOptions(dir).WithLogger(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer node.Close()
+	db, err = poller.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	if poller.snapshot == nil {
+		t.Error("opened a locked DB without copying it")
+	}
+}
+
+// TestDBSnapshotRefresh checks which files a refresh copies again. Files are
+// rewritten with their old size and mtime, so only the files that are always
+// copied pick up the change.
+func TestDBSnapshotRefresh(t *testing.T) {
+	src := t.TempDir()
+	files := []string{"MANIFEST", "000001.sst", "000001.vlog", "000002.vlog", "00001.mem", "KEYREGISTRY", "LOCK"}
+	write := func(name string, data string) {
+		t.Helper()
+		path := filepath.Join(src, name)
+		info, statErr := os.Stat(path)
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if statErr == nil {
+			if err := os.Chtimes(path, info.ModTime(), info.ModTime()); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	for _, name := range files {
+		write(name, "old")
+	}
+
+	snapshot, err := newDBSnapshot(src, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snapshot.Remove()
+	if _, err := os.Stat(filepath.Join(snapshot.dir, "LOCK")); !os.IsNotExist(err) {
+		t.Errorf("LOCK was copied: %v", err)
+	}
+
+	for _, name := range files {
+		write(name, "new")
+	}
+	if err := os.Remove(filepath.Join(src, "KEYREGISTRY")); err != nil {
+		t.Fatal(err)
+	}
+	write("000002.sst", "new")
+	if err := snapshot.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"MANIFEST":    "new",
+		"000001.sst":  "old",
+		"000002.sst":  "new",
+		"000001.vlog": "old",
+		"000002.vlog": "new",
+		"00001.mem":   "new",
+	}
+	entries, err := os.ReadDir(snapshot.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != len(want) {
+		t.Errorf("got %d files in the snapshot, want %d", len(entries), len(want))
+	}
+	for name, data := range want {
+		got, err := os.ReadFile(filepath.Join(snapshot.dir, name))
+		if err != nil {
+			t.Errorf("reading %s: %v", name, err)
+			continue
+		}
+		if string(got) != data {
+			t.Errorf("got %s %q, want %q", name, got, data)
+		}
+	}
+
+	// A copy badger changed is copied again even if src didn't change.
+	sstCopy := filepath.Join(snapshot.dir, "000001.sst")
+	if err := os.WriteFile(sstCopy, []byte("changed"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := snapshot.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := os.ReadFile(sstCopy); err != nil || string(got) != "new" {
+		t.Errorf("got 000001.sst %q (%v), want %q", got, err, "new")
+	}
+}
+
+// TestCopyFileSparse copies a file with data after a hole and at its end.
+func TestCopyFileSparse(t *testing.T) {
+	dir := t.TempDir()
+	src, dst := filepath.Join(dir, "src"), filepath.Join(dir, "dst")
+	want := make([]byte, 3<<20)
+	copy(want[1<<20:], "middle")
+	copy(want[len(want)-3:], "end")
+	// Only the data is written, so the rest of the file is holes where the
+	// file system supports them.
+	file, err := os.Create(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = file.Truncate(int64(len(want)))
+	if err == nil {
+		_, err = file.WriteAt([]byte("middle"), 1<<20)
+	}
+	if err == nil {
+		_, err = file.WriteAt([]byte("end"), int64(len(want)-3))
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := copyFile(src, dst); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("the copy differs from the file")
+	}
+}
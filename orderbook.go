@@ -0,0 +1,307 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+)
+
+// The sides of the book.
+const (
+	orderBookSideBid = "bid"
+	orderBookSideAsk = "ask"
+)
+
+// orderBookDeSo names DeSo in place of a DAO coin. Core uses the zero PKID
+// for it in limit orders.
+const orderBookDeSo = "DESO"
+
+// exchangeRateScale is the 1e38 core scales DAO coin exchange rates by.
+var exchangeRateScale = new(big.Int).Exp(big.NewInt(10), big.NewInt(38), nil)
+
+// The book is of a base coin priced in a quote coin, both in base units:
+// nanos for DeSo and 1e-18 coins for DAO coins. Prices are quote base units
+// per base unit, as a float and scaled by exchangeRateScale, and quantities
+// are base units of the base coin, whatever coin the order was placed in.
+//
+// Bids are stored under [60] as buying the base coin and selling the quote
+// coin, asks the other way around. An order's operation type only decides
+// which of the two coins its quantity is in.
+
+// orderBookLevel is the depth at one price.
+type orderBookLevel struct {
+	Price          float64 `json:"price"`
+	ScaledPrice    string  `json:"scaledPrice"`
+	Quantity       string  `json:"quantity"`
+	NumberOfOrders int     `json:"numberOfOrders"`
+
+	quantity *big.Int
+}
+
+// orderBookOrder is an open order on one side of the book.
+type orderBookOrder struct {
+	OrderID        *BlockHash `json:"orderID"`
+	TransactorPKID *PKID      `json:"transactorPKID"`
+	Side           string     `json:"side"`
+	Price          float64    `json:"price"`
+	ScaledPrice    string     `json:"scaledPrice"`
+	Quantity       string     `json:"quantity"`
+	// OperationType and QuantityToFillInBaseUnits are as placed, in the
+	// coin the order buys for bids and the coin it sells for asks.
+	OperationType             string `json:"operationType"`
+	QuantityToFillInBaseUnits string `json:"quantityToFillInBaseUnits"`
+	FillType                  string `json:"fillType"`
+	BlockHeight               uint32 `json:"blockHeight"`
+
+	scaledPrice *big.Int
+	quantity    *big.Int
+	rate        *big.Int
+}
+
+// transactorOrders are the open orders of one transactor.
+type transactorOrders struct {
+	TransactorPKID *PKID             `json:"transactorPKID"`
+	Orders         []*orderBookOrder `json:"orders"`
+}
+
+// orderBook is the book of a coin pair. BestBid, BestAsk and Spread are nil
+// while a side is empty. Transactors is only filled in when orders were asked
+// for, see readOrderBookWithTxn.
+type orderBook struct {
+	BasePKID    *PKID               `json:"basePKID"`
+	QuotePKID   *PKID               `json:"quotePKID"`
+	Bids        []*orderBookLevel   `json:"bids"`
+	Asks        []*orderBookLevel   `json:"asks"`
+	BestBid     *float64            `json:"bestBid"`
+	BestAsk     *float64            `json:"bestAsk"`
+	Spread      *float64            `json:"spread"`
+	Transactors []*transactorOrders `json:"transactors,omitempty"`
+}
+
+// orderBookQuery selects what readOrderBookWithTxn reads.
+type orderBookQuery struct {
+	Base  *PKID
+	Quote *PKID
+	// Depth is the number of levels per side, 0 means all of them.
+	Depth int
+	// Orders lists the open orders by transactor. Setting Transactor lists
+	// the orders of that transactor only, read from [61].
+	Orders     bool
+	Transactor *PKID
+}
+
+// resolveCoinWithTxn returns the PKID of the coin query names: DESO, or a
+// username, public key or PKID of a profile.
+func resolveCoinWithTxn(txn kvTxn, query string) (*PKID, error) {
+	if strings.EqualFold(query, orderBookDeSo) {
+		return &PKID{}, nil
+	}
+	pkid, err := resolvePKIDWithTxn(txn, query)
+	if err != nil {
+		return nil, err
+	}
+	if pkid == nil {
+		return nil, fmt.Errorf("no profile for %q", query)
+	}
+	return pkid, nil
+}
+
+// coinName is how a coin of the book is printed.
+func coinName(pkid *PKID) string {
+	if *pkid == (PKID{}) {
+		return orderBookDeSo
+	}
+	return pkid.String()
+}
+
+// readOrderBookWithTxn reads the book of query's pair from [60], best price
+// first on both sides.
+func readOrderBookWithTxn(ctx context.Context, txn kvTxn, query *orderBookQuery) (*orderBook, error) {
+	if *query.Base == *query.Quote {
+		return nil, fmt.Errorf("readOrderBookWithTxn: Base and quote are the same coin %s", coinName(query.Base))
+	}
+	book := &orderBook{BasePKID: query.Base, QuotePKID: query.Quote, Bids: []*orderBookLevel{}, Asks: []*orderBookLevel{}}
+	bids, err := readOrderBookSideWithTxn(ctx, txn, query, true)
+	if err != nil {
+		return nil, err
+	}
+	asks, err := readOrderBookSideWithTxn(ctx, txn, query, false)
+	if err != nil {
+		return nil, err
+	}
+	book.Bids, book.Asks = aggregateOrders(bids, query.Depth), aggregateOrders(asks, query.Depth)
+	if len(book.Bids) > 0 {
+		book.BestBid = &book.Bids[0].Price
+	}
+	if len(book.Asks) > 0 {
+		book.BestAsk = &book.Asks[0].Price
+	}
+	if book.BestBid != nil && book.BestAsk != nil {
+		spread := *book.BestAsk - *book.BestBid
+		book.Spread = &spread
+	}
+
+	if query.Transactor != nil {
+		if book.Transactors, err = readTransactorOrdersWithTxn(ctx, txn, query); err != nil {
+			return nil, err
+		}
+	} else if query.Orders {
+		book.Transactors = groupOrders(append(bids, asks...))
+	}
+	return book, nil
+}
+
+// readOrderBookSideWithTxn returns the bids or asks of query's pair. Core
+// matches the highest exchange rate first and, at the same rate, the oldest
+// order, since heights are stored as MaxUint32 minus the height. Walking
+// [60] backwards gives that order, which is the best price first on both
+// sides.
+func readOrderBookSideWithTxn(ctx context.Context, txn kvTxn, query *orderBookQuery, isBid bool) ([]*orderBookOrder, error) {
+	buying, selling := query.Quote, query.Base
+	if isBid {
+		buying, selling = query.Base, query.Quote
+	}
+	dbPrefix := append(append(append([]byte{}, GetPrefixes().PrefixDAOCoinLimitOrder...), buying[:]...), selling[:]...)
+	var orders []*orderBookOrder
+	err := _iterateKeysForPrefixWithTxn(ctx, txn, dbPrefix, &iterateOptions{Reverse: true}, func(key []byte, val []byte) error {
+		order, err := decodeOrderBookOrder(key, val, isBid)
+		if err != nil || order == nil {
+			return err
+		}
+		orders = append(orders, order)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return orders, nil
+}
+
+// readTransactorOrdersWithTxn returns the orders query.Transactor has open on
+// both sides of the pair, read from [61].
+func readTransactorOrdersWithTxn(ctx context.Context, txn kvTxn, query *orderBookQuery) ([]*transactorOrders, error) {
+	var orders []*orderBookOrder
+	for _, isBid := range []bool{true, false} {
+		buying, selling := query.Quote, query.Base
+		if isBid {
+			buying, selling = query.Base, query.Quote
+		}
+		dbPrefix := append([]byte{}, GetPrefixes().PrefixDAOCoinLimitOrderByTransactorPKID...)
+		dbPrefix = append(append(append(dbPrefix, query.Transactor[:]...), buying[:]...), selling[:]...)
+		err := _iterateKeysForPrefixWithTxn(ctx, txn, dbPrefix, &iterateOptions{}, func(key []byte, val []byte) error {
+			order, err := decodeOrderBookOrder(key, val, isBid)
+			if err != nil || order == nil {
+				return err
+			}
+			orders = append(orders, order)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return groupOrders(orders), nil
+}
+
+// decodeOrderBookOrder decodes a limit order and prices it for its side of
+// the book. It returns nil for orders with a zero exchange rate, which can't
+// be priced.
+func decodeOrderBookOrder(key []byte, val []byte, isBid bool) (*orderBookOrder, error) {
+	entry := &DAOCoinLimitOrderEntry{}
+	exists, err := DecodeFromBytes(entry, bytes.NewReader(val))
+	if err != nil {
+		return nil, fmt.Errorf("decodeOrderBookOrder: Problem decoding %x: %v", key, err)
+	}
+	rate := entry.ScaledExchangeRateCoinsToSellPerCoinToBuy
+	if !exists || rate == nil || rate.Sign() == 0 {
+		return nil, nil
+	}
+	quantity := entry.QuantityToFillInBaseUnits
+	if quantity == nil {
+		quantity = new(big.Int)
+	}
+	opType := DAOCoinLimitOrderOperationType(entry.OperationType)
+
+	// A bid's rate is quote per base already. An ask's rate is base per
+	// quote, so its price is the inverse.
+	order := &orderBookOrder{
+		OrderID:                   entry.OrderID,
+		TransactorPKID:            entry.TransactorPKID,
+		Side:                      orderBookSideBid,
+		OperationType:             opType.String(),
+		QuantityToFillInBaseUnits: quantity.String(),
+		FillType:                  DAOCoinLimitOrderFillType(entry.FillType).String(),
+		BlockHeight:               entry.BlockHeight,
+		scaledPrice:               rate,
+		quantity:                  quantity,
+		rate:                      rate,
+	}
+	if isBid {
+		// A bid placed as an ask sells quantity of the quote coin.
+		if opType == DAOCoinLimitOrderOperationTypeASK {
+			order.quantity = new(big.Int).Div(new(big.Int).Mul(quantity, exchangeRateScale), rate)
+		}
+	} else {
+		order.Side = orderBookSideAsk
+		order.scaledPrice = new(big.Int).Div(new(big.Int).Mul(exchangeRateScale, exchangeRateScale), rate)
+		// An ask placed as a bid buys quantity of the quote coin.
+		if opType == DAOCoinLimitOrderOperationTypeBID {
+			order.quantity = new(big.Int).Div(new(big.Int).Mul(quantity, rate), exchangeRateScale)
+		}
+	}
+	order.Price = scaledToFloat(order.scaledPrice)
+	order.ScaledPrice = order.scaledPrice.String()
+	order.Quantity = order.quantity.String()
+	return order, nil
+}
+
+func scaledToFloat(scaled *big.Int) float64 {
+	price, _ := new(big.Float).Quo(new(big.Float).SetInt(scaled), new(big.Float).SetInt(exchangeRateScale)).Float64()
+	return price
+}
+
+// aggregateOrders sums orders, sorted best price first, into up to depth
+// levels. Ask prices are rounded inverses, so asks are grouped by their
+// exchange rate rather than by scaledPrice.
+func aggregateOrders(orders []*orderBookOrder, depth int) []*orderBookLevel {
+	levels := []*orderBookLevel{}
+	var last *orderBookLevel
+	var lastRate *big.Int
+	for _, order := range orders {
+		if last == nil || lastRate.Cmp(order.rate) != 0 {
+			if depth > 0 && len(levels) == depth {
+				break
+			}
+			last = &orderBookLevel{Price: order.Price, ScaledPrice: order.ScaledPrice, quantity: new(big.Int)}
+			levels = append(levels, last)
+			lastRate = order.rate
+		}
+		last.quantity.Add(last.quantity, order.quantity)
+		last.Quantity = last.quantity.String()
+		last.NumberOfOrders++
+	}
+	return levels
+}
+
+// groupOrders groups orders by transactor, keeping their order within each
+// group, with transactors sorted by PKID.
+func groupOrders(orders []*orderBookOrder) []*transactorOrders {
+	groups := make(map[PKID]*transactorOrders)
+	var grouped []*transactorOrders
+	for _, order := range orders {
+		group := groups[*order.TransactorPKID]
+		if group == nil {
+			group = &transactorOrders{TransactorPKID: order.TransactorPKID}
+			groups[*order.TransactorPKID] = group
+			grouped = append(grouped, group)
+		}
+		group.Orders = append(group.Orders, order)
+	}
+	sort.Slice(grouped, func(ii, jj int) bool {
+		return bytes.Compare(grouped[ii].TransactorPKID[:], grouped[jj].TransactorPKID[:]) < 0
+	})
+	return grouped
+}
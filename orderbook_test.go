@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"math"
+	"math/big"
+	"testing"
+)
+
+// testRate is numerator/denominator scaled by exchangeRateScale.
+func testRate(numerator int64, denominator int64) *big.Int {
+	rate := new(big.Int).Mul(big.NewInt(numerator), exchangeRateScale)
+	return rate.Div(rate, big.NewInt(denominator))
+}
+
+// testLimitOrder is a limit order placed by testPKID(transactor), as core
+// stores it under [60] and [61].
+type testLimitOrder struct {
+	id         byte
+	transactor byte
+	buying     *PKID
+	selling    *PKID
+	rate       *big.Int
+	opType     DAOCoinLimitOrderOperationType
+	quantity   int64
+	height     uint32
+}
+
+func (order *testLimitOrder) value() []byte {
+	return new(testEncoder).header(encoderVersionDefault).blockHash(testBlockHash(order.id)).
+		pkid(testPKID(order.transactor)).pkid(order.buying).pkid(order.selling).
+		uint256(order.rate).uint256(big.NewInt(order.quantity)).
+		uvarint(uint64(order.opType)).uvarint(1).uvarint(uint64(order.height)).Bytes()
+}
+
+func (order *testLimitOrder) bookKey() string {
+	key := append(append([]byte{60}, order.buying[:]...), order.selling[:]...)
+	key = append(key, order.rate.FillBytes(make([]byte, 32))...)
+	key = binary.BigEndian.AppendUint32(key, math.MaxUint32-order.height)
+	return string(append(key, testBlockHash(order.id)[:]...))
+}
+
+func (order *testLimitOrder) transactorKey() string {
+	key := append(append([]byte{61}, testPKID(order.transactor)[:]...), order.buying[:]...)
+	key = append(key, order.selling[:]...)
+	return string(append(key, testBlockHash(order.id)[:]...))
+}
+
+// The test book is of Alice's coin (1) priced in DeSo.
+var (
+	orderBookTestBase  = testPKID(1)
+	orderBookTestQuote = &PKID{}
+)
+
+func testBid(id byte, transactor byte, rate *big.Int, opType DAOCoinLimitOrderOperationType, quantity int64, height uint32) *testLimitOrder {
+	return &testLimitOrder{id, transactor, orderBookTestBase, orderBookTestQuote, rate, opType, quantity, height}
+}
+
+func testAsk(id byte, transactor byte, rate *big.Int, opType DAOCoinLimitOrderOperationType, quantity int64, height uint32) *testLimitOrder {
+	return &testLimitOrder{id, transactor, orderBookTestQuote, orderBookTestBase, rate, opType, quantity, height}
+}
+
+func TestDecodeOrderBookOrder(t *testing.T) {
+	tests := []struct {
+		name            string
+		order           *testLimitOrder
+		isBid           bool
+		wantPrice       float64
+		wantScaledPrice string
+		wantQuantity    string
+	}{
+		{"bid", testBid(1, 2, testRate(2, 1), DAOCoinLimitOrderOperationTypeBID, 100, 10),
+			true, 2, testRate(2, 1).String(), "100"},
+		// Sells 300 DeSo nanos at 2 nanos per base unit.
+		{"ask-typed bid", testBid(2, 3, testRate(2, 1), DAOCoinLimitOrderOperationTypeASK, 300, 10),
+			true, 2, testRate(2, 1).String(), "150"},
+		// An ask of 1/4 base units per nano costs 4 nanos per base unit.
+		{"ask", testAsk(3, 2, testRate(1, 4), DAOCoinLimitOrderOperationTypeASK, 40, 10),
+			false, 4, testRate(4, 1).String(), "40"},
+		// Buys 800 nanos at 1/4 base units per nano.
+		{"bid-typed ask", testAsk(4, 3, testRate(1, 4), DAOCoinLimitOrderOperationTypeBID, 800, 10),
+			false, 4, testRate(4, 1).String(), "200"},
+		// 1/3 is rounded down in the rate, so its inverse is a little above 3.
+		{"ask at a rounded rate", testAsk(5, 2, testRate(1, 3), DAOCoinLimitOrderOperationTypeASK, 7, 10),
+			false, 3, "300000000000000000000000000000000000003", "7"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			order, err := decodeOrderBookOrder([]byte(test.order.bookKey()), test.order.value(), test.isBid)
+			if err != nil {
+				t.Fatal(err)
+			}
+			wantSide := orderBookSideAsk
+			if test.isBid {
+				wantSide = orderBookSideBid
+			}
+			if order.Side != wantSide || order.Price != test.wantPrice || order.ScaledPrice != test.wantScaledPrice ||
+				order.Quantity != test.wantQuantity {
+				t.Errorf("got a %s at %v (%s) of %s, want a %s at %v (%s) of %s", order.Side, order.Price,
+					order.ScaledPrice, order.Quantity, wantSide, test.wantPrice, test.wantScaledPrice, test.wantQuantity)
+			}
+			// The order is listed as it was placed.
+			if order.OperationType != test.order.opType.String() ||
+				order.QuantityToFillInBaseUnits != big.NewInt(test.order.quantity).String() {
+				t.Errorf("got operation type %s and quantity %s, want them as placed",
+					order.OperationType, order.QuantityToFillInBaseUnits)
+			}
+		})
+	}
+
+	zeroRate := testBid(6, 2, new(big.Int), DAOCoinLimitOrderOperationTypeBID, 5, 10)
+	if order, err := decodeOrderBookOrder([]byte(zeroRate.bookKey()), zeroRate.value(), true); order != nil || err != nil {
+		t.Errorf("got order %+v and error %v for a zero rate, want neither", order, err)
+	}
+	if _, err := decodeOrderBookOrder([]byte{60}, []byte{1, 0}, true); err == nil {
+		t.Error("decoding a truncated order succeeded")
+	}
+}
+
+func TestAggregateOrders(t *testing.T) {
+	// Asks sorted best first: one at a rounded 3, two at 4 and one at 5.
+	var asks []*orderBookOrder
+	for _, ask := range []*testLimitOrder{
+		testAsk(1, 2, testRate(1, 3), DAOCoinLimitOrderOperationTypeASK, 7, 10),
+		testAsk(2, 2, testRate(1, 4), DAOCoinLimitOrderOperationTypeASK, 40, 10),
+		testAsk(3, 3, testRate(1, 4), DAOCoinLimitOrderOperationTypeBID, 800, 11),
+		testAsk(4, 4, testRate(1, 5), DAOCoinLimitOrderOperationTypeASK, 10, 10),
+	} {
+		order, err := decodeOrderBookOrder([]byte(ask.bookKey()), ask.value(), false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		asks = append(asks, order)
+	}
+
+	type level struct {
+		price     float64
+		quantity  string
+		numOrders int
+	}
+	all := []level{{3, "7", 1}, {4, "240", 2}, {5, "10", 1}}
+	tests := []struct {
+		name  string
+		depth int
+		want  []level
+	}{
+		{"all levels", 0, all},
+		{"depth cut-off", 2, all[:2]},
+		{"depth above the levels", 5, all},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			levels := aggregateOrders(asks, test.depth)
+			if len(levels) != len(test.want) {
+				t.Fatalf("got %d levels, want %d", len(levels), len(test.want))
+			}
+			for ii, got := range levels {
+				want := test.want[ii]
+				if got.Price != want.price || got.Quantity != want.quantity || got.NumberOfOrders != want.numOrders {
+					t.Errorf("level %d is %+v, want %+v", ii, got, want)
+				}
+			}
+		})
+	}
+	if levels := aggregateOrders(nil, 0); levels == nil || len(levels) != 0 {
+		t.Errorf("got %v for no orders, want no levels", levels)
+	}
+}
+
+func newOrderBookTestDB(t *testing.T, orders ...*testLimitOrder) kvDB {
+	t.Helper()
+	entries := make(map[string][]byte)
+	for _, order := range orders {
+		entries[order.bookKey()] = order.value()
+		entries[order.transactorKey()] = order.value()
+	}
+	return newTestDBWithEntries(t, entries)
+}
+
+func TestReadOrderBook(t *testing.T) {
+	db := newOrderBookTestDB(t,
+		// Bids at 2 and 1.
+		testBid(1, 2, testRate(2, 1), DAOCoinLimitOrderOperationTypeBID, 100, 12),
+		testBid(2, 3, testRate(2, 1), DAOCoinLimitOrderOperationTypeASK, 300, 11),
+		testBid(3, 2, testRate(1, 1), DAOCoinLimitOrderOperationTypeBID, 50, 10),
+		// Asks at 4 and 5.
+		testAsk(4, 3, testRate(1, 4), DAOCoinLimitOrderOperationTypeASK, 40, 10),
+		testAsk(5, 4, testRate(1, 4), DAOCoinLimitOrderOperationTypeBID, 800, 10),
+		testAsk(6, 2, testRate(1, 5), DAOCoinLimitOrderOperationTypeASK, 10, 10),
+		// An order of another pair.
+		&testLimitOrder{7, 2, testPKID(5), orderBookTestQuote, testRate(1, 1), DAOCoinLimitOrderOperationTypeBID, 1, 10},
+	)
+	readBook := func(query *orderBookQuery) *orderBook {
+		t.Helper()
+		var book *orderBook
+		err := db.View(func(txn kvTxn) error {
+			var err error
+			book, err = readOrderBookWithTxn(context.Background(), txn, query)
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return book
+	}
+
+	book := readBook(&orderBookQuery{Base: orderBookTestBase, Quote: orderBookTestQuote, Orders: true})
+	if len(book.Bids) != 2 || book.Bids[0].Quantity != "250" || book.Bids[1].Price != 1 {
+		t.Errorf("got bids %+v, want 250 at 2 and 50 at 1", book.Bids)
+	}
+	if len(book.Asks) != 2 || book.Asks[0].Quantity != "240" || book.Asks[1].Price != 5 {
+		t.Errorf("got asks %+v, want 240 at 4 and 10 at 5", book.Asks)
+	}
+	if book.BestBid == nil || *book.BestBid != 2 || book.BestAsk == nil || *book.BestAsk != 4 ||
+		book.Spread == nil || *book.Spread != 2 {
+		t.Errorf("got best bid %v, best ask %v and spread %v, want 2, 4 and 2", book.BestBid, book.BestAsk, book.Spread)
+	}
+	// Transactors are sorted by PKID, the orders of each best price first.
+	if len(book.Transactors) != 3 || *book.Transactors[0].TransactorPKID != *testPKID(2) ||
+		len(book.Transactors[0].Orders) != 3 || *book.Transactors[0].Orders[0].OrderID != *testBlockHash(1) {
+		t.Errorf("got transactors %+v, want 2, 3 and 4 with 2's bid at 2 first", book.Transactors)
+	}
+	if book.Transactors[1].Orders[0].Quantity != "150" {
+		t.Errorf("got %s base units for the ask-typed bid, want 150", book.Transactors[1].Orders[0].Quantity)
+	}
+
+	// Depth 1 keeps the best level of each side.
+	book = readBook(&orderBookQuery{Base: orderBookTestBase, Quote: orderBookTestQuote, Depth: 1})
+	if len(book.Bids) != 1 || len(book.Asks) != 1 || book.Transactors != nil {
+		t.Errorf("got %d bids, %d asks and transactors %v, want one level a side and no orders",
+			len(book.Bids), len(book.Asks), book.Transactors)
+	}
+
+	// The orders of one transactor are read from [61].
+	book = readBook(&orderBookQuery{Base: orderBookTestBase, Quote: orderBookTestQuote, Transactor: testPKID(3)})
+	if len(book.Transactors) != 1 || len(book.Transactors[0].Orders) != 2 ||
+		book.Transactors[0].Orders[0].Side != orderBookSideBid || book.Transactors[0].Orders[1].Side != orderBookSideAsk {
+		t.Errorf("got transactors %+v, want 3's bid and ask", book.Transactors)
+	}
+
+	// Seen from DeSo, the sides swap and the prices invert.
+	book = readBook(&orderBookQuery{Base: orderBookTestQuote, Quote: orderBookTestBase})
+	if book.BestBid == nil || *book.BestBid != 0.25 || book.BestAsk == nil || *book.BestAsk != 0.5 {
+		t.Errorf("got best bid %v and best ask %v, want 0.25 and 0.5", book.BestBid, book.BestAsk)
+	}
+
+	// An empty side has no best price or spread.
+	book = readBook(&orderBookQuery{Base: testPKID(5), Quote: orderBookTestQuote})
+	if len(book.Bids) != 1 || book.BestAsk != nil || book.Spread != nil {
+		t.Errorf("got %+v, want one bid and no best ask or spread", book)
+	}
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// parquetWriter writes rows to a Parquet file. It only covers what the
+// tabular exports need: flat schemas of required columns, PLAIN encoding and
+// no compression, which every Parquet reader understands. Rows are buffered
+// into row groups of parquetRowGroupRows rows, so memory doesn't grow with
+// the number of rows.
+type parquetWriter struct {
+	w       io.Writer
+	offset  int64
+	columns []*tableColumn
+
+	// values holds the PLAIN encoded values of each column of the current
+	// row group, bools holds those of boolean columns until they are bit
+	// packed.
+	values [][]byte
+	bools  [][]bool
+	rows   int
+
+	rowGroups thriftList
+	numRows   int64
+}
+
+// parquetRowGroupRows is how many rows are buffered before they are written
+// out as a row group.
+const parquetRowGroupRows = 1 << 16
+
+// The values of the Parquet enums used below, from parquet.thrift.
+const (
+	parquetTypeBoolean   = 0
+	parquetTypeInt64     = 2
+	parquetTypeByteArray = 6
+
+	parquetConvertedUTF8   = 0
+	parquetConvertedUint64 = 14
+
+	parquetRepetitionRequired = 0
+	parquetEncodingPlain      = 0
+	parquetEncodingRLE        = 3
+	parquetCodecUncompressed  = 0
+	parquetPageData           = 0
+)
+
+var parquetMagic = []byte("PAR1")
+
+func newParquetWriter(w io.Writer, columns []*tableColumn) (*parquetWriter, error) {
+	pw := &parquetWriter{
+		w:         w,
+		columns:   columns,
+		values:    make([][]byte, len(columns)),
+		bools:     make([][]bool, len(columns)),
+		rowGroups: thriftList{elemType: thriftTypeStruct},
+	}
+	if err := pw.write(parquetMagic); err != nil {
+		return nil, err
+	}
+	return pw, nil
+}
+
+func (pw *parquetWriter) write(data []byte) error {
+	n, err := pw.w.Write(data)
+	pw.offset += int64(n)
+	return err
+}
+
+// Write adds a row, whose cells have to match the types of the columns.
+func (pw *parquetWriter) Write(row []interface{}) error {
+	if len(row) != len(pw.columns) {
+		return fmt.Errorf("parquetWriter.Write: got %d cells for %d columns", len(row), len(pw.columns))
+	}
+	for ii, column := range pw.columns {
+		var ok bool
+		switch column.Type {
+		case columnString, columnUint256:
+			var value string
+			if value, ok = row[ii].(string); ok {
+				pw.values[ii] = binary.LittleEndian.AppendUint32(pw.values[ii], uint32(len(value)))
+				pw.values[ii] = append(pw.values[ii], value...)
+			}
+		case columnUint64:
+			var value uint64
+			if value, ok = row[ii].(uint64); ok {
+				pw.values[ii] = binary.LittleEndian.AppendUint64(pw.values[ii], value)
+			}
+		case columnInt64:
+			var value int64
+			if value, ok = row[ii].(int64); ok {
+				pw.values[ii] = binary.LittleEndian.AppendUint64(pw.values[ii], uint64(value))
+			}
+		case columnBool:
+			var value bool
+			if value, ok = row[ii].(bool); ok {
+				pw.bools[ii] = append(pw.bools[ii], value)
+			}
+		}
+		if !ok {
+			return fmt.Errorf("parquetWriter.Write: cell %v doesn't match the type of column %s", row[ii], column.Name)
+		}
+		if len(pw.values[ii]) > math.MaxInt32/2 {
+			return fmt.Errorf("parquetWriter.Write: column %s is too large for a single page", column.Name)
+		}
+	}
+	pw.rows++
+	if pw.rows >= parquetRowGroupRows {
+		return pw.flushRowGroup()
+	}
+	return nil
+}
+
+// flushRowGroup writes the buffered rows as a row group with a single data
+// page per column.
+func (pw *parquetWriter) flushRowGroup() error {
+	if pw.rows == 0 {
+		return nil
+	}
+	chunks := thriftList{elemType: thriftTypeStruct}
+	totalSize := int64(0)
+	for ii, column := range pw.columns {
+		data := pw.values[ii]
+		if column.Type == columnBool {
+			data = make([]byte, (len(pw.bools[ii])+7)/8)
+			for jj, value := range pw.bools[ii] {
+				if value {
+					data[jj/8] |= 1 << (jj % 8)
+				}
+			}
+		}
+		header := thriftStruct{
+			{1, int32(parquetPageData)},
+			{2, int32(len(data))},
+			{3, int32(len(data))},
+			{5, thriftStruct{
+				{1, int32(pw.rows)},
+				{2, int32(parquetEncodingPlain)},
+				{3, int32(parquetEncodingRLE)},
+				{4, int32(parquetEncodingRLE)},
+			}},
+		}.encode()
+
+		pageOffset := pw.offset
+		if err := pw.write(header); err != nil {
+			return err
+		}
+		if err := pw.write(data); err != nil {
+			return err
+		}
+		chunkSize := int64(len(header) + len(data))
+		totalSize += chunkSize
+		chunks.items = append(chunks.items, thriftStruct{
+			{2, pageOffset},
+			{3, thriftStruct{
+				{1, int32(column.parquetType())},
+				{2, thriftList{elemType: thriftTypeI32, items: []interface{}{int32(parquetEncodingPlain), int32(parquetEncodingRLE)}}},
+				{3, thriftList{elemType: thriftTypeBinary, items: []interface{}{column.Name}}},
+				{4, int32(parquetCodecUncompressed)},
+				{5, int64(pw.rows)},
+				{6, chunkSize},
+				{7, chunkSize},
+				{9, pageOffset},
+			}},
+		})
+		pw.values[ii] = pw.values[ii][:0]
+		pw.bools[ii] = pw.bools[ii][:0]
+	}
+	pw.rowGroups.items = append(pw.rowGroups.items, thriftStruct{
+		{1, chunks},
+		{2, totalSize},
+		{3, int64(pw.rows)},
+	})
+	pw.numRows += int64(pw.rows)
+	pw.rows = 0
+	return nil
+}
+
+// Close writes the remaining rows and the footer. It doesn't close the
+// underlying writer.
+func (pw *parquetWriter) Close() error {
+	if err := pw.flushRowGroup(); err != nil {
+		return err
+	}
+	schema := thriftList{elemType: thriftTypeStruct, items: []interface{}{
+		thriftStruct{{4, "schema"}, {5, int32(len(pw.columns))}},
+	}}
+	for _, column := range pw.columns {
+		element := thriftStruct{
+			{1, int32(column.parquetType())},
+			{3, int32(parquetRepetitionRequired)},
+			{4, column.Name},
+		}
+		switch column.Type {
+		case columnString, columnUint256:
+			element = append(element, thriftField{6, int32(parquetConvertedUTF8)})
+		case columnUint64:
+			element = append(element, thriftField{6, int32(parquetConvertedUint64)})
+		}
+		schema.items = append(schema.items, element)
+	}
+	footer := thriftStruct{
+		{1, int32(1)},
+		{2, schema},
+		{3, pw.numRows},
+		{4, pw.rowGroups},
+		{6, "deso badger db tool"},
+	}.encode()
+
+	if err := pw.write(footer); err != nil {
+		return err
+	}
+	if err := pw.write(binary.LittleEndian.AppendUint32(nil, uint32(len(footer)))); err != nil {
+		return err
+	}
+	return pw.write(parquetMagic)
+}
+
+func (column *tableColumn) parquetType() int {
+	switch column.Type {
+	case columnUint64, columnInt64:
+		return parquetTypeInt64
+	case columnBool:
+		return parquetTypeBoolean
+	}
+	return parquetTypeByteArray
+}
+
+// The Parquet metadata is serialized with Thrift's compact protocol. The
+// structs below are just enough of it to write that metadata: a struct is a
+// list of fields in increasing id order, and values are int32s, int64s,
+// strings, lists and structs.
+
+const (
+	thriftTypeI32    = 5
+	thriftTypeI64    = 6
+	thriftTypeBinary = 8
+	thriftTypeList   = 9
+	thriftTypeStruct = 12
+)
+
+type thriftField struct {
+	id    int16
+	value interface{}
+}
+
+type thriftStruct []thriftField
+
+type thriftList struct {
+	elemType byte
+	items    []interface{}
+}
+
+func (s thriftStruct) encode() []byte {
+	buf := &bytes.Buffer{}
+	s.encodeTo(buf)
+	return buf.Bytes()
+}
+
+func (s thriftStruct) encodeTo(buf *bytes.Buffer) {
+	lastID := int16(0)
+	for _, field := range s {
+		fieldType := thriftTypeOf(field.value)
+		if delta := field.id - lastID; delta > 0 && delta <= 15 {
+			buf.WriteByte(byte(delta)<<4 | fieldType)
+		} else {
+			buf.WriteByte(fieldType)
+			buf.Write(binary.AppendUvarint(nil, uint64(uint16((field.id<<1)^(field.id>>15)))))
+		}
+		lastID = field.id
+		encodeThriftValue(buf, field.value)
+	}
+	buf.WriteByte(0)
+}
+
+func thriftTypeOf(value interface{}) byte {
+	switch value.(type) {
+	case int32:
+		return thriftTypeI32
+	case int64:
+		return thriftTypeI64
+	case string:
+		return thriftTypeBinary
+	case thriftList:
+		return thriftTypeList
+	case thriftStruct:
+		return thriftTypeStruct
+	}
+	panic(fmt.Sprintf("thriftTypeOf: unsupported value %T", value))
+}
+
+func encodeThriftValue(buf *bytes.Buffer, value interface{}) {
+	switch v := value.(type) {
+	case int32:
+		buf.Write(binary.AppendUvarint(nil, uint64(uint32((v<<1)^(v>>31)))))
+	case int64:
+		buf.Write(binary.AppendUvarint(nil, uint64((v<<1)^(v>>63))))
+	case string:
+		buf.Write(binary.AppendUvarint(nil, uint64(len(v))))
+		buf.WriteString(v)
+	case thriftList:
+		if len(v.items) < 15 {
+			buf.WriteByte(byte(len(v.items))<<4 | v.elemType)
+		} else {
+			buf.WriteByte(0xf0 | v.elemType)
+			buf.Write(binary.AppendUvarint(nil, uint64(len(v.items))))
+		}
+		for _, item := range v.items {
+			encodeThriftValue(buf, item)
+		}
+	case thriftStruct:
+		v.encodeTo(buf)
+	}
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// thriftReader reads the Thrift compact protocol independently of the
+// writer: structs are read into maps from field id to value, with integers as
+// int64s, binaries as strings and lists as slices. Field ids are checked
+// against parquet.thrift by the tests, so a wrong id in the writer shows up as
+// a missing field.
+type thriftReader struct {
+	*bytes.Reader
+}
+
+func (r thriftReader) readStruct() (map[int16]interface{}, error) {
+	fields := make(map[int16]interface{})
+	lastID := int16(0)
+	for {
+		header, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if header == 0 {
+			return fields, nil
+		}
+		fieldType := header & 0x0f
+		id := lastID + int16(header>>4)
+		if header>>4 == 0 {
+			zigzag, err := binary.ReadUvarint(r)
+			if err != nil {
+				return nil, err
+			}
+			id = int16(zigzag>>1) ^ -int16(zigzag&1)
+		}
+		lastID = id
+		if fields[id], err = r.readValue(fieldType); err != nil {
+			return nil, fmt.Errorf("field %d: %v", id, err)
+		}
+	}
+}
+
+func (r thriftReader) readValue(valueType byte) (interface{}, error) {
+	switch valueType {
+	case thriftTypeI32, thriftTypeI64:
+		zigzag, err := binary.ReadUvarint(r)
+		return int64(zigzag>>1) ^ -int64(zigzag&1), err
+	case thriftTypeBinary:
+		length, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+		data := make([]byte, length)
+		_, err = r.Read(data)
+		return string(data), err
+	case thriftTypeList:
+		header, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		length := uint64(header >> 4)
+		if length == 15 {
+			if length, err = binary.ReadUvarint(r); err != nil {
+				return nil, err
+			}
+		}
+		items := []interface{}{}
+		for ; length > 0; length-- {
+			item, err := r.readValue(header & 0x0f)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	case thriftTypeStruct:
+		return r.readStruct()
+	}
+	return nil, fmt.Errorf("unexpected type %d", valueType)
+}
+
+// parquetFile is what readParquetFile found in a file: its FileMetaData and
+// the values of every column, read from each row group's data page.
+type parquetFile struct {
+	meta    map[int16]interface{}
+	columns [][]interface{}
+}
+
+// readParquetFile checks the magic bytes and footer length of a Parquet file,
+// and decodes its FileMetaData and the PLAIN data pages of its required
+// columns.
+func readParquetFile(t *testing.T, data []byte, columns []*tableColumn) *parquetFile {
+	t.Helper()
+	if !bytes.HasPrefix(data, parquetMagic) || !bytes.HasSuffix(data, parquetMagic) {
+		t.Fatalf("the file doesn't start and end with %q", parquetMagic)
+	}
+	footerLength := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	footerStart := len(data) - 8 - footerLength
+	if footerStart < len(parquetMagic) {
+		t.Fatalf("the footer length %d is larger than the file", footerLength)
+	}
+	footer := bytes.NewReader(data[footerStart : len(data)-8])
+	meta, err := thriftReader{footer}.readStruct()
+	if err != nil {
+		t.Fatalf("decoding FileMetaData: %v", err)
+	}
+	if footer.Len() != 0 {
+		t.Fatalf("FileMetaData is %d bytes shorter than the footer length", footer.Len())
+	}
+
+	file := &parquetFile{meta: meta, columns: make([][]interface{}, len(columns))}
+	rowGroups, _ := meta[4].([]interface{})
+	for _, rowGroup := range rowGroups {
+		chunks, _ := rowGroup.(map[int16]interface{})[1].([]interface{})
+		if len(chunks) != len(columns) {
+			t.Fatalf("a row group has %d column chunks, want %d", len(chunks), len(columns))
+		}
+		for ii, chunk := range chunks {
+			chunkMeta := chunk.(map[int16]interface{})[3].(map[int16]interface{})
+			pageOffset := chunkMeta[9].(int64)
+			page := bytes.NewReader(data[pageOffset:])
+			pageHeader, err := thriftReader{page}.readStruct()
+			if err != nil {
+				t.Fatalf("decoding the PageHeader of %s: %v", columns[ii].Name, err)
+			}
+			pageData := make([]byte, pageHeader[3].(int64))
+			if _, err := page.Read(pageData); err != nil {
+				t.Fatal(err)
+			}
+			numValues := int(pageHeader[5].(map[int16]interface{})[1].(int64))
+			file.columns[ii] = append(file.columns[ii], readPlainValues(t, columns[ii], pageData, numValues)...)
+		}
+	}
+	return file
+}
+
+func readPlainValues(t *testing.T, column *tableColumn, data []byte, numValues int) []interface{} {
+	t.Helper()
+	var values []interface{}
+	rr := bytes.NewReader(data)
+	for ii := 0; ii < numValues; ii++ {
+		switch column.Type {
+		case columnBool:
+			values = append(values, data[ii/8]&(1<<(ii%8)) != 0)
+			continue
+		case columnUint64:
+			var value uint64
+			if err := binary.Read(rr, binary.LittleEndian, &value); err != nil {
+				t.Fatal(err)
+			}
+			values = append(values, value)
+		case columnInt64:
+			var value int64
+			if err := binary.Read(rr, binary.LittleEndian, &value); err != nil {
+				t.Fatal(err)
+			}
+			values = append(values, value)
+		default:
+			var length uint32
+			if err := binary.Read(rr, binary.LittleEndian, &length); err != nil {
+				t.Fatal(err)
+			}
+			value := make([]byte, length)
+			if _, err := rr.Read(value); err != nil && length > 0 {
+				t.Fatal(err)
+			}
+			values = append(values, string(value))
+		}
+	}
+	if column.Type != columnBool && rr.Len() != 0 {
+		t.Errorf("column %s: %d bytes are left after %d values", column.Name, rr.Len(), numValues)
+	}
+	return values
+}
+
+func writeParquet(t *testing.T, columns []*tableColumn, rows [][]interface{}) []byte {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	writer, err := newParquetWriter(buf, columns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range rows {
+		if err := writer.Write(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestParquetWriter(t *testing.T) {
+	columns := []*tableColumn{
+		{"Name", columnString},
+		{"Nanos", columnUint64},
+		{"Delta", columnInt64},
+		{"Flag", columnBool},
+		{"Supply", columnUint256},
+	}
+	var rows [][]interface{}
+	// More than 8 rows, so that the bools take more than one byte.
+	for ii := 0; ii < 11; ii++ {
+		rows = append(rows, []interface{}{
+			fmt.Sprintf("row %d", ii), math.MaxUint64 - uint64(ii), int64(-ii), ii%3 == 0, fmt.Sprint(ii * 1000),
+		})
+	}
+	rows[4][0] = ""
+	file := readParquetFile(t, writeParquet(t, columns, rows), columns)
+
+	// FileMetaData: 1 version, 2 schema, 3 num_rows, 4 row_groups.
+	if file.meta[1] != int64(1) || file.meta[3] != int64(len(rows)) {
+		t.Errorf("got version %v and %v rows, want 1 and %d", file.meta[1], file.meta[3], len(rows))
+	}
+	// SchemaElement: 1 type, 3 repetition_type, 4 name, 5 num_children,
+	// 6 converted_type.
+	wantSchema := []map[int16]interface{}{
+		{4: "schema", 5: int64(5)},
+		{1: int64(parquetTypeByteArray), 3: int64(parquetRepetitionRequired), 4: "Name", 6: int64(parquetConvertedUTF8)},
+		{1: int64(parquetTypeInt64), 3: int64(parquetRepetitionRequired), 4: "Nanos", 6: int64(parquetConvertedUint64)},
+		{1: int64(parquetTypeInt64), 3: int64(parquetRepetitionRequired), 4: "Delta"},
+		{1: int64(parquetTypeBoolean), 3: int64(parquetRepetitionRequired), 4: "Flag"},
+		{1: int64(parquetTypeByteArray), 3: int64(parquetRepetitionRequired), 4: "Supply", 6: int64(parquetConvertedUTF8)},
+	}
+	schema, _ := file.meta[2].([]interface{})
+	if len(schema) != len(wantSchema) {
+		t.Fatalf("got %d schema elements, want %d", len(schema), len(wantSchema))
+	}
+	for ii, element := range schema {
+		if !reflect.DeepEqual(element, wantSchema[ii]) {
+			t.Errorf("got schema element %v, want %v", element, wantSchema[ii])
+		}
+	}
+
+	// RowGroup: 1 columns, 3 num_rows. ColumnChunk: 2 file_offset,
+	// 3 meta_data. ColumnMetaData: 1 type, 3 path_in_schema, 4 codec,
+	// 5 num_values.
+	rowGroups := file.meta[4].([]interface{})
+	if len(rowGroups) != 1 || rowGroups[0].(map[int16]interface{})[3] != int64(len(rows)) {
+		t.Fatalf("got row groups %v, want one of %d rows", rowGroups, len(rows))
+	}
+	for ii, chunk := range rowGroups[0].(map[int16]interface{})[1].([]interface{}) {
+		chunkMeta := chunk.(map[int16]interface{})[3].(map[int16]interface{})
+		if chunkMeta[1] != wantSchema[ii+1][1] || !reflect.DeepEqual(chunkMeta[3], []interface{}{columns[ii].Name}) ||
+			chunkMeta[4] != int64(parquetCodecUncompressed) || chunkMeta[5] != int64(len(rows)) {
+			t.Errorf("column chunk %d has metadata %v", ii, chunkMeta)
+		}
+	}
+
+	for ii, column := range columns {
+		for jj, row := range rows {
+			if got := file.columns[ii][jj]; got != row[ii] {
+				t.Errorf("row %d of %s is %v, want %v", jj, column.Name, got, row[ii])
+			}
+		}
+	}
+}
+
+// TestParquetWriterRowGroups writes more rows than fit in one row group,
+// and checks that the rows of both add up.
+func TestParquetWriterRowGroups(t *testing.T) {
+	columns := []*tableColumn{{"Nanos", columnUint64}}
+	var rows [][]interface{}
+	for ii := 0; ii < parquetRowGroupRows+3; ii++ {
+		rows = append(rows, []interface{}{uint64(ii)})
+	}
+	file := readParquetFile(t, writeParquet(t, columns, rows), columns)
+	if rowGroups := file.meta[4].([]interface{}); len(rowGroups) != 2 {
+		t.Fatalf("got %d row groups, want 2", len(rowGroups))
+	}
+	if len(file.columns[0]) != len(rows) || file.columns[0][len(rows)-1] != uint64(len(rows)-1) {
+		t.Errorf("got %d values ending in %v, want %d ending in %d",
+			len(file.columns[0]), file.columns[0][len(file.columns[0])-1], len(rows), len(rows)-1)
+	}
+}
+
+func TestParquetWriterTypeMismatch(t *testing.T) {
+	writer, err := newParquetWriter(&bytes.Buffer{}, []*tableColumn{{"Nanos", columnUint64}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Write([]interface{}{"1"}); err == nil {
+		t.Error("writing a string to a uint64 column succeeded")
+	}
+	if err := writer.Write([]interface{}{uint64(1), uint64(2)}); err == nil {
+		t.Error("writing two cells to one column succeeded")
+	}
+}
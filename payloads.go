@@ -0,0 +1,814 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+)
+
+// TxnPayload is the decoded metadata of a transaction as it is sent to the
+// trade bot, one of the *Payload types below. TransactionData.TxnType tells
+// which one it is. Field names follow core's metadata structs, public keys and
+// PKIDs are Base58Check encoded and hashes are hex.
+type TxnPayload interface{}
+
+// affectsPublicKeys is implemented by the payloads that touch public keys
+// other than the transactor and the outputs, such as the followed key of a
+// follow.
+type affectsPublicKeys interface {
+	affectedPublicKeys() []string
+}
+
+// txnPayloadDecoders maps each txn type to a function that reads its metadata
+// with r. Types that are not listed here get a RawPayload.
+var txnPayloadDecoders = map[TxnType]func(txn *MsgDeSoTxn, r *metaReader) TxnPayload{
+	TxnTypeBlockReward: func(txn *MsgDeSoTxn, r *metaReader) TxnPayload {
+		return &BlockRewardPayload{ExtraData: r.byteArray("ExtraData")}
+	},
+	TxnTypeBasicTransfer: func(txn *MsgDeSoTxn, r *metaReader) TxnPayload {
+		payload := &BasicTransferPayload{Diamond: diamondFromExtraData(txn.ExtraData)}
+		for _, output := range txn.TxOutputs {
+			payload.Outputs = append(payload.Outputs, &OutputPayload{
+				PublicKey:   PkToString(output.PublicKey),
+				AmountNanos: output.AmountNanos,
+			})
+		}
+		return payload
+	},
+	TxnTypePrivateMessage: func(txn *MsgDeSoTxn, r *metaReader) TxnPayload {
+		return &PrivateMessagePayload{
+			RecipientPublicKey: r.fixedPublicKey("RecipientPublicKey"),
+			EncryptedText:      r.byteArray("EncryptedText"),
+			TimestampNanos:     r.uvarint("TimestampNanos"),
+		}
+	},
+	TxnTypeSubmitPost: func(txn *MsgDeSoTxn, r *metaReader) TxnPayload {
+		payload := &SubmitPostPayload{
+			PostHashToModify:         HexBytes(r.byteArray("PostHashToModify")),
+			ParentStakeID:            HexBytes(r.byteArray("ParentStakeID")),
+			Body:                     postBody(r.byteArray("Body")),
+			CreatorBasisPoints:       r.uvarint("CreatorBasisPoints"),
+			StakeMultipleBasisPoints: r.uvarint("StakeMultipleBasisPoints"),
+			TimestampNanos:           r.uvarint("TimestampNanos"),
+			IsHidden:                 r.boolByte("IsHidden"),
+		}
+		if repostedPostHash, exists := txn.ExtraData["RepostedPostHash"]; exists {
+			payload.RepostedPostHash = repostedPostHash
+			payload.IsQuotedRepost = string(txn.ExtraData["IsQuotedRepost"]) == "1"
+		}
+		return payload
+	},
+	TxnTypeUpdateProfile: func(txn *MsgDeSoTxn, r *metaReader) TxnPayload {
+		return &UpdateProfilePayload{
+			ProfilePublicKey:            r.publicKey("ProfilePublicKey"),
+			NewUsername:                 r.string("NewUsername"),
+			NewDescription:              r.string("NewDescription"),
+			HasNewProfilePic:            len(r.byteArray("NewProfilePic")) > 0,
+			NewCreatorBasisPoints:       r.uvarint("NewCreatorBasisPoints"),
+			NewStakeMultipleBasisPoints: r.uvarint("NewStakeMultipleBasisPoints"),
+			IsHidden:                    r.boolByte("IsHidden"),
+		}
+	},
+	TxnTypeUpdateBitcoinUSDExchangeRate: func(txn *MsgDeSoTxn, r *metaReader) TxnPayload {
+		return &UpdateBitcoinUSDExchangeRatePayload{USDCentsPerBitcoin: r.uvarint("USDCentsPerBitcoin")}
+	},
+	TxnTypeFollow: func(txn *MsgDeSoTxn, r *metaReader) TxnPayload {
+		return &FollowPayload{
+			FollowedPublicKey: r.fixedPublicKey("FollowedPublicKey"),
+			IsUnfollow:        r.boolByte("IsUnfollow"),
+		}
+	},
+	TxnTypeLike: func(txn *MsgDeSoTxn, r *metaReader) TxnPayload {
+		return &LikePayload{
+			LikedPostHash: r.blockHash("LikedPostHash"),
+			IsUnlike:      r.boolByte("IsUnlike"),
+		}
+	},
+	TxnTypeCreatorCoin: func(txn *MsgDeSoTxn, r *metaReader) TxnPayload {
+		return &CreatorCoinPayload{
+			ProfilePublicKey:            r.publicKey("ProfilePublicKey"),
+			OperationType:               CreatorCoinOperationType(r.byte("OperationType")).String(),
+			DeSoToSellNanos:             r.uvarint("DeSoToSellNanos"),
+			CreatorCoinToSellNanos:      r.uvarint("CreatorCoinToSellNanos"),
+			DeSoToAddNanos:              r.uvarint("DeSoToAddNanos"),
+			MinDeSoExpectedNanos:        r.uvarint("MinDeSoExpectedNanos"),
+			MinCreatorCoinExpectedNanos: r.uvarint("MinCreatorCoinExpectedNanos"),
+		}
+	},
+	TxnTypeSwapIdentity: func(txn *MsgDeSoTxn, r *metaReader) TxnPayload {
+		return &SwapIdentityPayload{
+			FromPublicKey: r.publicKey("FromPublicKey"),
+			ToPublicKey:   r.publicKey("ToPublicKey"),
+		}
+	},
+	TxnTypeUpdateGlobalParams: func(txn *MsgDeSoTxn, r *metaReader) TxnPayload {
+		// The new values are all in the ExtraData of the txn.
+		return &UpdateGlobalParamsPayload{ExtraData: txn.ExtraData}
+	},
+	TxnTypeCreatorCoinTransfer: func(txn *MsgDeSoTxn, r *metaReader) TxnPayload {
+		return &CreatorCoinTransferPayload{
+			ProfilePublicKey:           r.publicKey("ProfilePublicKey"),
+			CreatorCoinToTransferNanos: r.uvarint("CreatorCoinToTransferNanos"),
+			ReceiverPublicKey:          r.publicKey("ReceiverPublicKey"),
+			Diamond:                    diamondFromExtraData(txn.ExtraData),
+		}
+	},
+	TxnTypeCreateNFT: func(txn *MsgDeSoTxn, r *metaReader) TxnPayload {
+		return &CreateNFTPayload{
+			NFTPostHash:                    r.blockHash("NFTPostHash"),
+			NumCopies:                      r.uvarint("NumCopies"),
+			HasUnlockable:                  r.boolByte("HasUnlockable"),
+			IsForSale:                      r.boolByte("IsForSale"),
+			MinBidAmountNanos:              r.uvarint("MinBidAmountNanos"),
+			NFTRoyaltyToCreatorBasisPoints: r.uvarint("NFTRoyaltyToCreatorBasisPoints"),
+			NFTRoyaltyToCoinBasisPoints:    r.uvarint("NFTRoyaltyToCoinBasisPoints"),
+		}
+	},
+	TxnTypeUpdateNFT: func(txn *MsgDeSoTxn, r *metaReader) TxnPayload {
+		return &UpdateNFTPayload{
+			NFTPostHash:       r.blockHash("NFTPostHash"),
+			SerialNumber:      r.uvarint("SerialNumber"),
+			IsForSale:         r.boolByte("IsForSale"),
+			MinBidAmountNanos: r.uvarint("MinBidAmountNanos"),
+		}
+	},
+	TxnTypeAcceptNFTBid: func(txn *MsgDeSoTxn, r *metaReader) TxnPayload {
+		// The unlockable text and the bidder's inputs follow, neither is of
+		// any use to the bot.
+		return &AcceptNFTBidPayload{
+			NFTPostHash:    r.blockHash("NFTPostHash"),
+			SerialNumber:   r.uvarint("SerialNumber"),
+			BidderPKID:     r.publicKey("BidderPKID"),
+			BidAmountNanos: r.uvarint("BidAmountNanos"),
+		}
+	},
+	TxnTypeNFTBid: func(txn *MsgDeSoTxn, r *metaReader) TxnPayload {
+		return &NFTBidPayload{
+			NFTPostHash:    r.blockHash("NFTPostHash"),
+			SerialNumber:   r.uvarint("SerialNumber"),
+			BidAmountNanos: r.uvarint("BidAmountNanos"),
+		}
+	},
+	TxnTypeNFTTransfer: func(txn *MsgDeSoTxn, r *metaReader) TxnPayload {
+		return &NFTTransferPayload{
+			NFTPostHash:       r.blockHash("NFTPostHash"),
+			SerialNumber:      r.uvarint("SerialNumber"),
+			ReceiverPublicKey: r.publicKey("ReceiverPublicKey"),
+		}
+	},
+	TxnTypeAcceptNFTTransfer: func(txn *MsgDeSoTxn, r *metaReader) TxnPayload {
+		return &AcceptNFTTransferPayload{
+			NFTPostHash:  r.blockHash("NFTPostHash"),
+			SerialNumber: r.uvarint("SerialNumber"),
+		}
+	},
+	TxnTypeBurnNFT: func(txn *MsgDeSoTxn, r *metaReader) TxnPayload {
+		return &BurnNFTPayload{
+			NFTPostHash:  r.blockHash("NFTPostHash"),
+			SerialNumber: r.uvarint("SerialNumber"),
+		}
+	},
+	TxnTypeAuthorizeDerivedKey: func(txn *MsgDeSoTxn, r *metaReader) TxnPayload {
+		return &AuthorizeDerivedKeyPayload{
+			DerivedPublicKey: r.publicKey("DerivedPublicKey"),
+			ExpirationBlock:  r.uvarint("ExpirationBlock"),
+			OperationType:    r.byte("OperationType"),
+		}
+	},
+	TxnTypeMessagingGroup: func(txn *MsgDeSoTxn, r *metaReader) TxnPayload {
+		payload := &MessagingGroupPayload{
+			MessagingPublicKey:    r.publicKey("MessagingPublicKey"),
+			MessagingGroupKeyName: r.string("MessagingGroupKeyName"),
+		}
+		r.byteArray("GroupOwnerSignature")
+		numMembers := r.count("MessagingGroupMembers")
+		for ii := uint64(0); ii < numMembers && r.err == nil; ii++ {
+			member := &GroupMemberPayload{
+				PublicKey: r.publicKey("GroupMemberPublicKey"),
+				KeyName:   r.string("GroupMemberKeyName"),
+			}
+			r.byteArray("EncryptedKey")
+			payload.MessagingGroupMembers = append(payload.MessagingGroupMembers, member)
+		}
+		return payload
+	},
+	TxnTypeDAOCoin: func(txn *MsgDeSoTxn, r *metaReader) TxnPayload {
+		return &DAOCoinPayload{
+			ProfilePublicKey:          r.publicKey("ProfilePublicKey"),
+			OperationType:             DAOCoinOperationType(r.byte("OperationType")).String(),
+			CoinsToMintNanos:          r.uint256("CoinsToMintNanos"),
+			CoinsToBurnNanos:          r.uint256("CoinsToBurnNanos"),
+			TransferRestrictionStatus: r.byte("TransferRestrictionStatus"),
+		}
+	},
+	TxnTypeDAOCoinTransfer: func(txn *MsgDeSoTxn, r *metaReader) TxnPayload {
+		return &DAOCoinTransferPayload{
+			ProfilePublicKey:       r.publicKey("ProfilePublicKey"),
+			DAOCoinToTransferNanos: r.uint256("DAOCoinToTransferNanos"),
+			ReceiverPublicKey:      r.publicKey("ReceiverPublicKey"),
+		}
+	},
+	TxnTypeDAOCoinLimitOrder: func(txn *MsgDeSoTxn, r *metaReader) TxnPayload {
+		// The bidder inputs and fee that follow are left out.
+		return &DAOCoinLimitOrderPayload{
+			BuyingDAOCoinCreatorPublicKey:             r.coinPublicKey("BuyingDAOCoinCreatorPublicKey"),
+			SellingDAOCoinCreatorPublicKey:            r.coinPublicKey("SellingDAOCoinCreatorPublicKey"),
+			ScaledExchangeRateCoinsToSellPerCoinToBuy: r.optionalUint256("ScaledExchangeRateCoinsToSellPerCoinToBuy"),
+			QuantityToFillInBaseUnits:                 r.optionalUint256("QuantityToFillInBaseUnits"),
+			OperationType:                             DAOCoinLimitOrderOperationType(r.uvarint("OperationType")).String(),
+			FillType:                                  DAOCoinLimitOrderFillType(r.uvarint("FillType")).String(),
+			CancelOrderID:                             HexBytes(r.byteArray("CancelOrderID")),
+		}
+	},
+	TxnTypeCreateUserAssociation: func(txn *MsgDeSoTxn, r *metaReader) TxnPayload {
+		return &CreateUserAssociationPayload{
+			TargetUserPublicKey: r.publicKey("TargetUserPublicKey"),
+			AppPublicKey:        r.publicKey("AppPublicKey"),
+			AssociationType:     r.string("AssociationType"),
+			AssociationValue:    r.string("AssociationValue"),
+		}
+	},
+	TxnTypeDeleteUserAssociation: func(txn *MsgDeSoTxn, r *metaReader) TxnPayload {
+		return &DeleteAssociationPayload{AssociationID: HexBytes(r.byteArray("AssociationID"))}
+	},
+	TxnTypeCreatePostAssociation: func(txn *MsgDeSoTxn, r *metaReader) TxnPayload {
+		return &CreatePostAssociationPayload{
+			PostHash:         HexBytes(r.byteArray("PostHash")),
+			AppPublicKey:     r.publicKey("AppPublicKey"),
+			AssociationType:  r.string("AssociationType"),
+			AssociationValue: r.string("AssociationValue"),
+		}
+	},
+	TxnTypeDeletePostAssociation: func(txn *MsgDeSoTxn, r *metaReader) TxnPayload {
+		return &DeleteAssociationPayload{AssociationID: HexBytes(r.byteArray("AssociationID"))}
+	},
+	TxnTypeAccessGroup: func(txn *MsgDeSoTxn, r *metaReader) TxnPayload {
+		return &AccessGroupPayload{
+			AccessGroupOwnerPublicKey: r.publicKey("AccessGroupOwnerPublicKey"),
+			AccessGroupPublicKey:      r.publicKey("AccessGroupPublicKey"),
+			AccessGroupKeyName:        r.string("AccessGroupKeyName"),
+			AccessGroupOperationType:  r.uvarint("AccessGroupOperationType"),
+		}
+	},
+	TxnTypeAccessGroupMembers: func(txn *MsgDeSoTxn, r *metaReader) TxnPayload {
+		payload := &AccessGroupMembersPayload{
+			AccessGroupOwnerPublicKey: r.publicKey("AccessGroupOwnerPublicKey"),
+			AccessGroupKeyName:        r.string("AccessGroupKeyName"),
+		}
+		numMembers := r.count("AccessGroupMembersList")
+		for ii := uint64(0); ii < numMembers && r.err == nil; ii++ {
+			member := &GroupMemberPayload{
+				PublicKey: r.publicKey("AccessGroupMemberPublicKey"),
+				KeyName:   r.string("AccessGroupMemberKeyName"),
+			}
+			r.byteArray("EncryptedKey")
+			r.extraData("ExtraData")
+			payload.AccessGroupMembersList = append(payload.AccessGroupMembersList, member)
+		}
+		payload.AccessGroupMemberOperationType = r.uvarint("AccessGroupMemberOperationType")
+		return payload
+	},
+	TxnTypeNewMessage: func(txn *MsgDeSoTxn, r *metaReader) TxnPayload {
+		payload := &NewMessagePayload{
+			SenderAccessGroupOwnerPublicKey:    r.publicKey("SenderAccessGroupOwnerPublicKey"),
+			SenderAccessGroupKeyName:           r.string("SenderAccessGroupKeyName"),
+			SenderAccessGroupPublicKey:         r.publicKey("SenderAccessGroupPublicKey"),
+			RecipientAccessGroupOwnerPublicKey: r.publicKey("RecipientAccessGroupOwnerPublicKey"),
+			RecipientAccessGroupKeyName:        r.string("RecipientAccessGroupKeyName"),
+			RecipientAccessGroupPublicKey:      r.publicKey("RecipientAccessGroupPublicKey"),
+		}
+		r.byteArray("EncryptedText")
+		payload.TimestampNanos = r.uvarint("TimestampNanos")
+		payload.NewMessageType = r.uvarint("NewMessageType")
+		payload.NewMessageOperation = r.uvarint("NewMessageOperation")
+		return payload
+	},
+}
+
+// decodeTxnPayload decodes the metadata of txn into its payload. When the
+// metadata can't be decoded, or there is no decoder for the txn type, a
+// RawPayload is returned along with the error, if any.
+func decodeTxnPayload(txn *MsgDeSoTxn) (TxnPayload, error) {
+	decoder, exists := txnPayloadDecoders[txn.TxnType]
+	if !exists {
+		return &RawPayload{TxnMeta: txn.TxnMeta}, nil
+	}
+	r := &metaReader{name: txn.TxnType.String(), rr: bytes.NewReader(txn.TxnMeta)}
+	payload := decoder(txn, r)
+	if r.err != nil {
+		return &RawPayload{TxnMeta: txn.TxnMeta}, r.err
+	}
+	return payload, nil
+}
+
+// RawPayload holds the undecoded metadata of txn types we don't know how to
+// read, such as bitcoin exchanges.
+type RawPayload struct {
+	TxnMeta HexBytes
+}
+
+type BlockRewardPayload struct {
+	ExtraData HexBytes
+}
+
+type OutputPayload struct {
+	PublicKey   string
+	AmountNanos uint64
+}
+
+// BasicTransferPayload is a transfer of DeSo. Diamonds given in DeSo are
+// basic transfers with the diamond set.
+type BasicTransferPayload struct {
+	Outputs []*OutputPayload
+	Diamond *DiamondPayload `json:",omitempty"`
+}
+
+// DiamondPayload is read from the ExtraData of the basic transfer or creator
+// coin transfer that gives the diamond.
+type DiamondPayload struct {
+	DiamondLevel    int64
+	DiamondPostHash HexBytes
+}
+
+type PrivateMessagePayload struct {
+	RecipientPublicKey string
+	EncryptedText      HexBytes
+	TimestampNanos     uint64
+}
+
+type SubmitPostPayload struct {
+	PostHashToModify HexBytes
+	ParentStakeID    HexBytes
+	// Body is the post's JSON body, e.g. {"Body": "gm", "ImageURLs": []}.
+	Body                     json.RawMessage
+	CreatorBasisPoints       uint64
+	StakeMultipleBasisPoints uint64
+	TimestampNanos           uint64
+	IsHidden                 bool
+	RepostedPostHash         HexBytes `json:",omitempty"`
+	IsQuotedRepost           bool     `json:",omitempty"`
+}
+
+// UpdateProfilePayload leaves the new profile pic out since it is an entire
+// image, HasNewProfilePic only says whether it changed.
+type UpdateProfilePayload struct {
+	ProfilePublicKey            string
+	NewUsername                 string
+	NewDescription              string
+	HasNewProfilePic            bool
+	NewCreatorBasisPoints       uint64
+	NewStakeMultipleBasisPoints uint64
+	IsHidden                    bool
+}
+
+type UpdateBitcoinUSDExchangeRatePayload struct {
+	USDCentsPerBitcoin uint64
+}
+
+type FollowPayload struct {
+	FollowedPublicKey string
+	IsUnfollow        bool
+}
+
+type LikePayload struct {
+	LikedPostHash HexBytes
+	IsUnlike      bool
+}
+
+type CreatorCoinPayload struct {
+	ProfilePublicKey            string
+	OperationType               string
+	DeSoToSellNanos             uint64
+	CreatorCoinToSellNanos      uint64
+	DeSoToAddNanos              uint64
+	MinDeSoExpectedNanos        uint64
+	MinCreatorCoinExpectedNanos uint64
+}
+
+type SwapIdentityPayload struct {
+	FromPublicKey string
+	ToPublicKey   string
+}
+
+type UpdateGlobalParamsPayload struct {
+	ExtraData ExtraData
+}
+
+type CreatorCoinTransferPayload struct {
+	ProfilePublicKey           string
+	CreatorCoinToTransferNanos uint64
+	ReceiverPublicKey          string
+	Diamond                    *DiamondPayload `json:",omitempty"`
+}
+
+type CreateNFTPayload struct {
+	NFTPostHash                    HexBytes
+	NumCopies                      uint64
+	HasUnlockable                  bool
+	IsForSale                      bool
+	MinBidAmountNanos              uint64
+	NFTRoyaltyToCreatorBasisPoints uint64
+	NFTRoyaltyToCoinBasisPoints    uint64
+}
+
+type UpdateNFTPayload struct {
+	NFTPostHash       HexBytes
+	SerialNumber      uint64
+	IsForSale         bool
+	MinBidAmountNanos uint64
+}
+
+type AcceptNFTBidPayload struct {
+	NFTPostHash    HexBytes
+	SerialNumber   uint64
+	BidderPKID     string
+	BidAmountNanos uint64
+}
+
+type NFTBidPayload struct {
+	NFTPostHash    HexBytes
+	SerialNumber   uint64
+	BidAmountNanos uint64
+}
+
+type NFTTransferPayload struct {
+	NFTPostHash       HexBytes
+	SerialNumber      uint64
+	ReceiverPublicKey string
+}
+
+type AcceptNFTTransferPayload struct {
+	NFTPostHash  HexBytes
+	SerialNumber uint64
+}
+
+type BurnNFTPayload struct {
+	NFTPostHash  HexBytes
+	SerialNumber uint64
+}
+
+type AuthorizeDerivedKeyPayload struct {
+	DerivedPublicKey string
+	ExpirationBlock  uint64
+	// OperationType is 1 to authorize the key and 0 to revoke it.
+	OperationType uint8
+}
+
+type GroupMemberPayload struct {
+	PublicKey string
+	KeyName   string
+}
+
+type MessagingGroupPayload struct {
+	MessagingPublicKey    string
+	MessagingGroupKeyName string
+	MessagingGroupMembers []*GroupMemberPayload
+}
+
+type DAOCoinPayload struct {
+	ProfilePublicKey          string
+	OperationType             string
+	CoinsToMintNanos          string
+	CoinsToBurnNanos          string
+	TransferRestrictionStatus uint8
+}
+
+type DAOCoinTransferPayload struct {
+	ProfilePublicKey       string
+	DAOCoinToTransferNanos string
+	ReceiverPublicKey      string
+}
+
+// DAOCoinLimitOrderPayload is either a new order or, when CancelOrderID is
+// set, the cancellation of one. An empty buying or selling public key stands
+// for DeSo.
+type DAOCoinLimitOrderPayload struct {
+	BuyingDAOCoinCreatorPublicKey             string
+	SellingDAOCoinCreatorPublicKey            string
+	ScaledExchangeRateCoinsToSellPerCoinToBuy string
+	QuantityToFillInBaseUnits                 string
+	OperationType                             string
+	FillType                                  string
+	CancelOrderID                             HexBytes `json:",omitempty"`
+}
+
+type CreateUserAssociationPayload struct {
+	TargetUserPublicKey string
+	AppPublicKey        string
+	AssociationType     string
+	AssociationValue    string
+}
+
+type CreatePostAssociationPayload struct {
+	PostHash         HexBytes
+	AppPublicKey     string
+	AssociationType  string
+	AssociationValue string
+}
+
+type DeleteAssociationPayload struct {
+	AssociationID HexBytes
+}
+
+type AccessGroupPayload struct {
+	AccessGroupOwnerPublicKey string
+	AccessGroupPublicKey      string
+	AccessGroupKeyName        string
+	AccessGroupOperationType  uint64
+}
+
+type AccessGroupMembersPayload struct {
+	AccessGroupOwnerPublicKey      string
+	AccessGroupKeyName             string
+	AccessGroupMembersList         []*GroupMemberPayload
+	AccessGroupMemberOperationType uint64
+}
+
+// NewMessagePayload leaves the encrypted text out.
+type NewMessagePayload struct {
+	SenderAccessGroupOwnerPublicKey    string
+	SenderAccessGroupKeyName           string
+	SenderAccessGroupPublicKey         string
+	RecipientAccessGroupOwnerPublicKey string
+	RecipientAccessGroupKeyName        string
+	RecipientAccessGroupPublicKey      string
+	TimestampNanos                     uint64
+	NewMessageType                     uint64
+	NewMessageOperation                uint64
+}
+
+func (p *PrivateMessagePayload) affectedPublicKeys() []string {
+	return []string{p.RecipientPublicKey}
+}
+
+func (p *UpdateProfilePayload) affectedPublicKeys() []string {
+	return []string{p.ProfilePublicKey}
+}
+
+func (p *FollowPayload) affectedPublicKeys() []string {
+	return []string{p.FollowedPublicKey}
+}
+
+func (p *CreatorCoinPayload) affectedPublicKeys() []string {
+	return []string{p.ProfilePublicKey}
+}
+
+func (p *SwapIdentityPayload) affectedPublicKeys() []string {
+	return []string{p.FromPublicKey, p.ToPublicKey}
+}
+
+func (p *CreatorCoinTransferPayload) affectedPublicKeys() []string {
+	return []string{p.ProfilePublicKey, p.ReceiverPublicKey}
+}
+
+func (p *AcceptNFTBidPayload) affectedPublicKeys() []string {
+	return []string{p.BidderPKID}
+}
+
+func (p *NFTTransferPayload) affectedPublicKeys() []string {
+	return []string{p.ReceiverPublicKey}
+}
+
+func (p *DAOCoinPayload) affectedPublicKeys() []string {
+	return []string{p.ProfilePublicKey}
+}
+
+func (p *DAOCoinTransferPayload) affectedPublicKeys() []string {
+	return []string{p.ProfilePublicKey, p.ReceiverPublicKey}
+}
+
+func (p *DAOCoinLimitOrderPayload) affectedPublicKeys() []string {
+	return []string{p.BuyingDAOCoinCreatorPublicKey, p.SellingDAOCoinCreatorPublicKey}
+}
+
+func (p *CreateUserAssociationPayload) affectedPublicKeys() []string {
+	return []string{p.TargetUserPublicKey}
+}
+
+func (p *NewMessagePayload) affectedPublicKeys() []string {
+	return []string{p.RecipientAccessGroupOwnerPublicKey}
+}
+
+// DAOCoinOperationType mirrors core's type of the same name.
+type DAOCoinOperationType uint8
+
+var daoCoinOperationTypeNames = map[DAOCoinOperationType]string{
+	0: "mint",
+	1: "burn",
+	2: "disable_minting",
+	3: "update_transfer_restriction_status",
+}
+
+func (op DAOCoinOperationType) String() string {
+	if name, exists := daoCoinOperationTypeNames[op]; exists {
+		return name
+	}
+	return fmt.Sprintf("unknown_%d", uint8(op))
+}
+
+// DAOCoinLimitOrderOperationType mirrors core's type of the same name.
+type DAOCoinLimitOrderOperationType uint64
+
+const (
+	DAOCoinLimitOrderOperationTypeASK DAOCoinLimitOrderOperationType = 1
+	DAOCoinLimitOrderOperationTypeBID DAOCoinLimitOrderOperationType = 2
+)
+
+func (op DAOCoinLimitOrderOperationType) String() string {
+	switch op {
+	case DAOCoinLimitOrderOperationTypeASK:
+		return "ASK"
+	case DAOCoinLimitOrderOperationTypeBID:
+		return "BID"
+	}
+	return fmt.Sprintf("UNKNOWN_%d", uint64(op))
+}
+
+// DAOCoinLimitOrderFillType mirrors core's type of the same name.
+type DAOCoinLimitOrderFillType uint64
+
+func (fillType DAOCoinLimitOrderFillType) String() string {
+	switch fillType {
+	case 1:
+		return "GOOD_TILL_CANCELLED"
+	case 2:
+		return "IMMEDIATE_OR_CANCEL"
+	case 3:
+		return "FILL_OR_KILL"
+	}
+	return fmt.Sprintf("UNKNOWN_%d", uint64(fillType))
+}
+
+// diamondFromExtraData returns the diamond a transfer gives, if any. Core
+// writes the level as a signed varint and the post hash as its raw bytes.
+func diamondFromExtraData(extraData ExtraData) *DiamondPayload {
+	levelBytes, hasLevel := extraData["DiamondLevel"]
+	postHash, hasPostHash := extraData["DiamondPostHash"]
+	if !hasLevel || !hasPostHash {
+		return nil
+	}
+	level, n := binary.Varint(levelBytes)
+	if n <= 0 {
+		return nil
+	}
+	return &DiamondPayload{DiamondLevel: level, DiamondPostHash: postHash}
+}
+
+// postBody returns the body of a post as raw JSON, or as a JSON string if it
+// is not valid JSON.
+func postBody(body []byte) json.RawMessage {
+	if json.Valid(body) {
+		return body
+	}
+	quoted, _ := json.Marshal(string(body))
+	return quoted
+}
+
+// metaReader reads the fields of a txn's metadata in order. The first error
+// is kept in err and every read after it returns a zero value, so that a
+// decoder can read all of its fields and check for an error once.
+type metaReader struct {
+	name string
+	rr   *bytes.Reader
+	err  error
+}
+
+func (r *metaReader) fail(field string, err error) {
+	if r.err == nil {
+		r.err = fmt.Errorf("%s: Problem reading %s: %v", r.name, field, err)
+	}
+}
+
+func (r *metaReader) uvarint(field string) uint64 {
+	if r.err != nil {
+		return 0
+	}
+	value, err := ReadUvarint(r.rr)
+	if err != nil {
+		r.fail(field, err)
+	}
+	return value
+}
+
+// count reads the length of a list and checks that it can fit in what is left.
+func (r *metaReader) count(field string) uint64 {
+	count := r.uvarint(field)
+	if r.err == nil && count > uint64(r.rr.Len()) {
+		r.fail(field, fmt.Errorf("%d items can't fit in the %d bytes left", count, r.rr.Len()))
+		return 0
+	}
+	return count
+}
+
+func (r *metaReader) byte(field string) uint8 {
+	if r.err != nil {
+		return 0
+	}
+	value, err := r.rr.ReadByte()
+	if err != nil {
+		r.fail(field, err)
+	}
+	return value
+}
+
+func (r *metaReader) boolByte(field string) bool {
+	return r.byte(field) != 0
+}
+
+func (r *metaReader) byteArray(field string) []byte {
+	if r.err != nil {
+		return nil
+	}
+	value, err := DecodeByteArray(r.rr)
+	if err != nil {
+		r.fail(field, err)
+	}
+	return value
+}
+
+func (r *metaReader) fixed(field string, length int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	value := make([]byte, length)
+	if _, err := io.ReadFull(r.rr, value); err != nil {
+		r.fail(field, err)
+		return nil
+	}
+	return value
+}
+
+func (r *metaReader) string(field string) string {
+	return string(r.byteArray(field))
+}
+
+// publicKey reads a public key, or a PKID, written as a byte array. An empty
+// one is returned as "".
+func (r *metaReader) publicKey(field string) string {
+	value := r.byteArray(field)
+	if len(value) == 0 {
+		return ""
+	}
+	return PkToString(value)
+}
+
+// coinPublicKey reads the public key of a DAO coin creator in a limit order.
+// Core writes DeSo as the zero public key, which is returned as "" like an
+// empty one.
+func (r *metaReader) coinPublicKey(field string) string {
+	value := r.byteArray(field)
+	if len(value) == 0 || bytes.Equal(value, make([]byte, len(value))) {
+		return ""
+	}
+	return PkToString(value)
+}
+
+// fixedPublicKey reads a public key written as its 33 bytes.
+func (r *metaReader) fixedPublicKey(field string) string {
+	value := r.fixed(field, 33)
+	if value == nil {
+		return ""
+	}
+	return PkToString(value)
+}
+
+// blockHash reads a hash written as its 32 bytes.
+func (r *metaReader) blockHash(field string) HexBytes {
+	return r.fixed(field, 32)
+}
+
+// uint256 reads a uint256 written as a byte array, as a decimal string.
+func (r *metaReader) uint256(field string) string {
+	return new(big.Int).SetBytes(r.byteArray(field)).String()
+}
+
+// optionalUint256 reads a uint256 written with an existence byte, as a
+// decimal string.
+func (r *metaReader) optionalUint256(field string) string {
+	if r.err != nil {
+		return ""
+	}
+	value, err := VariableDecodeUint256(r.rr)
+	if err != nil {
+		r.fail(field, err)
+		return ""
+	}
+	if value == nil {
+		return "0"
+	}
+	return value.String()
+}
+
+func (r *metaReader) extraData(field string) ExtraData {
+	if r.err != nil {
+		return nil
+	}
+	value, err := DecodeExtraData(r.rr)
+	if err != nil {
+		r.fail(field, err)
+	}
+	return value
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/deso-protocol/core/lib"
+)
+
+// coreTxn encodes a txn with the core release in go.mod and decodes it the
+// way the mempool watcher does.
+func coreTxn(t *testing.T, meta lib.DeSoTxnMetadata, extraData map[string][]byte, outputs ...*lib.DeSoOutput) *MsgDeSoTxn {
+	t.Helper()
+	data, err := (&lib.MsgDeSoTxn{
+		TxOutputs: outputs,
+		TxnMeta:   meta,
+		PublicKey: testPublicKey(1),
+		ExtraData: extraData,
+	}).ToBytes(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	txn := &MsgDeSoTxn{}
+	if err := txn.FromBytes(data); err != nil {
+		t.Fatal(err)
+	}
+	return txn
+}
+
+// builtTxn is a txn of a type the core release in go.mod predates, with its
+// metadata written by enc following core's ToBytes.
+func builtTxn(txnType TxnType, enc *testEncoder) *MsgDeSoTxn {
+	return &MsgDeSoTxn{TxnType: txnType, TxnMeta: enc.Bytes(), PublicKey: testPublicKey(1)}
+}
+
+// TestDecodeTxnPayload decodes the metadata of every txn type that has a
+// payload, and checks the public keys each payload adds to the affected ones.
+func TestDecodeTxnPayload(t *testing.T) {
+	pk := func(id byte) string { return PkToString(testPublicKey(id)) }
+	hash := func(id byte) HexBytes { return HexBytes(testBlockHash(id)[:]) }
+	coreHash := func(id byte) *lib.BlockHash { return (*lib.BlockHash)(testBlockHash(id)) }
+	diamond := map[string][]byte{"DiamondLevel": lib.IntToBuf(2), "DiamondPostHash": testBlockHash(4)[:]}
+	wantDiamond := &DiamondPayload{DiamondLevel: 2, DiamondPostHash: hash(4)}
+
+	tests := []struct {
+		name         string
+		txn          func(t *testing.T) *MsgDeSoTxn
+		want         TxnPayload
+		wantAffected []string
+	}{
+		{"BlockReward", func(t *testing.T) *MsgDeSoTxn {
+			return coreTxn(t, &lib.BlockRewardMetadataa{ExtraData: []byte("nonce")}, nil)
+		}, &BlockRewardPayload{ExtraData: HexBytes("nonce")}, nil},
+		{"BasicTransfer", func(t *testing.T) *MsgDeSoTxn {
+			return coreTxn(t, &lib.BasicTransferMetadata{}, diamond, &lib.DeSoOutput{PublicKey: testPublicKey(2), AmountNanos: 500})
+		}, &BasicTransferPayload{Outputs: []*OutputPayload{{PublicKey: pk(2), AmountNanos: 500}}, Diamond: wantDiamond}, nil},
+		{"BitcoinExchange", func(t *testing.T) *MsgDeSoTxn {
+			return &MsgDeSoTxn{TxnType: TxnTypeBitcoinExchange, TxnMeta: HexBytes{1, 2, 3}}
+		}, &RawPayload{TxnMeta: HexBytes{1, 2, 3}}, nil},
+		{"PrivateMessage", func(t *testing.T) *MsgDeSoTxn {
+			return coreTxn(t, &lib.PrivateMessageMetadata{
+				RecipientPublicKey: testPublicKey(2), EncryptedText: []byte("secret"), TimestampNanos: 1700000000000000000,
+			}, nil)
+		}, &PrivateMessagePayload{RecipientPublicKey: pk(2), EncryptedText: HexBytes("secret"), TimestampNanos: 1700000000000000000},
+			[]string{pk(2)}},
+		{"SubmitPost", func(t *testing.T) *MsgDeSoTxn {
+			return coreTxn(t, &lib.SubmitPostMetadata{
+				ParentStakeID: testBlockHash(3)[:], Body: []byte(`{"Body":"gm"}`), TimestampNanos: 12,
+			}, map[string][]byte{"RepostedPostHash": testBlockHash(5)[:], "IsQuotedRepost": []byte("1")})
+		}, &SubmitPostPayload{
+			ParentStakeID: hash(3), Body: json.RawMessage(`{"Body":"gm"}`),
+			TimestampNanos: 12, RepostedPostHash: hash(5), IsQuotedRepost: true,
+		}, nil},
+		{"SubmitPost with a plain text body", func(t *testing.T) *MsgDeSoTxn {
+			return coreTxn(t, &lib.SubmitPostMetadata{Body: []byte("gm"), IsHidden: true}, nil)
+		}, &SubmitPostPayload{Body: json.RawMessage(`"gm"`), IsHidden: true}, nil},
+		{"UpdateProfile", func(t *testing.T) *MsgDeSoTxn {
+			return coreTxn(t, &lib.UpdateProfileMetadata{
+				ProfilePublicKey: testPublicKey(2), NewUsername: []byte("Alice"), NewDescription: []byte("About Alice"),
+				NewProfilePic: []byte("data:image/png;base64,"), NewCreatorBasisPoints: 1000, NewStakeMultipleBasisPoints: 12500,
+			}, nil)
+		}, &UpdateProfilePayload{
+			ProfilePublicKey: pk(2), NewUsername: "Alice", NewDescription: "About Alice", HasNewProfilePic: true,
+			NewCreatorBasisPoints: 1000, NewStakeMultipleBasisPoints: 12500,
+		}, []string{pk(2)}},
+		{"UpdateBitcoinUSDExchangeRate", func(t *testing.T) *MsgDeSoTxn {
+			return coreTxn(t, &lib.UpdateBitcoinUSDExchangeRateMetadataa{USDCentsPerBitcoin: 3000000}, nil)
+		}, &UpdateBitcoinUSDExchangeRatePayload{USDCentsPerBitcoin: 3000000}, nil},
+		{"Follow", func(t *testing.T) *MsgDeSoTxn {
+			return coreTxn(t, &lib.FollowMetadata{FollowedPublicKey: testPublicKey(2), IsUnfollow: true}, nil)
+		}, &FollowPayload{FollowedPublicKey: pk(2), IsUnfollow: true}, []string{pk(2)}},
+		{"Like", func(t *testing.T) *MsgDeSoTxn {
+			return coreTxn(t, &lib.LikeMetadata{LikedPostHash: coreHash(3)}, nil)
+		}, &LikePayload{LikedPostHash: hash(3)}, nil},
+		{"CreatorCoin", func(t *testing.T) *MsgDeSoTxn {
+			return coreTxn(t, &lib.CreatorCoinMetadataa{
+				ProfilePublicKey: testPublicKey(2), OperationType: lib.CreatorCoinOperationTypeSell,
+				CreatorCoinToSellNanos: 250, MinDeSoExpectedNanos: 100,
+			}, nil)
+		}, &CreatorCoinPayload{ProfilePublicKey: pk(2), OperationType: "sell", CreatorCoinToSellNanos: 250, MinDeSoExpectedNanos: 100},
+			[]string{pk(2)}},
+		{"SwapIdentity", func(t *testing.T) *MsgDeSoTxn {
+			return coreTxn(t, &lib.SwapIdentityMetadataa{FromPublicKey: testPublicKey(2), ToPublicKey: testPublicKey(3)}, nil)
+		}, &SwapIdentityPayload{FromPublicKey: pk(2), ToPublicKey: pk(3)}, []string{pk(2), pk(3)}},
+		{"UpdateGlobalParams", func(t *testing.T) *MsgDeSoTxn {
+			return coreTxn(t, &lib.UpdateGlobalParamsMetadata{}, map[string][]byte{"MinNetworkFeeNanosPerKB": lib.UintToBuf(1000)})
+		}, &UpdateGlobalParamsPayload{ExtraData: ExtraData{"MinNetworkFeeNanosPerKB": lib.UintToBuf(1000)}}, nil},
+		{"CreatorCoinTransfer", func(t *testing.T) *MsgDeSoTxn {
+			return coreTxn(t, &lib.CreatorCoinTransferMetadataa{
+				ProfilePublicKey: testPublicKey(2), CreatorCoinToTransferNanos: 300, ReceiverPublicKey: testPublicKey(3),
+			}, diamond)
+		}, &CreatorCoinTransferPayload{ProfilePublicKey: pk(2), CreatorCoinToTransferNanos: 300, ReceiverPublicKey: pk(3), Diamond: wantDiamond},
+			[]string{pk(2), pk(3)}},
+		{"CreateNFT", func(t *testing.T) *MsgDeSoTxn {
+			return coreTxn(t, &lib.CreateNFTMetadata{
+				NFTPostHash: coreHash(3), NumCopies: 10, HasUnlockable: true, IsForSale: true, MinBidAmountNanos: 1000,
+				NFTRoyaltyToCreatorBasisPoints: 500, NFTRoyaltyToCoinBasisPoints: 200,
+			}, nil)
+		}, &CreateNFTPayload{
+			NFTPostHash: hash(3), NumCopies: 10, HasUnlockable: true, IsForSale: true, MinBidAmountNanos: 1000,
+			NFTRoyaltyToCreatorBasisPoints: 500, NFTRoyaltyToCoinBasisPoints: 200,
+		}, nil},
+		{"UpdateNFT", func(t *testing.T) *MsgDeSoTxn {
+			return coreTxn(t, &lib.UpdateNFTMetadata{NFTPostHash: coreHash(3), SerialNumber: 2, IsForSale: true, MinBidAmountNanos: 50}, nil)
+		}, &UpdateNFTPayload{NFTPostHash: hash(3), SerialNumber: 2, IsForSale: true, MinBidAmountNanos: 50}, nil},
+		{"AcceptNFTBid", func(t *testing.T) *MsgDeSoTxn {
+			return coreTxn(t, &lib.AcceptNFTBidMetadata{
+				NFTPostHash: coreHash(3), SerialNumber: 2, BidderPKID: (*lib.PKID)(testPKID(2)), BidAmountNanos: 700,
+				UnlockableText: []byte("unlocked"), BidderInputs: []*lib.DeSoInput{{TxID: *coreHash(6), Index: 1}},
+			}, nil)
+		}, &AcceptNFTBidPayload{NFTPostHash: hash(3), SerialNumber: 2, BidderPKID: pk(2), BidAmountNanos: 700}, []string{pk(2)}},
+		{"NFTBid", func(t *testing.T) *MsgDeSoTxn {
+			return coreTxn(t, &lib.NFTBidMetadata{NFTPostHash: coreHash(3), SerialNumber: 2, BidAmountNanos: 700}, nil)
+		}, &NFTBidPayload{NFTPostHash: hash(3), SerialNumber: 2, BidAmountNanos: 700}, nil},
+		{"NFTTransfer", func(t *testing.T) *MsgDeSoTxn {
+			return coreTxn(t, &lib.NFTTransferMetadata{
+				NFTPostHash: coreHash(3), SerialNumber: 2, ReceiverPublicKey: testPublicKey(2), UnlockableText: []byte("unlocked"),
+			}, nil)
+		}, &NFTTransferPayload{NFTPostHash: hash(3), SerialNumber: 2, ReceiverPublicKey: pk(2)}, []string{pk(2)}},
+		{"AcceptNFTTransfer", func(t *testing.T) *MsgDeSoTxn {
+			return coreTxn(t, &lib.AcceptNFTTransferMetadata{NFTPostHash: coreHash(3), SerialNumber: 2}, nil)
+		}, &AcceptNFTTransferPayload{NFTPostHash: hash(3), SerialNumber: 2}, nil},
+		{"BurnNFT", func(t *testing.T) *MsgDeSoTxn {
+			return coreTxn(t, &lib.BurnNFTMetadata{NFTPostHash: coreHash(3), SerialNumber: 2}, nil)
+		}, &BurnNFTPayload{NFTPostHash: hash(3), SerialNumber: 2}, nil},
+		{"AuthorizeDerivedKey", func(t *testing.T) *MsgDeSoTxn {
+			return coreTxn(t, &lib.AuthorizeDerivedKeyMetadata{
+				DerivedPublicKey: testPublicKey(2), ExpirationBlock: 90000,
+				OperationType: lib.AuthorizeDerivedKeyOperationValid, AccessSignature: []byte("signature"),
+			}, nil)
+		}, &AuthorizeDerivedKeyPayload{DerivedPublicKey: pk(2), ExpirationBlock: 90000, OperationType: 1}, nil},
+		{"MessagingGroup", func(t *testing.T) *MsgDeSoTxn {
+			return builtTxn(TxnTypeMessagingGroup, new(testEncoder).byteArray(testPublicKey(2)).byteArray([]byte("friends")).
+				byteArray([]byte("signature")).uvarint(1).
+				byteArray(testPublicKey(3)).byteArray([]byte("default-key")).byteArray([]byte("encrypted")))
+		}, &MessagingGroupPayload{
+			MessagingPublicKey: pk(2), MessagingGroupKeyName: "friends",
+			MessagingGroupMembers: []*GroupMemberPayload{{PublicKey: pk(3), KeyName: "default-key"}},
+		}, nil},
+		{"DAOCoin", func(t *testing.T) *MsgDeSoTxn {
+			enc := new(testEncoder).byteArray(testPublicKey(2))
+			enc.WriteByte(0)
+			enc.byteArray(big.NewInt(1000000).Bytes()).byteArray(nil)
+			enc.WriteByte(0)
+			return builtTxn(TxnTypeDAOCoin, enc)
+		}, &DAOCoinPayload{ProfilePublicKey: pk(2), OperationType: "mint", CoinsToMintNanos: "1000000", CoinsToBurnNanos: "0"},
+			[]string{pk(2)}},
+		{"DAOCoinTransfer", func(t *testing.T) *MsgDeSoTxn {
+			return builtTxn(TxnTypeDAOCoinTransfer, new(testEncoder).byteArray(testPublicKey(2)).
+				byteArray(big.NewInt(400).Bytes()).byteArray(testPublicKey(3)))
+		}, &DAOCoinTransferPayload{ProfilePublicKey: pk(2), DAOCoinToTransferNanos: "400", ReceiverPublicKey: pk(3)},
+			[]string{pk(2), pk(3)}},
+		{"DAOCoinLimitOrder", func(t *testing.T) *MsgDeSoTxn {
+			// Buying the coin with DeSo, which core writes as the zero public
+			// key, followed by the bidder inputs and the fee.
+			return builtTxn(TxnTypeDAOCoinLimitOrder, new(testEncoder).byteArray(testPublicKey(2)).byteArray(make([]byte, 33)).
+				uint256(big.NewInt(15)).uint256(big.NewInt(250)).uvarint(uint64(DAOCoinLimitOrderOperationTypeBID)).uvarint(1).
+				byteArray(nil).uvarint(0).uvarint(1000))
+		}, &DAOCoinLimitOrderPayload{
+			BuyingDAOCoinCreatorPublicKey: pk(2), ScaledExchangeRateCoinsToSellPerCoinToBuy: "15", QuantityToFillInBaseUnits: "250",
+			OperationType: "BID", FillType: "GOOD_TILL_CANCELLED",
+		}, []string{pk(2)}},
+		{"DAOCoinLimitOrder cancellation", func(t *testing.T) *MsgDeSoTxn {
+			return builtTxn(TxnTypeDAOCoinLimitOrder, new(testEncoder).byteArray(nil).byteArray(nil).
+				uint256(nil).uint256(nil).uvarint(0).uvarint(0).byteArray(testBlockHash(7)[:]).uvarint(0).uvarint(0))
+		}, &DAOCoinLimitOrderPayload{
+			ScaledExchangeRateCoinsToSellPerCoinToBuy: "0", QuantityToFillInBaseUnits: "0",
+			OperationType: "UNKNOWN_0", FillType: "UNKNOWN_0", CancelOrderID: hash(7),
+		}, nil},
+		{"CreateUserAssociation", func(t *testing.T) *MsgDeSoTxn {
+			return builtTxn(TxnTypeCreateUserAssociation, new(testEncoder).byteArray(testPublicKey(2)).byteArray(testPublicKey(3)).
+				byteArray([]byte("ENDORSEMENT")).byteArray([]byte("Go")))
+		}, &CreateUserAssociationPayload{TargetUserPublicKey: pk(2), AppPublicKey: pk(3), AssociationType: "ENDORSEMENT", AssociationValue: "Go"},
+			[]string{pk(2)}},
+		{"DeleteUserAssociation", func(t *testing.T) *MsgDeSoTxn {
+			return builtTxn(TxnTypeDeleteUserAssociation, new(testEncoder).byteArray(testBlockHash(8)[:]))
+		}, &DeleteAssociationPayload{AssociationID: hash(8)}, nil},
+		{"CreatePostAssociation", func(t *testing.T) *MsgDeSoTxn {
+			return builtTxn(TxnTypeCreatePostAssociation, new(testEncoder).byteArray(testBlockHash(3)[:]).byteArray(testPublicKey(3)).
+				byteArray([]byte("REACTION")).byteArray([]byte("LIKE")))
+		}, &CreatePostAssociationPayload{PostHash: hash(3), AppPublicKey: pk(3), AssociationType: "REACTION", AssociationValue: "LIKE"}, nil},
+		{"DeletePostAssociation", func(t *testing.T) *MsgDeSoTxn {
+			return builtTxn(TxnTypeDeletePostAssociation, new(testEncoder).byteArray(testBlockHash(8)[:]))
+		}, &DeleteAssociationPayload{AssociationID: hash(8)}, nil},
+		{"AccessGroup", func(t *testing.T) *MsgDeSoTxn {
+			return builtTxn(TxnTypeAccessGroup, new(testEncoder).byteArray(testPublicKey(1)).byteArray(testPublicKey(2)).
+				byteArray([]byte("friends")).uvarint(2))
+		}, &AccessGroupPayload{AccessGroupOwnerPublicKey: pk(1), AccessGroupPublicKey: pk(2), AccessGroupKeyName: "friends", AccessGroupOperationType: 2},
+			nil},
+		{"AccessGroupMembers", func(t *testing.T) *MsgDeSoTxn {
+			return builtTxn(TxnTypeAccessGroupMembers, new(testEncoder).byteArray(testPublicKey(1)).byteArray([]byte("friends")).uvarint(2).
+				byteArray(testPublicKey(2)).byteArray([]byte("default-key")).byteArray([]byte("encrypted")).extraData(nil).
+				byteArray(testPublicKey(3)).byteArray([]byte("default-key")).byteArray(nil).extraData(map[string]string{"k": "v"}).
+				uvarint(3))
+		}, &AccessGroupMembersPayload{
+			AccessGroupOwnerPublicKey: pk(1), AccessGroupKeyName: "friends",
+			AccessGroupMembersList: []*GroupMemberPayload{
+				{PublicKey: pk(2), KeyName: "default-key"},
+				{PublicKey: pk(3), KeyName: "default-key"},
+			},
+			AccessGroupMemberOperationType: 3,
+		}, nil},
+		{"NewMessage", func(t *testing.T) *MsgDeSoTxn {
+			return builtTxn(TxnTypeNewMessage, new(testEncoder).byteArray(testPublicKey(1)).byteArray([]byte("default-key")).
+				byteArray(testPublicKey(4)).byteArray(testPublicKey(2)).byteArray([]byte("default-key")).byteArray(testPublicKey(5)).
+				byteArray([]byte("encrypted")).uvarint(1700000000000000000).uvarint(1).uvarint(0))
+		}, &NewMessagePayload{
+			SenderAccessGroupOwnerPublicKey: pk(1), SenderAccessGroupKeyName: "default-key", SenderAccessGroupPublicKey: pk(4),
+			RecipientAccessGroupOwnerPublicKey: pk(2), RecipientAccessGroupKeyName: "default-key", RecipientAccessGroupPublicKey: pk(5),
+			TimestampNanos: 1700000000000000000, NewMessageType: 1,
+		}, []string{pk(2)}},
+	}
+
+	covered := make(map[TxnType]bool)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			txn := test.txn(t)
+			covered[txn.TxnType] = true
+			payload, err := decodeTxnPayload(txn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Payloads are compared as the bot gets them, where an empty
+			// byte array is the same as a missing one.
+			got, err := json.Marshal(payload)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := json.Marshal(test.want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if reflect.TypeOf(payload) != reflect.TypeOf(test.want) || !bytes.Equal(got, want) {
+				t.Errorf("got %T %s, want %T %s", payload, got, test.want, want)
+			}
+			var affected []string
+			if payload, ok := payload.(affectsPublicKeys); ok {
+				affected = payload.affectedPublicKeys()
+			}
+			// The DeSo side of a limit order is "", which newTransactionData
+			// skips.
+			var nonEmpty []string
+			for _, publicKey := range affected {
+				if publicKey != "" {
+					nonEmpty = append(nonEmpty, publicKey)
+				}
+			}
+			if !reflect.DeepEqual(nonEmpty, test.wantAffected) {
+				t.Errorf("got affected public keys %q, want %q", nonEmpty, test.wantAffected)
+			}
+		})
+	}
+	for txnType := range txnPayloadDecoders {
+		if !covered[txnType] {
+			t.Errorf("no test for %v", txnType)
+		}
+	}
+}
+
+// TestDecodeTxnPayloadTruncated cuts the metadata of a txn short, which must
+// give back the raw metadata and an error naming the field.
+func TestDecodeTxnPayloadTruncated(t *testing.T) {
+	meta := new(testEncoder).byteArray(testPublicKey(2)).byteArray(big.NewInt(400).Bytes()).byteArray(testPublicKey(3)).Bytes()
+	for _, test := range []struct {
+		name    string
+		meta    []byte
+		wantErr string
+	}{
+		{"cut in a public key", meta[:len(meta)-1], "DAO_COIN_TRANSFER: Problem reading ReceiverPublicKey"},
+		{"missing field", meta[:35], "DAO_COIN_TRANSFER: Problem reading DAOCoinToTransferNanos"},
+		{"empty", nil, "DAO_COIN_TRANSFER: Problem reading ProfilePublicKey"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			txn := &MsgDeSoTxn{TxnType: TxnTypeDAOCoinTransfer, TxnMeta: test.meta}
+			payload, err := decodeTxnPayload(txn)
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Fatalf("got error %v, want one containing %q", err, test.wantErr)
+			}
+			raw, ok := payload.(*RawPayload)
+			if !ok || !bytes.Equal(raw.TxnMeta, test.meta) {
+				t.Errorf("got payload %#v, want the raw metadata", payload)
+			}
+		})
+	}
+
+	// A member count that can't fit in the metadata is an error rather than
+	// a huge allocation.
+	txn := builtTxn(TxnTypeAccessGroupMembers, new(testEncoder).byteArray(testPublicKey(1)).byteArray(nil).uvarint(1<<40))
+	if _, err := decodeTxnPayload(txn); err == nil || !strings.Contains(err.Error(), "can't fit") {
+		t.Errorf("got error %v, want one for the member count", err)
+	}
+}
@@ -0,0 +1,369 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// dbPrefixesNextTag is the NEXT_TAG of DBPrefixes, the id core will give the
+// next prefix it adds. Comments don't make it into the binary, so it is kept
+// here as well and the tests check it against the NEXT_TAG comment.
+const dbPrefixesNextTag = 80
+
+// prefixTags are the struct tags a DBPrefixes field can have.
+var prefixTags = append([]string{"prefix_id"}, prefixCategories...)
+
+var nextTagPattern = regexp.MustCompile(`NEXT_TAG:\s*(\d+)`)
+
+// registryPrefix is a field of a DBPrefixes struct.
+type registryPrefix struct {
+	Name string
+	// Where is the field as it is named in messages.
+	Where string
+	Tag   string
+	// ID is the prefix_id, or nil if the tag is missing or malformed.
+	ID []byte
+	// Documented is only known for registries parsed from source.
+	Documented bool
+}
+
+// prefixRegistry is a DBPrefixes struct, either ours or the one in core's
+// lib/db_utils.go.
+type prefixRegistry struct {
+	Name     string
+	Prefixes []*registryPrefix
+	// NextTag is the value of the NEXT_TAG comment, or -1 if there isn't one.
+	NextTag int
+	// FromSource is set when the registry was parsed from Go source, which
+	// is the only way to tell whether its fields have comments.
+	FromSource bool
+}
+
+// reflectPrefixRegistry reads the fields of the struct type prefixesType,
+// which is DBPrefixes outside of tests.
+func reflectPrefixRegistry(prefixesType reflect.Type, nextTag int) *prefixRegistry {
+	registry := &prefixRegistry{Name: prefixesType.Name(), NextTag: nextTag}
+	for i := 0; i < prefixesType.NumField(); i++ {
+		field := prefixesType.Field(i)
+		p := &registryPrefix{
+			Name:  field.Name,
+			Where: fmt.Sprintf("%s.%s", registry.Name, field.Name),
+			Tag:   string(field.Tag),
+		}
+		p.ID, _ = parsePrefixID(p.Tag)
+		registry.Prefixes = append(registry.Prefixes, p)
+	}
+	return registry
+}
+
+// parsePrefixRegistry finds the DBPrefixes struct in the Go source src.
+func parsePrefixRegistry(file string, src []byte) (*prefixRegistry, error) {
+	fset := token.NewFileSet()
+	parsed, err := parser.ParseFile(fset, file, src, parser.ParseComments)
+	if err != nil {
+		return nil, fmt.Errorf("parsePrefixRegistry: Problem parsing %s: %v", file, err)
+	}
+	var structType *ast.StructType
+	ast.Inspect(parsed, func(node ast.Node) bool {
+		if spec, ok := node.(*ast.TypeSpec); ok && spec.Name.Name == "DBPrefixes" {
+			structType, _ = spec.Type.(*ast.StructType)
+		}
+		return structType == nil
+	})
+	if structType == nil {
+		return nil, fmt.Errorf("parsePrefixRegistry: %s doesn't declare a DBPrefixes struct", file)
+	}
+
+	registry := &prefixRegistry{Name: file, NextTag: -1, FromSource: true}
+	// Fields declared right below a documented one, with no blank line in
+	// between, share its comment.
+	previousEnd, previousDocumented := 0, false
+	for _, field := range structType.Fields.List {
+		line := fset.Position(field.Pos()).Line
+		documented := field.Doc != nil || (previousDocumented && line == previousEnd+1)
+		previousEnd, previousDocumented = fset.Position(field.End()).Line, documented
+
+		tag := ""
+		if field.Tag != nil {
+			tag, _ = strconv.Unquote(field.Tag.Value)
+		}
+		for _, name := range field.Names {
+			p := &registryPrefix{
+				Name:       name.Name,
+				Where:      fmt.Sprintf("%s:%d: %s", file, line, name.Name),
+				Tag:        tag,
+				Documented: documented,
+			}
+			p.ID, _ = parsePrefixID(tag)
+			registry.Prefixes = append(registry.Prefixes, p)
+		}
+	}
+	for _, group := range parsed.Comments {
+		if group.Pos() < structType.Pos() || group.End() > structType.End() {
+			continue
+		}
+		if match := nextTagPattern.FindStringSubmatch(group.Text()); match != nil {
+			registry.NextTag, _ = strconv.Atoi(match[1])
+		}
+	}
+	return registry, nil
+}
+
+// fillPrefixes sets every []byte field of the struct prefixes points to to
+// its prefix_id. It fails, leaving prefixes unchanged, if checkPrefixIDs
+// finds anything wrong with the struct's tags.
+func fillPrefixes(prefixes interface{}) error {
+	prefixElements := reflect.ValueOf(prefixes).Elem()
+	registry := reflectPrefixRegistry(prefixElements.Type(), -1)
+	report := &prefixRegistryReport{}
+	checkPrefixIDs(registry, report)
+	if len(report.Errors) > 0 {
+		return fmt.Errorf("%s is invalid: %s", registry.Name, strings.Join(report.Errors, "; "))
+	}
+	for i, p := range registry.Prefixes {
+		// The capacity is capped so that appending to a prefix copies it.
+		prefixElements.Field(i).SetBytes(p.ID[:len(p.ID):len(p.ID)])
+	}
+	return nil
+}
+
+// parsePrefixID parses the prefix_id of a struct tag.
+func parsePrefixID(tag string) ([]byte, error) {
+	value, exists := lookupTag(tag, "prefix_id")
+	if !exists || value == "" || value == "-" || value == "[]" {
+		return nil, fmt.Errorf("missing prefix_id")
+	}
+	var id []int
+	if err := json.Unmarshal([]byte(value), &id); err != nil {
+		return nil, fmt.Errorf("malformed prefix_id %q: %v", value, err)
+	}
+	for _, number := range id {
+		if number < 0 || number > 255 {
+			return nil, fmt.Errorf("malformed prefix_id %q: %d is not a byte", value, number)
+		}
+	}
+	prefixID := make([]byte, len(id))
+	for i := range id {
+		prefixID[i] = byte(id[i])
+	}
+	return prefixID, nil
+}
+
+// structTag is one key:"value" pair of a struct tag.
+type structTag struct {
+	Key   string
+	Value string
+}
+
+// parseStructTag splits a struct tag into its pairs, following the convention
+// reflect.StructTag.Lookup parses.
+func parseStructTag(tag string) ([]*structTag, error) {
+	var pairs []*structTag
+	for tag = strings.TrimLeft(tag, " "); tag != ""; tag = strings.TrimLeft(tag, " ") {
+		colon := strings.Index(tag, ":")
+		if colon <= 0 || colon+1 >= len(tag) || tag[colon+1] != '"' {
+			return nil, fmt.Errorf("malformed struct tag %q", tag)
+		}
+		key := tag[:colon]
+		rest := tag[colon+1:]
+		end := 1
+		for end < len(rest) && rest[end] != '"' {
+			if rest[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(rest) {
+			return nil, fmt.Errorf("malformed struct tag %q", tag)
+		}
+		value, err := strconv.Unquote(rest[:end+1])
+		if err != nil {
+			return nil, fmt.Errorf("malformed struct tag %q", tag)
+		}
+		pairs = append(pairs, &structTag{Key: key, Value: value})
+		tag = rest[end+1:]
+	}
+	return pairs, nil
+}
+
+func lookupTag(tag string, key string) (string, bool) {
+	pairs, _ := parseStructTag(tag)
+	for _, pair := range pairs {
+		if pair.Key == key {
+			return pair.Value, true
+		}
+	}
+	return "", false
+}
+
+// prefixRegistryReport is what validatePrefixRegistry found. Errors are things
+// that break GetPrefixes or the lookups built on it, warnings are things that
+// only make the registry harder to keep in sync with core.
+type prefixRegistryReport struct {
+	Prefixes int      `json:"prefixes"`
+	NextTag  int      `json:"nextTag"`
+	Errors   []string `json:"errors"`
+	Warnings []string `json:"warnings"`
+	// Unmapped are the ids below NEXT_TAG no prefix uses.
+	Unmapped []int `json:"unmapped"`
+	// Upstream lists the differences with core's registry, if it was given.
+	Upstream []string `json:"upstream,omitempty"`
+}
+
+func (report *prefixRegistryReport) errorf(format string, args ...interface{}) {
+	report.Errors = append(report.Errors, fmt.Sprintf(format, args...))
+}
+
+func (report *prefixRegistryReport) warnf(format string, args ...interface{}) {
+	report.Warnings = append(report.Warnings, fmt.Sprintf(format, args...))
+}
+
+// validatePrefixRegistry runs checkPrefixIDs on registry, and also checks
+// that NEXT_TAG is one past the largest id and, for registries parsed from
+// source, that every prefix has a comment. If upstream isn't nil, the ids and
+// names of both registries are compared.
+func validatePrefixRegistry(registry *prefixRegistry, upstream *prefixRegistry) *prefixRegistryReport {
+	report := &prefixRegistryReport{Prefixes: len(registry.Prefixes), NextTag: registry.NextTag}
+	byID := checkPrefixIDs(registry, report)
+
+	maxID := -1
+	for _, p := range registry.Prefixes {
+		if len(p.ID) == 1 && int(p.ID[0]) > maxID {
+			maxID = int(p.ID[0])
+		}
+		if registry.FromSource && !p.Documented {
+			report.warnf("%s: no comment describing the key and value format", p.Where)
+		}
+	}
+	switch {
+	case registry.NextTag < 0:
+		report.errorf("%s has no NEXT_TAG", registry.Name)
+	case registry.NextTag != maxID+1:
+		report.errorf("%s: NEXT_TAG is %d but the largest prefix_id is %d, it should be %d",
+			registry.Name, registry.NextTag, maxID, maxID+1)
+	}
+	for id := 0; id < registry.NextTag || id <= maxID; id++ {
+		if _, exists := byID[string([]byte{byte(id)})]; !exists {
+			report.Unmapped = append(report.Unmapped, id)
+		}
+	}
+
+	if upstream != nil {
+		report.Upstream = diffPrefixRegistries(registry, upstream)
+	}
+	return report
+}
+
+// checkPrefixIDs reports the problems that keep GetPrefixes from using
+// registry: duplicate, missing and malformed ids, and unknown or malformed
+// tags. It returns the prefixes with a valid id, by id.
+func checkPrefixIDs(registry *prefixRegistry, report *prefixRegistryReport) map[string][]*registryPrefix {
+	byID := make(map[string][]*registryPrefix)
+	var problems []string
+	errorf := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+	for _, p := range registry.Prefixes {
+		pairs, err := parseStructTag(p.Tag)
+		if err != nil {
+			errorf("%s: %v", p.Where, err)
+			continue
+		}
+		seen := make(map[string]bool)
+		for _, pair := range pairs {
+			switch {
+			case !containsString(prefixTags, pair.Key):
+				errorf("%s: unknown tag %s, expected one of %s", p.Where, pair.Key, strings.Join(prefixTags, ", "))
+			case seen[pair.Key]:
+				errorf("%s: tag %s is set twice", p.Where, pair.Key)
+			case pair.Key != "prefix_id" && pair.Value != "true" && pair.Value != "false":
+				errorf("%s: tag %s must be true or false, got %q", p.Where, pair.Key, pair.Value)
+			}
+			seen[pair.Key] = true
+		}
+		if _, err := parsePrefixID(p.Tag); err != nil {
+			errorf("%s: %v", p.Where, err)
+			continue
+		}
+		if len(p.ID) != 1 {
+			errorf("%s: prefix_id %v is %d bytes long, prefixes are a single byte", p.Where, bytesToInts(p.ID), len(p.ID))
+		}
+		byID[string(p.ID)] = append(byID[string(p.ID)], p)
+	}
+	for _, prefixes := range byID {
+		if len(prefixes) < 2 {
+			continue
+		}
+		var names []string
+		for _, p := range prefixes {
+			names = append(names, p.Name)
+		}
+		errorf("%s: prefix_id %v is used by %s", registry.Name, bytesToInts(prefixes[0].ID), strings.Join(names, ", "))
+	}
+	sort.Strings(problems)
+	report.Errors = append(report.Errors, problems...)
+	return byID
+}
+
+// diffPrefixRegistries lists the single byte ids that are missing from or
+// named differently in ours compared to upstream, in id order.
+func diffPrefixRegistries(ours *prefixRegistry, upstream *prefixRegistry) []string {
+	index := func(registry *prefixRegistry) map[int]*registryPrefix {
+		byID := make(map[int]*registryPrefix)
+		for _, p := range registry.Prefixes {
+			if len(p.ID) == 1 {
+				byID[int(p.ID[0])] = p
+			}
+		}
+		return byID
+	}
+	oursByID, upstreamByID := index(ours), index(upstream)
+
+	var diffs []string
+	for id := 0; id < 256; id++ {
+		our, their := oursByID[id], upstreamByID[id]
+		switch {
+		case our == nil && their != nil:
+			diffs = append(diffs, fmt.Sprintf("[%d] %s is not mapped", id, their.Name))
+		case our != nil && their == nil:
+			diffs = append(diffs, fmt.Sprintf("[%d] %s doesn't exist upstream", id, our.Name))
+		case our != nil && our.Name != their.Name:
+			diffs = append(diffs, fmt.Sprintf("[%d] is %s here and %s upstream", id, our.Name, their.Name))
+		}
+	}
+	if ours.NextTag != upstream.NextTag {
+		diffs = append(diffs, fmt.Sprintf("NEXT_TAG is %d here and %d upstream", ours.NextTag, upstream.NextTag))
+	}
+	return diffs
+}
+
+// loadPrefixRegistryFile parses the DBPrefixes of the Go file at path, our
+// main.go or core's lib/db_utils.go, or returns nil if path is empty.
+func loadPrefixRegistryFile(path string) (*prefixRegistry, error) {
+	if path == "" {
+		return nil, nil
+	}
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("loadPrefixRegistryFile: Problem reading %s: %v", path, err)
+	}
+	return parsePrefixRegistry(path, src)
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testPrefixesType returns a struct type with a []byte field per tag, named
+// A, B, C and so on. The struct is built at run time since vet rejects the
+// malformed tags in a struct literal.
+func testPrefixesType(tags ...string) reflect.Type {
+	var fields []reflect.StructField
+	for i, tag := range tags {
+		fields = append(fields, reflect.StructField{
+			Name: string(rune('A' + i)),
+			Type: reflect.TypeOf([]byte{}),
+			Tag:  reflect.StructTag(tag),
+		})
+	}
+	return reflect.StructOf(fields)
+}
+
+func TestValidatePrefixRegistry(t *testing.T) {
+	tests := []struct {
+		name         string
+		tags         []string
+		nextTag      int
+		wantErrors   []string
+		wantUnmapped []int
+	}{
+		{"valid", []string{`prefix_id:"[0]" is_state:"true"`, `prefix_id:"[1]" core_state:"false"`}, 2, nil, nil},
+		{"duplicate id", []string{`prefix_id:"[0]"`, `prefix_id:"[0]"`}, 1,
+			[]string{"prefix_id [0] is used by A, B"}, nil},
+		{"unknown tag", []string{`prefix_id:"[0]" is_stat:"true"`}, 1, []string{"A: unknown tag is_stat"}, nil},
+		{"tag set twice", []string{`prefix_id:"[0]" is_state:"true" is_state:"false"`}, 1,
+			[]string{"A: tag is_state is set twice"}, nil},
+		{"category not a bool", []string{`prefix_id:"[0]" is_txindex:"yes"`}, 1,
+			[]string{`A: tag is_txindex must be true or false, got "yes"`}, nil},
+		{"malformed tag", []string{`prefix_id:[0]`}, 0, []string{"A: malformed struct tag"}, nil},
+		{"missing id", []string{`is_state:"true"`}, 0, []string{"A: missing prefix_id"}, nil},
+		{"malformed id", []string{`prefix_id:"[256]"`}, 0, []string{"A: malformed prefix_id"}, nil},
+		{"multi byte id", []string{`prefix_id:"[1, 2]"`}, 0, []string{"A: prefix_id [1 2] is 2 bytes long"}, nil},
+		{"NEXT_TAG behind", []string{`prefix_id:"[0]"`, `prefix_id:"[1]"`}, 1,
+			[]string{"NEXT_TAG is 1 but the largest prefix_id is 1, it should be 2"}, nil},
+		{"NEXT_TAG ahead", []string{`prefix_id:"[0]"`}, 3,
+			[]string{"NEXT_TAG is 3 but the largest prefix_id is 0, it should be 1"}, []int{1, 2}},
+		{"no NEXT_TAG", []string{`prefix_id:"[0]"`}, -1, []string{"has no NEXT_TAG"}, nil},
+		{"unmapped ids", []string{`prefix_id:"[0]"`, `prefix_id:"[2]"`, `prefix_id:"[5]"`}, 6, nil, []int{1, 3, 4}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			registry := reflectPrefixRegistry(testPrefixesType(test.tags...), test.nextTag)
+			report := validatePrefixRegistry(registry, nil)
+			if len(report.Errors) != len(test.wantErrors) {
+				t.Fatalf("got errors %q, want ones containing %q", report.Errors, test.wantErrors)
+			}
+			for i, want := range test.wantErrors {
+				if !strings.Contains(report.Errors[i], want) {
+					t.Errorf("got error %q, want one containing %q", report.Errors[i], want)
+				}
+			}
+			if !reflect.DeepEqual(report.Unmapped, test.wantUnmapped) {
+				t.Errorf("got unmapped ids %v, want %v", report.Unmapped, test.wantUnmapped)
+			}
+		})
+	}
+}
+
+// TestFillPrefixes checks that the tags GetPrefixes can't use are returned as
+// errors rather than panicking.
+func TestFillPrefixes(t *testing.T) {
+	prefixes := &struct {
+		A []byte `prefix_id:"[1]" is_state:"true"`
+		B []byte `prefix_id:"[2]"`
+	}{}
+	if err := fillPrefixes(prefixes); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(prefixes.A, []byte{1}) || !reflect.DeepEqual(prefixes.B, []byte{2}) {
+		t.Errorf("got prefixes %v and %v, want [1] and [2]", prefixes.A, prefixes.B)
+	}
+	// Appending to a prefix must copy it rather than write past its end.
+	if cap(prefixes.A) != len(prefixes.A) {
+		t.Errorf("prefix A has capacity %d for %d bytes", cap(prefixes.A), len(prefixes.A))
+	}
+
+	for _, tags := range [][]string{
+		{`prefix_id:"[1"`},
+		{`prefix_id:"-"`},
+		{`prefix_id:"[1]"`, `prefix_id:"[1]"`},
+	} {
+		invalid := reflect.New(testPrefixesType(tags...)).Interface()
+		if err := fillPrefixes(invalid); err == nil {
+			t.Errorf("fillPrefixes(%q) succeeded, want an error", tags)
+		}
+	}
+}
+
+func TestDBPrefixes(t *testing.T) {
+	if err := checkPrefixes(); err != nil {
+		t.Fatal(err)
+	}
+	report := validatePrefixRegistry(reflectPrefixRegistry(reflect.TypeOf(DBPrefixes{}), dbPrefixesNextTag), nil)
+	if len(report.Errors) > 0 {
+		t.Errorf("DBPrefixes is invalid: %q", report.Errors)
+	}
+}
+
+// TestDBPrefixesSource checks what only the source of DBPrefixes has: a
+// comment on every prefix and a NEXT_TAG comment that matches
+// dbPrefixesNextTag.
+func TestDBPrefixesSource(t *testing.T) {
+	src, err := os.ReadFile("main.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry, err := parsePrefixRegistry("main.go", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if registry.NextTag != dbPrefixesNextTag {
+		t.Errorf("the NEXT_TAG comment is %d but dbPrefixesNextTag is %d", registry.NextTag, dbPrefixesNextTag)
+	}
+	report := validatePrefixRegistry(registry, nil)
+	for _, message := range append(report.Errors, report.Warnings...) {
+		t.Error(message)
+	}
+}
+
+func TestParsePrefixRegistryComments(t *testing.T) {
+	src := []byte(`package main
+
+type DBPrefixes struct {
+	// Documented.
+	A []byte ` + "`prefix_id:\"[0]\"`" + `
+	B []byte ` + "`prefix_id:\"[1]\"`" + `
+
+	C []byte ` + "`prefix_id:\"[2]\"`" + `
+
+	// NEXT_TAG: 4
+}
+`)
+	registry, err := parsePrefixRegistry("db_utils.go", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := validatePrefixRegistry(registry, nil)
+	if len(report.Warnings) != 1 || !strings.Contains(report.Warnings[0], "db_utils.go:8: C: no comment") {
+		t.Errorf("got warnings %q, want one for C", report.Warnings)
+	}
+	if len(report.Errors) != 1 || !strings.Contains(report.Errors[0], "NEXT_TAG is 4") {
+		t.Errorf("got errors %q, want one for NEXT_TAG", report.Errors)
+	}
+	if !reflect.DeepEqual(report.Unmapped, []int{3}) {
+		t.Errorf("got unmapped ids %v, want [3]", report.Unmapped)
+	}
+}
+
+// TestRunValidateSource checks that validate -source reports what only the
+// source has: missing comments and a NEXT_TAG comment that doesn't match
+// dbPrefixesNextTag.
+func TestRunValidateSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "main.go")
+	src := `package main
+
+type DBPrefixes struct {
+	// Documented.
+	A []byte ` + "`prefix_id:\"[0]\"`" + `
+
+	B []byte ` + "`prefix_id:\"[1]\"`" + `
+
+	// NEXT_TAG: 2
+}
+`
+	if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out, err := runCommandOutput(t, "validate", "-source", path)
+	if err == nil || !strings.Contains(out, "main.go:7: B: no comment") ||
+		!strings.Contains(out, fmt.Sprintf("the NEXT_TAG comment is 2 but dbPrefixesNextTag is %d", dbPrefixesNextTag)) {
+		t.Errorf("got error %v and output\n%s\nwant B's missing comment and the NEXT_TAG mismatch reported", err, out)
+	}
+
+	// Without -source the compiled DBPrefixes is checked, which is valid.
+	if out, err := runCommandOutput(t, "validate"); err != nil {
+		t.Errorf("got error %v and output\n%s", err, out)
+	}
+}
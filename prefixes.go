@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// The prefix categories, named after the DBPrefixes tags that put a prefix in
+// them.
+const (
+	// prefixCategoryState holds the prefixes tagged is_state, the entries
+	// that make up the state of the chain and are synced by hypersync.
+	prefixCategoryState = "is_state"
+	// prefixCategoryCoreState holds the prefixes tagged core_state, the part
+	// of the state that the state syncer hands to consumers such as the
+	// indexer.
+	prefixCategoryCoreState = "core_state"
+	// prefixCategoryTxindex holds the prefixes tagged is_txindex, which are
+	// only written by nodes that run the txindex.
+	prefixCategoryTxindex = "is_txindex"
+)
+
+var prefixCategories = []string{prefixCategoryState, prefixCategoryCoreState, prefixCategoryTxindex}
+
+// namedPrefix is a DBPrefixes field together with its prefix_id bytes and the
+// categories its tags put it in.
+type namedPrefix struct {
+	Name   string
+	Prefix []byte
+
+	IsState   bool
+	CoreState bool
+	IsTxindex bool
+}
+
+func (p *namedPrefix) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Name      string `json:"name"`
+		ID        []int  `json:"id"`
+		IsState   bool   `json:"isState"`
+		CoreState bool   `json:"coreState"`
+		IsTxindex bool   `json:"isTxindex"`
+	}{p.Name, bytesToInts(p.Prefix), p.IsState, p.CoreState, p.IsTxindex})
+}
+
+// InCategory reports whether the prefix is tagged with category.
+func (p *namedPrefix) InCategory(category string) bool {
+	switch category {
+	case prefixCategoryState:
+		return p.IsState
+	case prefixCategoryCoreState:
+		return p.CoreState
+	case prefixCategoryTxindex:
+		return p.IsTxindex
+	}
+	return false
+}
+
+// Categories returns the categories the prefix is in, in the order of
+// prefixCategories.
+func (p *namedPrefix) Categories() []string {
+	var categories []string
+	for _, category := range prefixCategories {
+		if p.InCategory(category) {
+			categories = append(categories, category)
+		}
+	}
+	return categories
+}
+
+// listPrefixes returns every DBPrefixes field in declaration order.
+func listPrefixes() []*namedPrefix {
+	prefixElements := reflect.ValueOf(GetPrefixes()).Elem()
+	structFields := prefixElements.Type()
+
+	var prefixes []*namedPrefix
+	for i := 0; i < prefixElements.NumField(); i++ {
+		tag := structFields.Field(i).Tag
+		prefixes = append(prefixes, &namedPrefix{
+			Name:      structFields.Field(i).Name,
+			Prefix:    append([]byte{}, prefixElements.Field(i).Bytes()...),
+			IsState:   tag.Get(prefixCategoryState) == "true",
+			CoreState: tag.Get(prefixCategoryCoreState) == "true",
+			IsTxindex: tag.Get(prefixCategoryTxindex) == "true",
+		})
+	}
+	return prefixes
+}
+
+// prefixesInCategory returns the prefixes tagged with category, in
+// declaration order. The category can be given with or without its "is_".
+func prefixesInCategory(category string) ([]*namedPrefix, error) {
+	category = strings.ToLower(category)
+	for _, known := range prefixCategories {
+		if category == known || "is_"+category == known {
+			var prefixes []*namedPrefix
+			for _, p := range listPrefixes() {
+				if p.InCategory(known) {
+					prefixes = append(prefixes, p)
+				}
+			}
+			return prefixes, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown prefix category %q, expected one of %s", category, strings.Join(prefixCategories, ", "))
+}
+
+// findPrefix looks up a prefix by its field name, with or without the leading
+// "Prefix", or by its numeric id.
+func findPrefix(nameOrId string) (*namedPrefix, error) {
+	if nameOrId == "" {
+		return nil, fmt.Errorf("no prefix given, pass -prefix with a name or id")
+	}
+	if id, err := strconv.Atoi(nameOrId); err == nil {
+		// Prefix ids are a single byte.
+		if id < 0 || id > 255 {
+			return nil, fmt.Errorf("prefix id %d is out of range, ids go from 0 to 255", id)
+		}
+		for _, p := range listPrefixes() {
+			if bytes.Equal(p.Prefix, []byte{byte(id)}) {
+				return p, nil
+			}
+		}
+		return nil, fmt.Errorf("no prefix with id %d", id)
+	}
+	for _, p := range listPrefixes() {
+		if strings.EqualFold(p.Name, nameOrId) || strings.EqualFold(p.Name, "Prefix"+nameOrId) {
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("no prefix named %q", nameOrId)
+}
+
+// prefixForKey returns the prefix a raw key was stored under, or nil if the
+// leading byte does not match any known prefix.
+func prefixForKey(key []byte) *namedPrefix {
+	for _, p := range listPrefixes() {
+		if bytes.HasPrefix(key, p.Prefix) {
+			return p
+		}
+	}
+	return nil
+}
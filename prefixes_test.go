@@ -0,0 +1,42 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFindPrefix(t *testing.T) {
+	tests := []struct {
+		nameOrId string
+		want     string
+		wantErr  string
+	}{
+		{"PrefixMempoolTxnHashToMsgDeSoTxn", "PrefixMempoolTxnHashToMsgDeSoTxn", ""},
+		{"mempooltxnhashtomsgdesotxn", "PrefixMempoolTxnHashToMsgDeSoTxn", ""},
+		{"23", "PrefixPKIDToProfileEntry", ""},
+		{"0", "PrefixBlockHashToBlock", ""},
+		{"200", "", "no prefix with id 200"},
+		// byte(256) and byte(-1) would be [0] and [255].
+		{"256", "", "prefix id 256 is out of range"},
+		{"-1", "", "prefix id -1 is out of range"},
+		{"", "", "no prefix given"},
+		{"NoSuchPrefix", "", "no prefix named"},
+	}
+	for _, test := range tests {
+		t.Run(test.nameOrId, func(t *testing.T) {
+			prefix, err := findPrefix(test.nameOrId)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("got %v and error %v, want an error containing %q", prefix, err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if prefix.Name != test.want {
+				t.Errorf("got %s, want %s", prefix.Name, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+)
+
+// profileInfo is a profile with the coin info frontends show next to it.
+type profileInfo struct {
+	PKID        *PKID     `json:"pkid"`
+	PublicKey   PublicKey `json:"publicKey"`
+	Username    string    `json:"username"`
+	Description string    `json:"description"`
+	ProfilePic  string    `json:"profilePic"`
+	IsHidden    bool      `json:"isHidden"`
+	ExtraData   ExtraData `json:"extraData"`
+
+	CreatorCoin *coinInfo `json:"creatorCoin"`
+	DAOCoin     *coinInfo `json:"daoCoin"`
+}
+
+// coinInfo is the state of a profile's creator or DAO coin.
+type coinInfo struct {
+	DeSoLockedNanos         uint64 `json:"desoLockedNanos"`
+	CoinsInCirculationNanos string `json:"coinsInCirculationNanos"`
+	NumberOfHolders         uint64 `json:"numberOfHolders"`
+	// FounderRewardBasisPoints is the share of every buy that goes to the
+	// creator, CreatorBasisPoints in the CoinEntry.
+	FounderRewardBasisPoints uint64 `json:"founderRewardBasisPoints"`
+	CoinWatermarkNanos       uint64 `json:"coinWatermarkNanos"`
+	MintingDisabled          bool   `json:"mintingDisabled"`
+	// PriceNanos is the DeSo nanos a whole creator coin costs on the bonding
+	// curve. DAO coins have no curve, so it is left out for them.
+	PriceNanos *uint64 `json:"priceNanos,omitempty"`
+}
+
+func newCoinInfo(coin *CoinEntry, withPrice bool) *coinInfo {
+	info := &coinInfo{
+		DeSoLockedNanos:          coin.DeSoLockedNanos,
+		CoinsInCirculationNanos:  "0",
+		NumberOfHolders:          coin.NumberOfHolders,
+		FounderRewardBasisPoints: coin.CreatorBasisPoints,
+		CoinWatermarkNanos:       coin.CoinWatermarkNanos,
+		MintingDisabled:          coin.MintingDisabled,
+	}
+	if coin.CoinsInCirculationNanos != nil {
+		info.CoinsInCirculationNanos = coin.CoinsInCirculationNanos.String()
+	}
+	if withPrice {
+		price := creatorCoinPriceNanos(uint64OrMax(coin.CoinsInCirculationNanos), coin.DeSoLockedNanos)
+		info.PriceNanos = &price
+	}
+	return info
+}
+
+func newProfileInfo(pkid *PKID, profile *ProfileEntry) *profileInfo {
+	return &profileInfo{
+		PKID:        pkid,
+		PublicKey:   profile.PublicKey,
+		Username:    profile.Username,
+		Description: profile.Description,
+		ProfilePic:  profile.ProfilePic,
+		IsHidden:    profile.IsHidden,
+		ExtraData:   profile.ExtraData,
+		CreatorCoin: newCoinInfo(&profile.CreatorCoinEntry, true),
+		DAOCoin:     newCoinInfo(&profile.DAOCoinEntry, false),
+	}
+}
+
+// resolveProfileWithTxn finds the profile query names. query is a public key
+// or PKID, as Base58Check or hex, or else a username. Usernames are looked up
+// lowercased, the way core stores them in [25]. It returns nil without an
+// error when there is no such profile.
+func resolveProfileWithTxn(txn kvTxn, query string) (*profileInfo, error) {
+	var pkids []*PKID
+	if publicKey, err := parsePublicKey(query); err == nil {
+		pkid, err := DBGetPKIDForPublicKeyWithTxn(txn, publicKey)
+		if err != nil {
+			return nil, fmt.Errorf("resolveProfileWithTxn: Problem looking up the PKID of %s: %v", query, err)
+		}
+		// The key may also be a PKID that no longer matches a public key,
+		// after a swap.
+		given := &PKID{}
+		copy(given[:], publicKey)
+		pkids = append(pkids, pkid, given)
+	} else {
+		pkid, err := DBGetPKIDForUsernameWithTxn(txn, query)
+		if err != nil {
+			return nil, fmt.Errorf("resolveProfileWithTxn: Problem looking up username %q: %v", query, err)
+		}
+		if pkid != nil {
+			pkids = append(pkids, pkid)
+		}
+	}
+
+	for _, pkid := range pkids {
+		profile, err := DBGetProfileEntryForPKIDWithTxn(txn, pkid)
+		if err != nil {
+			return nil, fmt.Errorf("resolveProfileWithTxn: Problem reading the profile of %v: %v", pkid, err)
+		}
+		if profile != nil {
+			return newProfileInfo(pkid, profile), nil
+		}
+	}
+	return nil, nil
+}
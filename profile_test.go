@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// profileTestEntries holds Alice (1), whose username is stored lowercased in
+// [25], and Bob (2), whose coin has nothing in circulation. Bob's PKID has
+// moved to public key 3 and PKID 3 to public key 2, as after a swap.
+func profileTestEntries() map[string][]byte {
+	entries := make(map[string][]byte)
+	aliceKey, alice := testProfile(1, "Alice", 10832150315, 1270996343)
+	bobKey, bob := testProfile(2, "bob", 0, 0)
+	entries[aliceKey] = alice
+	entries[bobKey] = bob
+	entries[string(append([]byte{25}, "alice"...))] = testPKID(1)[:]
+	entries[string(append([]byte{25}, "bob"...))] = testPKID(2)[:]
+	entries[string(append([]byte{36}, testPublicKey(3)...))] = testPKID(2)[:]
+	entries[string(append([]byte{36}, testPublicKey(2)...))] = testPKID(3)[:]
+	return entries
+}
+
+func TestResolveProfile(t *testing.T) {
+	db := newTestDBWithEntries(t, profileTestEntries())
+	tests := []struct {
+		name  string
+		query string
+		// want is the PKID of the profile found, 0 when there is none.
+		want byte
+	}{
+		{"username", "alice", 1},
+		{"username is lowercased", "ALICE", 1},
+		{"mixed case username", "Bob", 2},
+		{"unknown username", "carol", 0},
+		{"public key", PkToString(testPublicKey(1)), 1},
+		{"hex public key", hex.EncodeToString(testPublicKey(1)), 1},
+		{"public key of a swapped PKID", PkToString(testPublicKey(3)), 2},
+		// Public key 2 belongs to PKID 3 now, which has no profile.
+		{"PKID that no longer matches its public key", testPKID(2).String(), 2},
+		{"public key without a profile", PkToString(testPublicKey(4)), 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var profile *profileInfo
+			err := db.View(func(txn kvTxn) error {
+				var err error
+				profile, err = resolveProfileWithTxn(txn, test.query)
+				return err
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.want == 0 {
+				if profile != nil {
+					t.Errorf("got the profile of %v, want none", profile.PKID)
+				}
+				return
+			}
+			if profile == nil || *profile.PKID != *testPKID(test.want) {
+				t.Fatalf("got %+v, want the profile of %v", profile, testPKID(test.want))
+			}
+		})
+	}
+}
+
+func TestNewCoinInfo(t *testing.T) {
+	// A coin no one has bought yet has no supply and costs nothing.
+	info := newCoinInfo(&CoinEntry{CreatorBasisPoints: 1000}, true)
+	if info.CoinsInCirculationNanos != "0" || info.PriceNanos == nil || *info.PriceNanos != 0 {
+		t.Errorf("got %+v for a zero supply coin, want no supply and a price of 0", info)
+	}
+	if info := newCoinInfo(&CoinEntry{}, false); info.PriceNanos != nil {
+		t.Errorf("got price %v without a curve, want none", *info.PriceNanos)
+	}
+}
+
+// newProfileTestDir writes profileTestEntries to a badger directory, the way
+// the CLI reads a node's DB.
+func newProfileTestDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	db, err := badger.Open(badger.DefaultOptions(dir).WithLogger(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(func(txn *badger.Txn) error {
+		for key, val := range profileTestEntries() {
+			if err := txn.Set([]byte(key), val); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if closeErr := db.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestRunProfile(t *testing.T) {
+	dir := newProfileTestDir(t)
+
+	out, err := runCommandOutput(t, "profile", "-db", dir, "-format", "json", "BOB")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var profile struct {
+		Username    string
+		CreatorCoin map[string]interface{}
+		DAOCoin     map[string]interface{}
+	}
+	if err := json.Unmarshal([]byte(out), &profile); err != nil {
+		t.Fatalf("decoding %s: %v", out, err)
+	}
+	_, daoPrice := profile.DAOCoin["priceNanos"]
+	if profile.Username != "bob" || profile.CreatorCoin["priceNanos"] != float64(0) || daoPrice {
+		t.Errorf("got %s, want bob's profile with a creator coin price of 0 and no DAO coin price", out)
+	}
+
+	out, err = runCommandOutput(t, "profile", "-db", dir, "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "price\t0.000000000 DESO per coin\n") {
+		t.Errorf("got\n%s\nwant a price of 0", out)
+	}
+
+	if _, err := runCommandOutput(t, "profile", "-db", dir, "carol"); err == nil || !strings.Contains(err.Error(), `no profile for "carol"`) {
+		t.Errorf("got error %v for an unknown username, want one saying there is no profile", err)
+	}
+}
+
+// TestRunProfileDBDir checks the DB is found through $BADGER_DIR when -db
+// isn't passed, and that there is no default without either.
+func TestRunProfileDBDir(t *testing.T) {
+	t.Setenv(envDBDir, newProfileTestDir(t))
+	if out, err := runCommandOutput(t, "profile", "bob"); err != nil || !strings.Contains(out, "bob") {
+		t.Errorf("got %q and error %v reading $%s, want bob's profile", out, err, envDBDir)
+	}
+
+	t.Setenv(envDBDir, "")
+	if _, err := runCommandOutput(t, "profile", "bob"); err == nil || !strings.Contains(err.Error(), "no badger directory given") {
+		t.Errorf("got error %v without -db or $%s, want one saying no directory was given", err, envDBDir)
+	}
+}
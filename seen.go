@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// seenPrefix is the key prefix of every txn hash in the seen DB.
+var seenPrefix = []byte("seen/")
+
+// seenStartedKey is set by the first Add, so that an empty set left by a
+// watcher that ran before can be told apart from a new DB.
+var seenStartedKey = []byte("started")
+
+// seenStore keeps the hashes of the mempool transactions a mempoolWatcher has
+// handled in a small badger DB of its own, like the dead-letter queue. With it
+// a restarted watcher neither handles them again nor skips the transactions
+// that arrived while it was down.
+type seenStore struct {
+	db *badger.DB
+}
+
+func openSeenStore(dir string) (*seenStore, error) {
+	db, err := badger.Open(badger.DefaultOptions(dir).WithLogger(nil))
+	if err != nil {
+		return nil, fmt.Errorf("openSeenStore: Problem opening %s: %v", dir, err)
+	}
+	return &seenStore{db: db}, nil
+}
+
+func (store *seenStore) Close() error {
+	return store.db.Close()
+}
+
+// Load returns the saved hashes and whether Add was ever called on the store.
+func (store *seenStore) Load() (map[BlockHash]bool, bool, error) {
+	hashes := make(map[BlockHash]bool)
+	started := false
+	err := store.db.View(func(txn *badger.Txn) error {
+		if _, err := txn.Get(seenStartedKey); err == nil {
+			started = true
+		} else if err != badger.ErrKeyNotFound {
+			return err
+		}
+		keys, _, err := _enumerateKeysForPrefixWithTxn(badgerV4Txn{txn}, seenPrefix)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			var txnHash BlockHash
+			if len(key) != len(seenPrefix)+len(txnHash) {
+				return fmt.Errorf("seenStore.Load: malformed key %x", key)
+			}
+			copy(txnHash[:], key[len(seenPrefix):])
+			hashes[txnHash] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return hashes, started, nil
+}
+
+// Add records hashes as seen. It may be called with none to only record that
+// the store has been started.
+func (store *seenStore) Add(hashes ...BlockHash) error {
+	batch := store.db.NewWriteBatch()
+	defer batch.Cancel()
+	if err := batch.Set(seenStartedKey, nil); err != nil {
+		return err
+	}
+	for _, txnHash := range hashes {
+		if err := batch.Set(seenKey(txnHash), nil); err != nil {
+			return err
+		}
+	}
+	return batch.Flush()
+}
+
+// Remove forgets hashes, once their transactions have left the mempool.
+func (store *seenStore) Remove(hashes ...BlockHash) error {
+	batch := store.db.NewWriteBatch()
+	defer batch.Cancel()
+	for _, txnHash := range hashes {
+		if err := batch.Delete(seenKey(txnHash)); err != nil {
+			return err
+		}
+	}
+	return batch.Flush()
+}
+
+func seenKey(txnHash BlockHash) []byte {
+	return append(append([]byte{}, seenPrefix...), txnHash[:]...)
+}
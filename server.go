@@ -0,0 +1,380 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/graphql-go/graphql"
+)
+
+// The page sizes of the scan endpoint.
+const (
+	apiDefaultPageSize = 100
+	apiMaxPageSize     = 1000
+)
+
+// apiServer serves the DB as JSON over HTTP. Every request reads in a
+// read-only transaction of its own, the same way the commands do.
+type apiServer struct {
+	db     *nodeDB
+	schema graphql.Schema
+}
+
+func newAPIServer(db *nodeDB) (*apiServer, error) {
+	schema, err := newGraphQLSchema(db)
+	if err != nil {
+		return nil, fmt.Errorf("newAPIServer: Problem building the GraphQL schema: %v", err)
+	}
+	return &apiServer{db: db, schema: schema}, nil
+}
+
+// apiError is an error with the HTTP status it should be returned with.
+type apiError struct {
+	status int
+	err    error
+}
+
+func (e *apiError) Error() string {
+	return e.err.Error()
+}
+
+func badRequest(format string, args ...interface{}) error {
+	return &apiError{status: http.StatusBadRequest, err: fmt.Errorf(format, args...)}
+}
+
+func notFound(format string, args ...interface{}) error {
+	return &apiError{status: http.StatusNotFound, err: fmt.Errorf(format, args...)}
+}
+
+// Handler returns the routes of the API:
+//
+//	GET /prefixes[?category=]               every prefix, or those of a category
+//	GET /prefixes/{prefix}/count            number of keys under a prefix
+//	GET /prefixes/{prefix}/entries          a page of entries, see handleScan
+//	GET /keys/{key}                         the entry stored under a hex key
+//	GET /profiles/{profile}                 a profile by username, public key or PKID
+//	GET /holders/{profile}[?limit=]         who holds a creator coin, see creatorCoinHoldersWithTxn
+//	GET /holdings/{profile}[?limit=]        the creator coins a wallet holds
+//	GET /orderbooks/{base}/{quote}          a DAO coin order book, see handleOrderBook
+//	GET /balances/{publicKey}               the DeSo balance of a public key
+//	GET|POST /graphql                       the GraphQL schema of newGraphQLSchema
+func (s *apiServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /prefixes", s.handle(s.handlePrefixes))
+	mux.HandleFunc("GET /prefixes/{prefix}/count", s.handle(s.handleCount))
+	mux.HandleFunc("GET /prefixes/{prefix}/entries", s.handle(s.handleScan))
+	mux.HandleFunc("GET /keys/{key}", s.handle(s.handleGet))
+	mux.HandleFunc("GET /profiles/{profile}", s.handle(s.handleProfile))
+	mux.HandleFunc("GET /holders/{profile}", s.handle(s.coinHoldingsHandler(creatorCoinHoldersWithTxn)))
+	mux.HandleFunc("GET /holdings/{profile}", s.handle(s.coinHoldingsHandler(creatorCoinHoldingsWithTxn)))
+	mux.HandleFunc("GET /orderbooks/{base}/{quote}", s.handle(s.handleOrderBook))
+	mux.HandleFunc("GET /balances/{publicKey}", s.handle(s.handleBalance))
+	mux.HandleFunc("/graphql", handleGraphQL(s.schema))
+	return mux
+}
+
+// handle writes what fn returns as JSON, or its error as {"error": ...}.
+func (s *apiServer) handle(fn func(r *http.Request) (interface{}, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		response, err := fn(r)
+		status := http.StatusOK
+		if err != nil {
+			status = http.StatusInternalServerError
+			var requestErr *apiError
+			if errors.As(err, &requestErr) {
+				status = requestErr.status
+			} else if r.Context().Err() == nil {
+				log.Printf("%s %s failed: %v\n", r.Method, r.URL, err)
+			}
+			response = map[string]string{"error": err.Error()}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+func (s *apiServer) handlePrefixes(r *http.Request) (interface{}, error) {
+	category := r.URL.Query().Get("category")
+	if category == "" {
+		return listPrefixes(), nil
+	}
+	prefixes, err := prefixesInCategory(category)
+	if err != nil {
+		return nil, badRequest("%v", err)
+	}
+	return prefixes, nil
+}
+
+func (s *apiServer) pathPrefix(r *http.Request) (*namedPrefix, error) {
+	prefix, err := findPrefix(r.PathValue("prefix"))
+	if err != nil {
+		return nil, notFound("%v", err)
+	}
+	return prefix, nil
+}
+
+func (s *apiServer) handleCount(r *http.Request) (interface{}, error) {
+	prefix, err := s.pathPrefix(r)
+	if err != nil {
+		return nil, err
+	}
+	count := 0
+	err = s.db.View(func(txn kvTxn) error {
+		iterOpts := &iterateOptions{KeysOnly: true}
+		return _iterateKeysForPrefixWithTxn(r.Context(), txn, prefix.Prefix, iterOpts, func([]byte, []byte) error {
+			count++
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"prefix": prefix.Name, "count": count}, nil
+}
+
+// scanPage is a page of entries. NextCursor is passed as ?cursor= to get the
+// next page, and is empty on the last one.
+type scanPage struct {
+	Entries    []*entry `json:"entries"`
+	NextCursor string   `json:"nextCursor,omitempty"`
+}
+
+// handleScan returns up to ?limit= entries of a prefix. ?start= and ?end= are
+// hex keys relative to the prefix bounding the scan and ?reverse=true walks
+// it backwards, as with the scan command. ?cursor= continues after the last
+// entry of the previous page.
+func (s *apiServer) handleScan(r *http.Request) (interface{}, error) {
+	prefix, err := s.pathPrefix(r)
+	if err != nil {
+		return nil, err
+	}
+	query := r.URL.Query()
+	limit := apiDefaultPageSize
+	if value := query.Get("limit"); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit <= 0 || limit > apiMaxPageSize {
+			return nil, badRequest("limit must be between 1 and %d", apiMaxPageSize)
+		}
+	}
+	opts := &cliOptions{start: query.Get("start"), end: query.Get("end"), reverse: query.Get("reverse") == "true"}
+	iterOpts, err := opts.iterateOptions(prefix)
+	if err != nil {
+		return nil, badRequest("%v", err)
+	}
+	if value := query.Get("cursor"); value != "" {
+		cursor, err := hex.DecodeString(value)
+		if err != nil {
+			return nil, badRequest("cursor must be hex encoded: %v", err)
+		}
+		afterCursor(iterOpts, cursor)
+	}
+
+	page := &scanPage{Entries: []*entry{}}
+	err = s.db.View(func(txn kvTxn) error {
+		nextCursor, err := readPage(r.Context(), txn, prefix.Prefix, iterOpts, limit, func(key []byte, val []byte) error {
+			page.Entries = append(page.Entries, newEntry(prefix, key, val))
+			return nil
+		})
+		if nextCursor != nil {
+			page.NextCursor = hex.EncodeToString(nextCursor)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// readPage calls fn with up to limit entries stored under dbPrefix within the
+// bounds of iterOpts. It returns the key of the last entry as the cursor of
+// the next page, or nil if this is the last page.
+func readPage(ctx context.Context, txn kvTxn, dbPrefix []byte, iterOpts *iterateOptions, limit int, fn func(key []byte, val []byte) error) ([]byte, error) {
+	pageOpts := *iterOpts
+	// One more entry than the page holds tells whether there is a next page.
+	pageOpts.Limit = limit + 1
+	var lastKey, nextCursor []byte
+	read := 0
+	err := _iterateKeysForPrefixWithTxn(ctx, txn, dbPrefix, &pageOpts, func(key []byte, val []byte) error {
+		if read == limit {
+			nextCursor = lastKey
+			return errStopIteration
+		}
+		read++
+		lastKey = append(lastKey[:0], key...)
+		return fn(key, val)
+	})
+	return nextCursor, err
+}
+
+// afterCursor moves the bounds of iterOpts past cursor, the last key of the
+// previous page.
+func afterCursor(iterOpts *iterateOptions, cursor []byte) {
+	if iterOpts.Reverse {
+		iterOpts.End = cursor
+	} else {
+		iterOpts.Start = append(append([]byte{}, cursor...), 0)
+	}
+}
+
+func (s *apiServer) handleGet(r *http.Request) (interface{}, error) {
+	key, err := hex.DecodeString(r.PathValue("key"))
+	if err != nil {
+		return nil, badRequest("key must be hex encoded: %v", err)
+	}
+	var found *entry
+	err = s.db.View(func(txn kvTxn) error {
+		val, err := txn.Get(key)
+		if err == errKeyNotFound {
+			return notFound("no value stored under %x", key)
+		}
+		if err != nil {
+			return err
+		}
+		found = newEntry(prefixForKey(key), key, val)
+		return nil
+	})
+	return found, err
+}
+
+// handleProfile returns the profile of a username, public key or PKID, see
+// resolveProfileWithTxn.
+func (s *apiServer) handleProfile(r *http.Request) (interface{}, error) {
+	query := r.PathValue("profile")
+	var profile *profileInfo
+	err := s.db.View(func(txn kvTxn) error {
+		var err error
+		profile, err = resolveProfileWithTxn(txn, query)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if profile == nil {
+		return nil, notFound("no profile for %q", query)
+	}
+	return profile, nil
+}
+
+// coinHoldingsHandler returns the holdings read resolves the username, public
+// key or PKID in the path to, keeping the ?limit= largest ones.
+func (s *apiServer) coinHoldingsHandler(read func(context.Context, kvTxn, *PKID) (*coinHoldings, error)) func(r *http.Request) (interface{}, error) {
+	return func(r *http.Request) (interface{}, error) {
+		query := r.PathValue("profile")
+		limit := 0
+		if value := r.URL.Query().Get("limit"); value != "" {
+			var err error
+			if limit, err = strconv.Atoi(value); err != nil || limit <= 0 {
+				return nil, badRequest("limit must be a positive number")
+			}
+		}
+		var holdings *coinHoldings
+		err := s.db.View(func(txn kvTxn) error {
+			pkid, err := resolvePKIDWithTxn(txn, query)
+			if err != nil {
+				return err
+			}
+			if pkid == nil {
+				return notFound("no profile for %q", query)
+			}
+			holdings, err = read(r.Context(), txn, pkid)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		holdings.truncate(limit)
+		return holdings, nil
+	}
+}
+
+// handleOrderBook returns the book of the base and quote coins in the path,
+// DESO or a username, public key or PKID each. ?limit= keeps that many levels
+// per side, ?orders=true lists the open orders by transactor and
+// ?transactor= lists those of one transactor only.
+func (s *apiServer) handleOrderBook(r *http.Request) (interface{}, error) {
+	query := &orderBookQuery{Orders: r.URL.Query().Get("orders") == "true"}
+	if value := r.URL.Query().Get("limit"); value != "" {
+		var err error
+		if query.Depth, err = strconv.Atoi(value); err != nil || query.Depth <= 0 {
+			return nil, badRequest("limit must be a positive number")
+		}
+	}
+	var book *orderBook
+	err := s.db.View(func(txn kvTxn) error {
+		var err error
+		if query.Base, err = resolveCoinWithTxn(txn, r.PathValue("base")); err != nil {
+			return notFound("%v", err)
+		}
+		if query.Quote, err = resolveCoinWithTxn(txn, r.PathValue("quote")); err != nil {
+			return notFound("%v", err)
+		}
+		if transactor := r.URL.Query().Get("transactor"); transactor != "" {
+			if query.Transactor, err = resolvePKIDWithTxn(txn, transactor); err != nil {
+				return err
+			}
+			if query.Transactor == nil {
+				return notFound("no profile for %q", transactor)
+			}
+		}
+		if *query.Base == *query.Quote {
+			return badRequest("base and quote are the same coin")
+		}
+		book, err = readOrderBookWithTxn(r.Context(), txn, query)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return book, nil
+}
+
+func (s *apiServer) handleBalance(r *http.Request) (interface{}, error) {
+	publicKey, err := parsePublicKey(r.PathValue("publicKey"))
+	if err != nil {
+		return nil, badRequest("%v", err)
+	}
+	var balance uint64
+	err = s.db.View(func(txn kvTxn) error {
+		balance, err = DBGetDeSoBalanceNanosForPublicKeyWithTxn(txn, publicKey)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"publicKey": PublicKey(publicKey), "balanceNanos": balance}, nil
+}
+
+// serveAPI serves the API on addr until ctx is canceled.
+func serveAPI(ctx context.Context, db *nodeDB, addr string) error {
+	api, err := newAPIServer(db)
+	if err != nil {
+		return err
+	}
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           api.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+	}
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.ListenAndServe()
+	}()
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return server.Shutdown(shutdownCtx)
+}
@@ -0,0 +1,536 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// envSyncSQL is the database sync writes to when no -sql flag is passed.
+const envSyncSQL = "SYNC_SQL"
+
+// sqlTable mirrors the entries stored under a prefix into a relational table.
+// Its columns are the fields of the key, which make up the primary key,
+// followed by the columns of the prefix's tableSchema that don't repeat a key
+// field. Prefixes whose keys hold everything, such as follows and likes, have
+// no value columns.
+type sqlTable struct {
+	Name   string
+	Prefix *namedPrefix
+
+	Columns []*tableColumn
+	// keyColumns is how many of Columns come from the key.
+	keyColumns int
+	schema     *tableSchema
+	// schemaCells are the indexes of the cells of schema's rows that are
+	// kept.
+	schemaCells []int
+}
+
+// sqlTableNames are the tables sync writes, with the prefix each one mirrors.
+var sqlTableNames = []struct {
+	name   string
+	prefix string
+}{
+	{"profiles", "PrefixPKIDToProfileEntry"},
+	{"deso_balances", "PrefixPublicKeyToDeSoBalanceNanos"},
+	{"creator_coin_balances", "PrefixCreatorPKIDHODLerPKIDToBalanceEntry"},
+	{"dao_coin_balances", "PrefixCreatorPKIDHODLerPKIDToDAOCoinBalanceEntry"},
+	{"posts", "PrefixPostHashToPostEntry"},
+	{"follows", "PrefixFollowerPKIDToFollowedPKID"},
+	{"likes", "PrefixLikerPubKeyToLikedPostHash"},
+	{"nfts", "PrefixPostHashSerialNumberToNFTEntry"},
+	{"dao_coin_limit_orders", "PrefixDAOCoinLimitOrderByOrderID"},
+}
+
+// sqlSyncPassColumn is added to every table. It holds the pass that last wrote
+// the row, so rows whose entry was deleted from the DB can be removed once a
+// pass completes.
+const sqlSyncPassColumn = "sync_pass"
+
+// sqlCheckpointTable records how far sync got in each table.
+const sqlCheckpointTable = "dbtool_sync_checkpoints"
+
+// sqlMaxParams caps the number of parameters of a single statement, SQLite
+// refuses more than 32766.
+const sqlMaxParams = 32766
+
+func newSQLTable(name string, prefix *namedPrefix) (*sqlTable, error) {
+	table := &sqlTable{Name: name, Prefix: prefix, schema: tableSchemas[prefix.Name]}
+	names := make(map[string]bool)
+	for _, part := range keySchemas[prefix.Name] {
+		column := &tableColumn{Name: sqlColumnName(part.Name), Type: keyColumnType(part.Type)}
+		names[column.Name] = true
+		table.Columns = append(table.Columns, column)
+	}
+	table.keyColumns = len(table.Columns)
+	if table.keyColumns == 0 {
+		return nil, fmt.Errorf("newSQLTable: %s has no key schema", prefix.Name)
+	}
+	if table.schema == nil {
+		return table, nil
+	}
+
+	first := 0
+	if table.schema.fromKey {
+		// The key fields are already in the table, only the value is left.
+		first = len(table.schema.Columns) - 1
+	}
+	for ii, column := range table.schema.Columns[first:] {
+		sqlColumn := &tableColumn{Name: sqlColumnName(column.Name), Type: column.Type}
+		if names[sqlColumn.Name] {
+			continue
+		}
+		names[sqlColumn.Name] = true
+		table.Columns = append(table.Columns, sqlColumn)
+		table.schemaCells = append(table.schemaCells, first+ii)
+	}
+	return table, nil
+}
+
+// sqlTables returns the tables named in names, or every table if names is
+// empty.
+func sqlTables(names []string) ([]*sqlTable, error) {
+	var tables []*sqlTable
+	for _, entry := range sqlTableNames {
+		if len(names) > 0 && !containsString(names, entry.name) {
+			continue
+		}
+		prefix, err := findPrefix(entry.prefix)
+		if err != nil {
+			return nil, err
+		}
+		table, err := newSQLTable(entry.name, prefix)
+		if err != nil {
+			return nil, err
+		}
+		tables = append(tables, table)
+	}
+	for _, name := range names {
+		found := false
+		for _, table := range tables {
+			found = found || table.Name == name
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown table %q, expected one of %s", name, strings.Join(sqlTableNamesList(), ", "))
+		}
+	}
+	return tables, nil
+}
+
+func sqlTableNamesList() []string {
+	var names []string
+	for _, entry := range sqlTableNames {
+		names = append(names, entry.name)
+	}
+	return names
+}
+
+// sqlColumnName turns a field or column name such as
+// CreatorCoinEntry_DeSoLockedNanos or hodlerPKID into snake case, e.g.
+// creator_coin_entry_deso_locked_nanos and hodler_pkid.
+func sqlColumnName(name string) string {
+	name = strings.NewReplacer("DeSo", "Deso", "HODLer", "Hodler").Replace(name)
+	runes := []rune(name)
+	var b strings.Builder
+	for ii, r := range runes {
+		if ii > 0 && unicode.IsUpper(r) && runes[ii-1] != '_' {
+			prev := runes[ii-1]
+			nextIsLower := ii+1 < len(runes) && unicode.IsLower(runes[ii+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextIsLower) {
+				b.WriteByte('_')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
+
+// sqlRow turns an entry stored under the table's prefix into the cells of its
+// row, in the order of Columns.
+func (table *sqlTable) sqlRow(key []byte, value []byte) ([]interface{}, error) {
+	fields, err := decodeKey(table.Prefix, key)
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) != table.keyColumns {
+		return nil, fmt.Errorf("sqlRow: key %x has %d fields, expected %d", key, len(fields), table.keyColumns)
+	}
+	row := make([]interface{}, 0, len(table.Columns))
+	for ii, field := range fields {
+		cell, err := keyCell(field.Value, table.Columns[ii].Type)
+		if err != nil {
+			return nil, fmt.Errorf("sqlRow: %s: %v", field.Name, err)
+		}
+		row = append(row, cell)
+	}
+	if table.schema == nil {
+		return row, nil
+	}
+	cells, err := table.schema.tableRow(table.Prefix, key, value)
+	if err != nil {
+		return nil, err
+	}
+	for _, ii := range table.schemaCells {
+		row = append(row, cells[ii])
+	}
+	return row, nil
+}
+
+// keyCell converts the value decodeKey returns for a key field to a cell of
+// cellType.
+func keyCell(value interface{}, cellType columnType) (interface{}, error) {
+	switch cellType {
+	case columnUint64:
+		switch v := value.(type) {
+		case uint8:
+			return uint64(v), nil
+		case uint32:
+			return uint64(v), nil
+		case uint64:
+			return v, nil
+		}
+		return nil, fmt.Errorf("keyCell: %v is not an unsigned integer", value)
+	case columnBool:
+		if v, ok := value.(bool); ok {
+			return v, nil
+		}
+		return nil, fmt.Errorf("keyCell: %v is not a bool", value)
+	}
+	return fmt.Sprint(value), nil
+}
+
+// sqlDialect holds what differs between the SQL databases sync writes to.
+// Both take ? placeholders and INSERT ... ON CONFLICT DO UPDATE.
+type sqlDialect struct {
+	name          string
+	types         map[columnType]string
+	timestampType string
+}
+
+// sqlConn is a connection to the database sync writes to.
+type sqlConn interface {
+	Dialect() *sqlDialect
+	Exec(query string, args ...interface{}) (int64, error)
+	// QueryRow scans the first row query returns into dest and reports
+	// whether there was one.
+	QueryRow(dest []interface{}, query string, args ...interface{}) (bool, error)
+	Begin() (sqlTxn, error)
+	Close() error
+}
+
+type sqlTxn interface {
+	// Exec returns the number of rows query changed.
+	Exec(query string, args ...interface{}) (int64, error)
+	Commit() error
+	Rollback() error
+}
+
+// openSQLConn connects to dsn, a postgres:// or postgresql:// URL, or the path
+// of a SQLite file with an optional sqlite:// or sqlite: scheme.
+func openSQLConn(dsn string) (sqlConn, error) {
+	if dsn == "" {
+		return nil, fmt.Errorf("openSQLConn: no database given, pass -sql or set $%s", envSyncSQL)
+	}
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		return openPostgresConn(dsn)
+	}
+	path := strings.TrimPrefix(strings.TrimPrefix(dsn, "sqlite://"), "sqlite:")
+	return openSQLiteConn(path)
+}
+
+func sqlQuote(name string) string {
+	return `"` + name + `"`
+}
+
+func sqlQuoteAll(names []string) string {
+	quoted := make([]string, len(names))
+	for ii, name := range names {
+		quoted[ii] = sqlQuote(name)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// sqlCheckpoint is the row of a table in sqlCheckpointTable. A pass walks the
+// whole prefix. LastKey is the last key of the pass that was written, so an
+// interrupted pass resumes right after it. Once the pass is Complete the
+// next one starts over from the first key.
+type sqlCheckpoint struct {
+	Table    string
+	Pass     int64
+	LastKey  []byte
+	Complete bool
+	Rows     int64
+}
+
+// sqlSyncResult is what syncing a single table did.
+type sqlSyncResult struct {
+	Table   string
+	Pass    int64
+	Resumed bool
+	Rows    int64
+	Deleted int64
+}
+
+// sqlSyncer mirrors prefixes into the tables of a SQL database.
+type sqlSyncer struct {
+	conn sqlConn
+	// batchSize is how many rows are written per transaction. The checkpoint
+	// is updated in the same transaction, so rows are never written without
+	// it moving past them.
+	batchSize int
+}
+
+func newSQLSyncer(conn sqlConn, batchSize int) *sqlSyncer {
+	if batchSize <= 0 {
+		batchSize = 1000
+	}
+	return &sqlSyncer{conn: conn, batchSize: batchSize}
+}
+
+// createTables creates the checkpoint table and tables if they don't exist
+// yet. Existing tables are left as they are.
+func (s *sqlSyncer) createTables(tables []*sqlTable) error {
+	dialect := s.conn.Dialect()
+	_, err := s.conn.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	"table_name" TEXT PRIMARY KEY,
+	"pass" BIGINT NOT NULL,
+	"last_key" TEXT NOT NULL,
+	"complete" BOOLEAN NOT NULL,
+	"rows" BIGINT NOT NULL,
+	"updated_at" %s NOT NULL
+)`, sqlQuote(sqlCheckpointTable), dialect.timestampType))
+	if err != nil {
+		return fmt.Errorf("createTables: Problem creating %s: %v", sqlCheckpointTable, err)
+	}
+
+	for _, table := range tables {
+		var definitions, keys []string
+		for ii, column := range table.Columns {
+			definitions = append(definitions, fmt.Sprintf("%s %s NOT NULL", sqlQuote(column.Name), dialect.types[column.Type]))
+			if ii < table.keyColumns {
+				keys = append(keys, column.Name)
+			}
+		}
+		definitions = append(definitions, sqlQuote(sqlSyncPassColumn)+" BIGINT NOT NULL")
+		definitions = append(definitions, "PRIMARY KEY ("+sqlQuoteAll(keys)+")")
+		query := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (\n\t%s\n)", sqlQuote(table.Name), strings.Join(definitions, ",\n\t"))
+		if _, err := s.conn.Exec(query); err != nil {
+			return fmt.Errorf("createTables: Problem creating %s: %v", table.Name, err)
+		}
+		query = fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s (%s)",
+			sqlQuote(table.Name+"_"+sqlSyncPassColumn+"_idx"), sqlQuote(table.Name), sqlQuote(sqlSyncPassColumn))
+		if _, err := s.conn.Exec(query); err != nil {
+			return fmt.Errorf("createTables: Problem indexing %s: %v", table.Name, err)
+		}
+	}
+	return nil
+}
+
+func (s *sqlSyncer) loadCheckpoint(table *sqlTable) (*sqlCheckpoint, error) {
+	checkpoint := &sqlCheckpoint{Table: table.Name}
+	var lastKey string
+	found, err := s.conn.QueryRow([]interface{}{&checkpoint.Pass, &lastKey, &checkpoint.Complete, &checkpoint.Rows},
+		fmt.Sprintf(`SELECT "pass", "last_key", "complete", "rows" FROM %s WHERE "table_name" = ?`, sqlQuote(sqlCheckpointTable)),
+		table.Name)
+	if err != nil {
+		return nil, fmt.Errorf("loadCheckpoint: Problem reading the checkpoint of %s: %v", table.Name, err)
+	}
+	if !found {
+		return nil, nil
+	}
+	if checkpoint.LastKey, err = hex.DecodeString(lastKey); err != nil {
+		return nil, fmt.Errorf("loadCheckpoint: Invalid last key %q for %s: %v", lastKey, table.Name, err)
+	}
+	return checkpoint, nil
+}
+
+func saveCheckpoint(txn sqlTxn, checkpoint *sqlCheckpoint) error {
+	_, err := txn.Exec(fmt.Sprintf(`INSERT INTO %s ("table_name", "pass", "last_key", "complete", "rows", "updated_at")
+VALUES (?, ?, ?, ?, ?, ?)
+ON CONFLICT ("table_name") DO UPDATE SET "pass" = excluded."pass", "last_key" = excluded."last_key",
+	"complete" = excluded."complete", "rows" = excluded."rows", "updated_at" = excluded."updated_at"`, sqlQuote(sqlCheckpointTable)),
+		checkpoint.Table, checkpoint.Pass, hex.EncodeToString(checkpoint.LastKey), checkpoint.Complete, checkpoint.Rows,
+		time.Now().UTC().Format(time.RFC3339Nano))
+	if err != nil {
+		return fmt.Errorf("saveCheckpoint: Problem saving the checkpoint of %s: %v", checkpoint.Table, err)
+	}
+	return nil
+}
+
+// syncTable upserts every entry stored under the table's prefix, resuming
+// the pass an earlier run didn't complete. Once the pass reaches the end of
+// the prefix, the rows an earlier pass wrote but this one didn't are deleted,
+// since their entries are gone from the DB.
+func (s *sqlSyncer) syncTable(ctx context.Context, db *nodeDB, table *sqlTable) (*sqlSyncResult, error) {
+	checkpoint, err := s.loadCheckpoint(table)
+	if err != nil {
+		return nil, err
+	}
+	result := &sqlSyncResult{Table: table.Name}
+	iterOpts := &iterateOptions{KeysOnly: table.schema == nil}
+	switch {
+	case checkpoint == nil:
+		checkpoint = &sqlCheckpoint{Table: table.Name, Pass: 1}
+	case checkpoint.Complete:
+		checkpoint = &sqlCheckpoint{Table: table.Name, Pass: checkpoint.Pass + 1}
+	default:
+		result.Resumed = true
+		iterOpts.Start = append(append([]byte{}, checkpoint.LastKey...), 0)
+	}
+	result.Pass = checkpoint.Pass
+
+	var rows [][]interface{}
+	flush := func(lastKey []byte) error {
+		txn, err := s.conn.Begin()
+		if err != nil {
+			return fmt.Errorf("syncTable: Problem starting a transaction: %v", err)
+		}
+		if err := s.upsertRows(txn, table, checkpoint.Pass, rows); err != nil {
+			txn.Rollback()
+			return err
+		}
+		next := *checkpoint
+		next.LastKey = append([]byte{}, lastKey...)
+		next.Rows += int64(len(rows))
+		if err := saveCheckpoint(txn, &next); err != nil {
+			txn.Rollback()
+			return err
+		}
+		if err := txn.Commit(); err != nil {
+			return fmt.Errorf("syncTable: Problem committing %d rows of %s: %v", len(rows), table.Name, err)
+		}
+		*checkpoint = next
+		result.Rows += int64(len(rows))
+		rows = rows[:0]
+		return nil
+	}
+
+	var lastKey []byte
+	err = db.View(func(txn kvTxn) error {
+		return _iterateKeysForPrefixWithTxn(ctx, txn, table.Prefix.Prefix, iterOpts, func(key []byte, val []byte) error {
+			row, err := table.sqlRow(key, val)
+			if err != nil {
+				return fmt.Errorf("syncTable: Problem decoding %x: %v", key, err)
+			}
+			rows = append(rows, row)
+			lastKey = append(lastKey[:0], key...)
+			if len(rows) >= s.batchSize {
+				return flush(lastKey)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return result, err
+	}
+	if len(rows) > 0 {
+		if err := flush(lastKey); err != nil {
+			return result, err
+		}
+	}
+
+	// The pass is complete: drop the rows of entries that no longer exist
+	// and mark it so the next run starts a new one.
+	txn, err := s.conn.Begin()
+	if err != nil {
+		return result, fmt.Errorf("syncTable: Problem starting a transaction: %v", err)
+	}
+	deleted, err := txn.Exec(fmt.Sprintf("DELETE FROM %s WHERE %s < ?", sqlQuote(table.Name), sqlQuote(sqlSyncPassColumn)), checkpoint.Pass)
+	if err != nil {
+		txn.Rollback()
+		return result, fmt.Errorf("syncTable: Problem deleting the stale rows of %s: %v", table.Name, err)
+	}
+	checkpoint.Complete = true
+	if err := saveCheckpoint(txn, checkpoint); err != nil {
+		txn.Rollback()
+		return result, err
+	}
+	if err := txn.Commit(); err != nil {
+		return result, fmt.Errorf("syncTable: Problem completing the pass of %s: %v", table.Name, err)
+	}
+	result.Deleted = deleted
+	return result, nil
+}
+
+// upsertRows inserts rows into table, replacing the rows with the same
+// primary key. Rows are sent in as few statements as the parameter limit
+// allows.
+func (s *sqlSyncer) upsertRows(txn sqlTxn, table *sqlTable, pass int64, rows [][]interface{}) error {
+	var names, updates, keys []string
+	for ii, column := range table.Columns {
+		names = append(names, column.Name)
+		if ii < table.keyColumns {
+			keys = append(keys, column.Name)
+		} else {
+			updates = append(updates, fmt.Sprintf("%s = excluded.%s", sqlQuote(column.Name), sqlQuote(column.Name)))
+		}
+	}
+	names = append(names, sqlSyncPassColumn)
+	updates = append(updates, fmt.Sprintf("%s = excluded.%s", sqlQuote(sqlSyncPassColumn), sqlQuote(sqlSyncPassColumn)))
+	placeholders := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(names)), ", ") + ")"
+
+	perStatement := sqlMaxParams / len(names)
+	for len(rows) > 0 {
+		chunk := rows
+		if len(chunk) > perStatement {
+			chunk = chunk[:perStatement]
+		}
+		rows = rows[len(chunk):]
+
+		var query bytes.Buffer
+		fmt.Fprintf(&query, "INSERT INTO %s (%s) VALUES ", sqlQuote(table.Name), sqlQuoteAll(names))
+		args := make([]interface{}, 0, len(chunk)*len(names))
+		for ii, row := range chunk {
+			if ii > 0 {
+				query.WriteString(", ")
+			}
+			query.WriteString(placeholders)
+			for jj, cell := range row {
+				arg, err := sqlArg(cell)
+				if err != nil {
+					return fmt.Errorf("upsertRows: %s.%s: %v", table.Name, table.Columns[jj].Name, err)
+				}
+				args = append(args, arg)
+			}
+			args = append(args, pass)
+		}
+		fmt.Fprintf(&query, " ON CONFLICT (%s) DO UPDATE SET %s", sqlQuoteAll(keys), strings.Join(updates, ", "))
+		if _, err := txn.Exec(query.String(), args...); err != nil {
+			return fmt.Errorf("upsertRows: Problem writing %d rows to %s: %v", len(chunk), table.Name, err)
+		}
+	}
+	return nil
+}
+
+// sqlArg converts a cell to a statement parameter. Unsigned integers are
+// stored as BIGINT, which neither database has an unsigned variant of.
+func sqlArg(cell interface{}) (interface{}, error) {
+	if v, ok := cell.(uint64); ok {
+		if v > math.MaxInt64 {
+			return nil, fmt.Errorf("sqlArg: %d doesn't fit a BIGINT", v)
+		}
+		return int64(v), nil
+	}
+	return cell, nil
+}
+
+// sync runs a single pass over tables, resuming interrupted ones.
+func (s *sqlSyncer) sync(ctx context.Context, db *nodeDB, tables []*sqlTable) ([]*sqlSyncResult, error) {
+	var results []*sqlSyncResult
+	for _, table := range tables {
+		result, err := s.syncTable(ctx, db, table)
+		if result != nil {
+			results = append(results, result)
+		}
+		if err != nil {
+			return results, err
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-pg/pg/v10"
+)
+
+var postgresDialect = &sqlDialect{
+	name: "postgres",
+	types: map[columnType]string{
+		columnString:  "TEXT",
+		columnUint64:  "BIGINT",
+		columnInt64:   "BIGINT",
+		columnBool:    "BOOLEAN",
+		columnUint256: "NUMERIC(78, 0)",
+	},
+	timestampType: "TIMESTAMPTZ",
+}
+
+// postgresConn writes to Postgres through go-pg, which fills in the ?
+// placeholders itself.
+type postgresConn struct {
+	db *pg.DB
+}
+
+func openPostgresConn(url string) (*postgresConn, error) {
+	options, err := pg.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("openPostgresConn: Problem parsing the URL: %v", err)
+	}
+	db := pg.Connect(options)
+	if err := db.Ping(context.Background()); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("openPostgresConn: Problem connecting to %s: %v", options.Addr, err)
+	}
+	return &postgresConn{db: db}, nil
+}
+
+func (conn *postgresConn) Dialect() *sqlDialect {
+	return postgresDialect
+}
+
+func (conn *postgresConn) Exec(query string, args ...interface{}) (int64, error) {
+	result, err := conn.db.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return int64(result.RowsAffected()), nil
+}
+
+func (conn *postgresConn) QueryRow(dest []interface{}, query string, args ...interface{}) (bool, error) {
+	_, err := conn.db.QueryOne(pg.Scan(dest...), query, args...)
+	if err == pg.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (conn *postgresConn) Begin() (sqlTxn, error) {
+	txn, err := conn.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &postgresTxn{txn: txn}, nil
+}
+
+func (conn *postgresConn) Close() error {
+	return conn.db.Close()
+}
+
+type postgresTxn struct {
+	txn *pg.Tx
+}
+
+func (txn *postgresTxn) Exec(query string, args ...interface{}) (int64, error) {
+	result, err := txn.txn.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return int64(result.RowsAffected()), nil
+}
+
+func (txn *postgresTxn) Commit() error {
+	return txn.txn.Commit()
+}
+
+func (txn *postgresTxn) Rollback() error {
+	return txn.txn.Rollback()
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+var sqliteDialect = &sqlDialect{
+	name: "sqlite",
+	types: map[columnType]string{
+		columnString:  "TEXT",
+		columnUint64:  "INTEGER",
+		columnInt64:   "INTEGER",
+		columnBool:    "BOOLEAN",
+		columnUint256: "TEXT",
+	},
+	timestampType: "TEXT",
+}
+
+// sqliteConn writes to a SQLite file through database/sql.
+type sqliteConn struct {
+	db *sql.DB
+}
+
+func openSQLiteConn(path string) (*sqliteConn, error) {
+	// WAL lets dashboards read the file while sync writes to it.
+	db, err := sql.Open("sqlite3", "file:"+path+"?_journal_mode=WAL&_busy_timeout=5000")
+	if err != nil {
+		return nil, fmt.Errorf("openSQLiteConn: Problem opening %s: %v", path, err)
+	}
+	// A single connection, so transactions and plain statements don't lock
+	// each other out.
+	db.SetMaxOpenConns(1)
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("openSQLiteConn: Problem opening %s: %v", path, err)
+	}
+	return &sqliteConn{db: db}, nil
+}
+
+func (conn *sqliteConn) Dialect() *sqlDialect {
+	return sqliteDialect
+}
+
+func (conn *sqliteConn) Exec(query string, args ...interface{}) (int64, error) {
+	return sqliteRowsAffected(conn.db.Exec(query, args...))
+}
+
+func (conn *sqliteConn) QueryRow(dest []interface{}, query string, args ...interface{}) (bool, error) {
+	err := conn.db.QueryRow(query, args...).Scan(dest...)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (conn *sqliteConn) Begin() (sqlTxn, error) {
+	txn, err := conn.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &sqliteTxn{txn: txn}, nil
+}
+
+func (conn *sqliteConn) Close() error {
+	return conn.db.Close()
+}
+
+type sqliteTxn struct {
+	txn *sql.Tx
+}
+
+func (txn *sqliteTxn) Exec(query string, args ...interface{}) (int64, error) {
+	return sqliteRowsAffected(txn.txn.Exec(query, args...))
+}
+
+func (txn *sqliteTxn) Commit() error {
+	return txn.txn.Commit()
+}
+
+func (txn *sqliteTxn) Rollback() error {
+	return txn.txn.Rollback()
+}
+
+func sqliteRowsAffected(result sql.Result, err error) (int64, error) {
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"math/bits"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// sizeHistogram counts how often each size was seen. Keys and values of a
+// prefix come in few distinct sizes, so the exact counts stay small and the
+// percentiles are exact.
+type sizeHistogram struct {
+	counts map[int64]int64
+	count  int64
+	total  int64
+	max    int64
+}
+
+func newSizeHistogram() *sizeHistogram {
+	return &sizeHistogram{counts: make(map[int64]int64)}
+}
+
+func (h *sizeHistogram) add(size int64) {
+	h.counts[size]++
+	h.count++
+	h.total += size
+	if size > h.max {
+		h.max = size
+	}
+}
+
+func (h *sizeHistogram) merge(other *sizeHistogram) {
+	for size, count := range other.counts {
+		h.counts[size] += count
+	}
+	h.count += other.count
+	h.total += other.total
+	if other.max > h.max {
+		h.max = other.max
+	}
+}
+
+// percentile returns the smallest size that at least p percent of the sizes
+// are at or below.
+func (h *sizeHistogram) percentile(p float64) int64 {
+	if h.count == 0 {
+		return 0
+	}
+	sizes := make([]int64, 0, len(h.counts))
+	for size := range h.counts {
+		sizes = append(sizes, size)
+	}
+	sort.Slice(sizes, func(i, j int) bool { return sizes[i] < sizes[j] })
+
+	rank := int64(p / 100 * float64(h.count))
+	if rank < 1 {
+		rank = 1
+	}
+	seen := int64(0)
+	for _, size := range sizes {
+		if seen += h.counts[size]; seen >= rank {
+			return size
+		}
+	}
+	return h.max
+}
+
+// histogramBucket counts the sizes below UpTo that didn't fit in the bucket
+// before it. Buckets are powers of two.
+type histogramBucket struct {
+	UpTo  int64 `json:"upTo"`
+	Count int64 `json:"count"`
+}
+
+func (h *sizeHistogram) buckets() []*histogramBucket {
+	counts := make(map[int]int64)
+	maxBucket := 0
+	for size, count := range h.counts {
+		bucket := bits.Len64(uint64(size))
+		counts[bucket] += count
+		if bucket > maxBucket {
+			maxBucket = bucket
+		}
+	}
+	buckets := []*histogramBucket{}
+	for bucket := 0; bucket <= maxBucket && h.count > 0; bucket++ {
+		buckets = append(buckets, &histogramBucket{UpTo: int64(1) << bucket, Count: counts[bucket]})
+	}
+	return buckets
+}
+
+// sizeStats summarizes a sizeHistogram.
+type sizeStats struct {
+	Total     int64              `json:"total"`
+	Mean      float64            `json:"mean"`
+	P50       int64              `json:"p50"`
+	P90       int64              `json:"p90"`
+	P99       int64              `json:"p99"`
+	Max       int64              `json:"max"`
+	Histogram []*histogramBucket `json:"histogram"`
+}
+
+func (h *sizeHistogram) stats() *sizeStats {
+	stats := &sizeStats{
+		Total:     h.total,
+		P50:       h.percentile(50),
+		P90:       h.percentile(90),
+		P99:       h.percentile(99),
+		Max:       h.max,
+		Histogram: h.buckets(),
+	}
+	if h.count > 0 {
+		stats.Mean = float64(h.total) / float64(h.count)
+	}
+	return stats
+}
+
+// prefixStats are the stats of the keys stored under a single prefix, or of
+// a category of prefixes.
+type prefixStats struct {
+	// Prefix is nil for categories. Keys whose leading byte isn't mapped in
+	// DBPrefixes get a prefix named "unmapped".
+	Prefix   *namedPrefix `json:"prefix,omitempty"`
+	Category string       `json:"category,omitempty"`
+	Count    int64        `json:"count"`
+	Keys     *sizeStats   `json:"keys"`
+	Values   *sizeStats   `json:"values"`
+	// LSMBytes are the bytes of the keys and of the values small enough to
+	// be stored next to them, VlogBytes those of the values in the value log.
+	LSMBytes  int64 `json:"lsmBytes"`
+	VlogBytes int64 `json:"vlogBytes"`
+	// LSMShare and VlogShare are the percentage of the LSM tree and value log
+	// taken by the prefix, and the Estimated*DiskBytes that share of the
+	// files on disk.
+	LSMShare               float64 `json:"lsmShare"`
+	VlogShare              float64 `json:"vlogShare"`
+	EstimatedLSMDiskBytes  int64   `json:"estimatedLsmDiskBytes"`
+	EstimatedVlogDiskBytes int64   `json:"estimatedVlogDiskBytes"`
+	keySizes, valueSizes   *sizeHistogram
+	lsmBytes, vlogBytes    int64
+}
+
+func newPrefixStats(prefix *namedPrefix, category string) *prefixStats {
+	return &prefixStats{Prefix: prefix, Category: category, keySizes: newSizeHistogram(), valueSizes: newSizeHistogram()}
+}
+
+func (stats *prefixStats) merge(other *prefixStats) {
+	stats.Count += other.Count
+	stats.keySizes.merge(other.keySizes)
+	stats.valueSizes.merge(other.valueSizes)
+	stats.lsmBytes += other.lsmBytes
+	stats.vlogBytes += other.vlogBytes
+}
+
+// finish fills in the exported fields once every key has been counted.
+func (stats *prefixStats) finish(totals *prefixStats, lsmDiskBytes int64, vlogDiskBytes int64) {
+	stats.Keys = stats.keySizes.stats()
+	stats.Values = stats.valueSizes.stats()
+	stats.LSMBytes, stats.VlogBytes = stats.lsmBytes, stats.vlogBytes
+	if totals.lsmBytes > 0 {
+		stats.LSMShare = 100 * float64(stats.lsmBytes) / float64(totals.lsmBytes)
+		stats.EstimatedLSMDiskBytes = int64(stats.LSMShare / 100 * float64(lsmDiskBytes))
+	}
+	if totals.vlogBytes > 0 {
+		stats.VlogShare = 100 * float64(stats.vlogBytes) / float64(totals.vlogBytes)
+		stats.EstimatedVlogDiskBytes = int64(stats.VlogShare / 100 * float64(vlogDiskBytes))
+	}
+}
+
+// dbStats is the report of the stats command.
+type dbStats struct {
+	// LSMDiskBytes and VlogDiskBytes are the sizes of the .sst and .vlog
+	// files. They include old versions and deleted keys that haven't been
+	// compacted or garbage collected yet, which no prefix is charged for.
+	LSMDiskBytes  int64          `json:"lsmDiskBytes"`
+	VlogDiskBytes int64          `json:"vlogDiskBytes"`
+	Total         *prefixStats   `json:"total"`
+	Categories    []*prefixStats `json:"categories"`
+	Prefixes      []*prefixStats `json:"prefixes"`
+}
+
+// collectDBStats walks every key of the DB once, without reading the values,
+// and charges it to the prefix of its leading byte. dir is the directory the
+// DB files are measured in.
+func collectDBStats(ctx context.Context, db kvDB, dir string) (*dbStats, error) {
+	lsmDiskBytes, vlogDiskBytes, err := badgerDiskUsage(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[byte]*prefixStats)
+	for _, prefix := range listPrefixes() {
+		if len(prefix.Prefix) == 1 {
+			byID[prefix.Prefix[0]] = newPrefixStats(prefix, "")
+		}
+	}
+	err = db.View(func(txn kvTxn) error {
+		it := txn.NewIterator(kvIteratorOptions{})
+		defer it.Close()
+		for it.Seek(nil); it.ValidForPrefix(nil); it.Next() {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			key := it.Key()
+			stats := byID[key[0]]
+			if stats == nil {
+				stats = newPrefixStats(&namedPrefix{Name: "unmapped", Prefix: []byte{key[0]}}, "")
+				byID[key[0]] = stats
+			}
+			valueSize, inValueLog := it.ValueSize()
+			stats.Count++
+			stats.keySizes.add(int64(len(key)))
+			stats.valueSizes.add(valueSize)
+			stats.lsmBytes += int64(len(key))
+			if inValueLog {
+				stats.vlogBytes += valueSize
+			} else {
+				stats.lsmBytes += valueSize
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	report := &dbStats{LSMDiskBytes: lsmDiskBytes, VlogDiskBytes: vlogDiskBytes, Total: newPrefixStats(nil, "")}
+	for id := 0; id < 256; id++ {
+		if stats := byID[byte(id)]; stats != nil {
+			report.Prefixes = append(report.Prefixes, stats)
+			report.Total.merge(stats)
+		}
+	}
+	for _, category := range append(append([]string{}, prefixCategories...), "") {
+		categoryStats := newPrefixStats(nil, category)
+		if category == "" {
+			categoryStats.Category = "none"
+		}
+		for _, stats := range report.Prefixes {
+			if (category == "" && len(stats.Prefix.Categories()) == 0) || stats.Prefix.InCategory(category) {
+				categoryStats.merge(stats)
+			}
+		}
+		report.Categories = append(report.Categories, categoryStats)
+	}
+	for _, stats := range append(append([]*prefixStats{report.Total}, report.Categories...), report.Prefixes...) {
+		stats.finish(report.Total, lsmDiskBytes, vlogDiskBytes)
+	}
+	return report, nil
+}
+
+// badgerDiskUsage adds up the sizes of the LSM tables and value log files in
+// dir.
+func badgerDiskUsage(dir string) (lsm int64, vlog int64, _ error) {
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		switch filepath.Ext(path) {
+		case ".sst":
+			lsm += info.Size()
+		case ".vlog":
+			vlog += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, 0, fmt.Errorf("badgerDiskUsage: Problem measuring %s: %v", dir, err)
+	}
+	return lsm, vlog, nil
+}
+
+// printDBStats writes report as a table with a section per category, in the
+// order of prefixCategories. A prefix is listed under every category it is
+// in, and under "none" if it is in none of them.
+func printDBStats(w io.Writer, report *dbStats) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "ID\tPREFIX\tCOUNT\tKEY BYTES\tKEY P50/P90/P99/MAX\tVALUE BYTES\tVALUE P50/P90/P99/MAX\tLSM %%\tVLOG %%\t\n")
+	row := func(id string, name string, stats *prefixStats) {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\t%s\t%s\t%.2f\t%.2f\t\n", id, name, stats.Count,
+			formatBytes(stats.Keys.Total), formatPercentiles(stats.Keys),
+			formatBytes(stats.Values.Total), formatPercentiles(stats.Values),
+			stats.LSMShare, stats.VlogShare)
+	}
+	for _, category := range report.Categories {
+		fmt.Fprintf(tw, "\t[%s]\t\t\t\t\t\t\t\t\n", category.Category)
+		for _, stats := range report.Prefixes {
+			inCategory := stats.Prefix.InCategory(category.Category)
+			if category.Category == "none" {
+				inCategory = len(stats.Prefix.Categories()) == 0
+			}
+			if inCategory {
+				row(fmt.Sprint(bytesToInts(stats.Prefix.Prefix)), stats.Prefix.Name, stats)
+			}
+		}
+		row("", "subtotal", category)
+	}
+	row("", "total", report.Total)
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "\nOn disk: LSM %s, value log %s. Shares are of the live keys and values, "+
+		"old versions and deleted keys aren't counted.\n", formatBytes(report.LSMDiskBytes), formatBytes(report.VlogDiskBytes))
+	return err
+}
+
+func formatPercentiles(stats *sizeStats) string {
+	parts := []string{}
+	for _, size := range []int64{stats.P50, stats.P90, stats.P99, stats.Max} {
+		parts = append(parts, formatBytes(size))
+	}
+	return strings.Join(parts, "/")
+}
+
+// formatBytes prints a size in B, KiB, MiB or GiB.
+func formatBytes(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%dB", size)
+	}
+	value, suffix := float64(size), ""
+	for _, s := range []string{"KiB", "MiB", "GiB", "TiB"} {
+		value, suffix = value/unit, s
+		if value < unit {
+			break
+		}
+	}
+	return fmt.Sprintf("%.1f%s", value, suffix)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// kvDB is the part of a badger DB the tool reads through. Every reader of
+// the node's DB only depends on it, which also lets tests read from an
+// in-memory DB.
+type kvDB interface {
+	View(fn func(txn kvTxn) error) error
+	Close() error
+}
+
+// kvTxn is a read-only badger txn.
+type kvTxn interface {
+	// Get returns a copy of the value of key, or errKeyNotFound.
+	Get(key []byte) ([]byte, error)
+	NewIterator(opts kvIteratorOptions) kvIterator
+}
+
+type kvIteratorOptions struct {
+	Prefix         []byte
+	PrefetchValues bool
+	Reverse        bool
+}
+
+// kvIterator mirrors badger's Iterator, with the methods of its items folded
+// in.
+type kvIterator interface {
+	Seek(key []byte)
+	// HasItem reports whether the iterator is at a key, even one without the
+	// prefix it was created with, which ValidForPrefix rejects.
+	HasItem() bool
+	ValidForPrefix(prefix []byte) bool
+	Next()
+	// Key is only valid until the next call to Next.
+	Key() []byte
+	// Value returns a copy of the current value.
+	Value() ([]byte, error)
+	// ValueSize returns the size of the current value without reading it,
+	// and whether it is stored in the value log rather than the LSM tree.
+	ValueSize() (size int64, inValueLog bool)
+	Close()
+}
+
+// errKeyNotFound is returned by kvTxn.Get in place of the ErrKeyNotFound of
+// whichever badger version is behind it.
+var errKeyNotFound = errors.New("Key not found")
+
+// badgerManifestVersion is the format version both badger v3 and v4 write to
+// their MANIFEST. Nothing else on disk differs between the two either, so
+// every DB a node wrote with either of them is opened with v4.
+const badgerManifestVersion = 8
+
+// badgerFormat is what the MANIFEST of a DB says about the badger that wrote
+// it.
+type badgerFormat struct {
+	// ExternalMagic is the magic number an application can stamp its DB
+	// with in badger v4. It has to be passed back to open the DB.
+	ExternalMagic uint16
+}
+
+// detectBadgerFormat reads the header of the MANIFEST in dir. The header is
+// the magic text "Bdgr" followed by a big-endian uint32 version in badger v3,
+// which v4 splits into a uint16 external magic and a uint16 version.
+func detectBadgerFormat(dir string) (*badgerFormat, error) {
+	file, err := os.Open(filepath.Join(dir, "MANIFEST"))
+	if err != nil {
+		return nil, fmt.Errorf("detectBadgerFormat: %s is not a badger directory: %v", dir, err)
+	}
+	defer file.Close()
+
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(file, header); err != nil {
+		return nil, fmt.Errorf("detectBadgerFormat: Problem reading the MANIFEST header in %s: %v", dir, err)
+	}
+	if !bytes.Equal(header[:4], []byte("Bdgr")) {
+		return nil, fmt.Errorf("detectBadgerFormat: The MANIFEST in %s doesn't start with Bdgr, it wasn't written by badger", dir)
+	}
+
+	externalMagic := binary.BigEndian.Uint16(header[4:6])
+	version := binary.BigEndian.Uint16(header[6:8])
+	switch {
+	case version == badgerManifestVersion:
+		return &badgerFormat{ExternalMagic: externalMagic}, nil
+	case version < badgerManifestVersion && externalMagic == 0:
+		return nil, fmt.Errorf("detectBadgerFormat: %s was written by badger v1 or v2 (manifest version %d), "+
+			"only v3 and v4 (manifest version %d) are supported", dir, version, badgerManifestVersion)
+	}
+	return nil, fmt.Errorf("detectBadgerFormat: %s has manifest version %d and external magic %d, "+
+		"which is newer than the badger v3 and v4 this tool supports", dir, version, externalMagic)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+func TestDetectBadgerFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  []byte
+		want    *badgerFormat
+		wantErr string
+	}{
+		{"v3 or v4", []byte("Bdgr\x00\x00\x00\x08"), &badgerFormat{}, ""},
+		{"external magic", []byte("Bdgr\x12\x34\x00\x08"), &badgerFormat{ExternalMagic: 0x1234}, ""},
+		{"v1 or v2", []byte("Bdgr\x00\x00\x00\x07"), nil, "badger v1 or v2"},
+		{"newer", []byte("Bdgr\x00\x00\x00\x09"), nil, "newer than"},
+		{"not badger", []byte("LevelDB!"), nil, "doesn't start with Bdgr"},
+		{"truncated", []byte("Bdgr"), nil, "Problem reading the MANIFEST header"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dir, "MANIFEST"), test.header, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			format, err := detectBadgerFormat(dir)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("got error %v, want one containing %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *format != *test.want {
+				t.Errorf("got format %+v, want %+v", format, test.want)
+			}
+		})
+	}
+}
+
+// TestOpenNodeDB opens a DB badger wrote, in both modes.
+func TestOpenNodeDB(t *testing.T) {
+	dir := t.TempDir()
+	db, err := badger.Open(badger.DefaultOptions(dir).WithLogger(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(func(txn *badger.Txn) error {
+		return txn.Set([]byte("key"), []byte("value"))
+	})
+	if closeErr := db.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, mode := range []string{openModeReadOnly, openModeSnapshot} {
+		t.Run(mode, func(t *testing.T) {
+			nodeDB, err := openNodeDB(dir, mode, t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer nodeDB.Close()
+			err = nodeDB.View(func(txn kvTxn) error {
+				val, err := txn.Get([]byte("key"))
+				if err == nil && string(val) != "value" {
+					t.Errorf("got value %q, want %q", val, "value")
+				}
+				return err
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestOpenNodeDBMissingDir(t *testing.T) {
+	_, err := openNodeDB(filepath.Join(t.TempDir(), "missing"), openModeReadOnly, "")
+	if err == nil || !strings.Contains(err.Error(), "is not a badger directory") {
+		t.Fatalf("got error %v, want one saying the dir is not a badger directory", err)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import "github.com/dgraph-io/badger/v4"
+
+// badgerV4DB is a kvDB backed by badger v4.
+type badgerV4DB struct {
+	db *badger.DB
+}
+
+func openBadgerV4(dir string, readOnly bool, externalMagic uint16) (*badgerV4DB, error) {
+	db, err := badger.Open(badger.DefaultOptions(dir).WithReadOnly(readOnly).WithExternalMagic(externalMagic))
+	if err != nil {
+		return nil, err
+	}
+	return &badgerV4DB{db: db}, nil
+}
+
+func (db *badgerV4DB) View(fn func(txn kvTxn) error) error {
+	return db.db.View(func(txn *badger.Txn) error {
+		return fn(badgerV4Txn{txn})
+	})
+}
+
+func (db *badgerV4DB) Close() error {
+	return db.db.Close()
+}
+
+// badgerV4Txn is a kvTxn backed by badger v4. It is also used to read our own
+// DBs, such as the dead-letter queue, with the same helpers as the node's.
+type badgerV4Txn struct {
+	txn *badger.Txn
+}
+
+func (txn badgerV4Txn) Get(key []byte) ([]byte, error) {
+	item, err := txn.txn.Get(key)
+	if err == badger.ErrKeyNotFound {
+		return nil, errKeyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return item.ValueCopy(nil)
+}
+
+func (txn badgerV4Txn) NewIterator(opts kvIteratorOptions) kvIterator {
+	badgerOpts := badger.DefaultIteratorOptions
+	badgerOpts.Prefix = opts.Prefix
+	badgerOpts.PrefetchValues = opts.PrefetchValues
+	badgerOpts.Reverse = opts.Reverse
+	return badgerV4Iterator{txn.txn.NewIterator(badgerOpts)}
+}
+
+type badgerV4Iterator struct {
+	*badger.Iterator
+}
+
+func (it badgerV4Iterator) HasItem() bool {
+	return it.Item() != nil
+}
+
+func (it badgerV4Iterator) Key() []byte {
+	return it.Item().Key()
+}
+
+func (it badgerV4Iterator) Value() ([]byte, error) {
+	return it.Item().ValueCopy(nil)
+}
+
+func (it badgerV4Iterator) ValueSize() (int64, bool) {
+	item := it.Item()
+	// EstimatedSize is the key plus the value when the value is inline, and
+	// the size of the whole value log entry otherwise.
+	return item.ValueSize(), item.EstimatedSize() > item.KeySize()+item.ValueSize()
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// columnType is the type of a column of a tabular export.
+type columnType int
+
+const (
+	// columnString holds text. Ids, public keys and hashes are written the
+	// way they are printed everywhere else, and maps as JSON.
+	columnString columnType = iota
+	columnUint64
+	columnInt64
+	columnBool
+	// columnUint256 holds uint256 amounts as decimal text, since they don't
+	// fit any integer column.
+	columnUint256
+)
+
+// tableColumn is a single column of a tableSchema.
+type tableColumn struct {
+	Name string
+	Type columnType
+}
+
+// tableSchema is the fixed set of columns the entries of a prefix are
+// exported with. Entries are flattened into columns in the order their fields
+// are declared in, with nested structs such as the CoinEntry of a profile
+// joined with an underscore, e.g. CreatorCoinEntry_DeSoLockedNanos. Prefixes
+// whose value is a single number get the fields of their key as columns,
+// followed by the value.
+type tableSchema struct {
+	Columns []*tableColumn
+	// fromKey is set for the prefixes whose rows start with the key fields.
+	fromKey bool
+}
+
+// tableSchemas are the prefixes export can write as CSV or Parquet.
+var tableSchemas = map[string]*tableSchema{
+	"PrefixPublicKeyToDeSoBalanceNanos": newKeyValueSchema("PrefixPublicKeyToDeSoBalanceNanos", "BalanceNanos", columnUint64),
+
+	"PrefixPKIDToProfileEntry": newEntrySchema(reflect.TypeOf(ProfileEntry{})),
+
+	"PrefixHODLerPKIDCreatorPKIDToBalanceEntry":        newEntrySchema(reflect.TypeOf(BalanceEntry{})),
+	"PrefixCreatorPKIDHODLerPKIDToBalanceEntry":        newEntrySchema(reflect.TypeOf(BalanceEntry{})),
+	"PrefixHODLerPKIDCreatorPKIDToDAOCoinBalanceEntry": newEntrySchema(reflect.TypeOf(BalanceEntry{})),
+	"PrefixCreatorPKIDHODLerPKIDToDAOCoinBalanceEntry": newEntrySchema(reflect.TypeOf(BalanceEntry{})),
+
+	"PrefixPostHashToPostEntry":            newEntrySchema(reflect.TypeOf(PostEntry{})),
+	"PrefixPostHashSerialNumberToNFTEntry": newEntrySchema(reflect.TypeOf(NFTEntry{})),
+
+	"PrefixDAOCoinLimitOrder":                 newEntrySchema(reflect.TypeOf(DAOCoinLimitOrderEntry{})),
+	"PrefixDAOCoinLimitOrderByTransactorPKID": newEntrySchema(reflect.TypeOf(DAOCoinLimitOrderEntry{})),
+	"PrefixDAOCoinLimitOrderByOrderID":        newEntrySchema(reflect.TypeOf(DAOCoinLimitOrderEntry{})),
+}
+
+// tabularPrefixNames returns the names of the prefixes in tableSchemas, for
+// error messages.
+func tabularPrefixNames() string {
+	var names []string
+	for _, prefix := range listPrefixes() {
+		if tableSchemas[prefix.Name] != nil {
+			names = append(names, prefix.Name)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+var (
+	stringerType      = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+func newEntrySchema(entryType reflect.Type) *tableSchema {
+	schema := &tableSchema{}
+	walkEntryColumns(entryType, "", func(name string, fieldType reflect.Type) {
+		schema.Columns = append(schema.Columns, &tableColumn{Name: name, Type: entryColumnType(fieldType)})
+	})
+	return schema
+}
+
+func newKeyValueSchema(prefixName string, valueName string, valueType columnType) *tableSchema {
+	schema := &tableSchema{fromKey: true}
+	for _, part := range keySchemas[prefixName] {
+		schema.Columns = append(schema.Columns, &tableColumn{Name: strings.ToUpper(part.Name[:1]) + part.Name[1:], Type: keyColumnType(part.Type)})
+	}
+	schema.Columns = append(schema.Columns, &tableColumn{Name: valueName, Type: valueType})
+	return schema
+}
+
+// keyColumnType is the column type of a key field of partType.
+func keyColumnType(partType keyPartType) columnType {
+	switch partType {
+	case keyUint8, keyUint32, keyMaxUint32MinusUint32, keyUint64:
+		return columnUint64
+	case keyBool:
+		return columnBool
+	}
+	return columnString
+}
+
+// walkEntryColumns calls fn with the column name and type of every field of
+// entryType, flattening the nested structs that aren't printed as a single
+// value.
+func walkEntryColumns(entryType reflect.Type, namePrefix string, fn func(name string, fieldType reflect.Type)) {
+	for i := 0; i < entryType.NumField(); i++ {
+		field := entryType.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		if isNestedEntry(field.Type) {
+			walkEntryColumns(field.Type, namePrefix+field.Name+"_", fn)
+			continue
+		}
+		fn(namePrefix+field.Name, field.Type)
+	}
+}
+
+func isNestedEntry(fieldType reflect.Type) bool {
+	return fieldType.Kind() == reflect.Struct && !fieldType.Implements(stringerType) &&
+		!reflect.PointerTo(fieldType).Implements(stringerType) && !fieldType.Implements(jsonMarshalerType)
+}
+
+func entryColumnType(fieldType reflect.Type) columnType {
+	if fieldType == reflect.TypeOf(&big.Int{}) {
+		return columnUint256
+	}
+	switch fieldType.Kind() {
+	case reflect.Bool:
+		return columnBool
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return columnUint64
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return columnInt64
+	}
+	return columnString
+}
+
+// tableRow turns an entry stored under prefix into the cells of its row. Cells
+// are strings, uint64s, int64s or bools, matching the types of the columns.
+func (schema *tableSchema) tableRow(prefix *namedPrefix, key []byte, value []byte) ([]interface{}, error) {
+	decoded, err := decodeValue(prefix, value)
+	if err != nil {
+		return nil, err
+	}
+	if decoded == nil {
+		return nil, fmt.Errorf("tableRow: no value stored under %x", key)
+	}
+
+	var row []interface{}
+	if schema.fromKey {
+		fields, err := decodeKey(prefix, key)
+		if err != nil {
+			return nil, err
+		}
+		for ii, field := range fields {
+			if ii >= len(schema.Columns)-1 {
+				return nil, fmt.Errorf("tableRow: key %x has more fields than the %s columns", key, prefix.Name)
+			}
+			cell, err := cellValue(reflect.ValueOf(field.Value), schema.Columns[ii].Type)
+			if err != nil {
+				return nil, err
+			}
+			row = append(row, cell)
+		}
+		cell, err := cellValue(reflect.ValueOf(decoded), schema.Columns[len(schema.Columns)-1].Type)
+		if err != nil {
+			return nil, err
+		}
+		return append(row, cell), nil
+	}
+
+	entry := reflect.Indirect(reflect.ValueOf(decoded))
+	if err := appendEntryCells(entry, schema.Columns, &row); err != nil {
+		return nil, err
+	}
+	if len(row) != len(schema.Columns) {
+		return nil, fmt.Errorf("tableRow: %s entry has %d fields, expected %d", prefix.Name, len(row), len(schema.Columns))
+	}
+	return row, nil
+}
+
+func appendEntryCells(entry reflect.Value, columns []*tableColumn, row *[]interface{}) error {
+	for i := 0; i < entry.NumField(); i++ {
+		if !entry.Type().Field(i).IsExported() {
+			continue
+		}
+		field := entry.Field(i)
+		if isNestedEntry(field.Type()) {
+			if err := appendEntryCells(field, columns, row); err != nil {
+				return err
+			}
+			continue
+		}
+		if len(*row) >= len(columns) {
+			return fmt.Errorf("appendEntryCells: more fields than columns")
+		}
+		cell, err := cellValue(field, columns[len(*row)].Type)
+		if err != nil {
+			return fmt.Errorf("appendEntryCells: %s: %v", columns[len(*row)].Name, err)
+		}
+		*row = append(*row, cell)
+	}
+	return nil
+}
+
+// cellValue converts a decoded field to the Go type of columns of columnType.
+func cellValue(value reflect.Value, cellType columnType) (interface{}, error) {
+	if (value.Kind() == reflect.Pointer || value.Kind() == reflect.Map || value.Kind() == reflect.Slice) && value.IsNil() {
+		switch cellType {
+		case columnUint64:
+			return uint64(0), nil
+		case columnInt64:
+			return int64(0), nil
+		case columnBool:
+			return false, nil
+		}
+		return "", nil
+	}
+	switch cellType {
+	case columnBool:
+		return value.Bool(), nil
+	case columnUint64:
+		if value.CanUint() {
+			return value.Uint(), nil
+		}
+		if number, ok := value.Interface().(*big.Int); ok && number.IsUint64() {
+			return number.Uint64(), nil
+		}
+		return nil, fmt.Errorf("cellValue: %v is not a uint64", value.Interface())
+	case columnInt64:
+		return value.Int(), nil
+	}
+
+	switch v := value.Interface().(type) {
+	case string:
+		return v, nil
+	case fmt.Stringer:
+		return v.String(), nil
+	case json.Marshaler:
+		encoded, err := v.MarshalJSON()
+		return string(encoded), err
+	}
+	if value.Kind() == reflect.Map {
+		encoded, err := json.Marshal(value.Interface())
+		return string(encoded), err
+	}
+	if value.CanUint() {
+		return strconv.FormatUint(value.Uint(), 10), nil
+	}
+	return fmt.Sprint(value.Interface()), nil
+}
+
+// cellText formats a cell for CSV.
+func cellText(cell interface{}) string {
+	switch v := cell.(type) {
+	case string:
+		return v
+	case uint64:
+		return strconv.FormatUint(v, 10)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return fmt.Sprint(cell)
+}
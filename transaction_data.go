@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+)
+
+// newTransactionData builds the payload the trade bot expects for a
+// transaction, in the shape of the indexer's GraphQL transaction. Keys and the
+// transaction id are Base58Check encoded with the prefix of keyNetwork.
+//
+// The txIndexMetadata of a creator coin trade is only known once the node has
+// connected it. We estimate it the way core's _connectCreatorCoin computes it,
+// from the profile's current coin entry, read through badgerTxn. badgerTxn
+// may be nil, in which case the estimate is skipped and DESOLockedNanosDiff
+// is left at zero.
+func newTransactionData(badgerTxn kvTxn, txnHash BlockHash, txn *MsgDeSoTxn) (*TransactionData, error) {
+	txnData := &TransactionData{
+		TransactionId: Base58CheckEncodeWithPrefix(txnHash[:], keyNetwork.PublicKeyPrefix),
+		TxnType:       txn.TxnType,
+	}
+
+	// The transactor and everyone receiving an output are affected by every
+	// txn, like in core's txindex, along with whoever the payload names.
+	var affected []string
+	for _, output := range append([]*DeSoOutput{{PublicKey: txn.PublicKey}}, txn.TxOutputs...) {
+		if len(output.PublicKey) > 0 {
+			affected = append(affected, PkToString(output.PublicKey))
+		}
+	}
+
+	payload, err := decodeTxnPayload(txn)
+	if err != nil {
+		// The bot still gets the txn, with the raw metadata.
+		txnData.PayloadError = err.Error()
+	}
+	txnData.Payload = payload
+	if payload, ok := payload.(affectsPublicKeys); ok {
+		affected = append(affected, payload.affectedPublicKeys()...)
+	}
+
+	if txn.TxnType == TxnTypeCreatorCoin {
+		meta := &CreatorCoinMetadata{}
+		if err := meta.FromBytes(txn.TxnMeta); err != nil {
+			return nil, fmt.Errorf("newTransactionData: Problem decoding txn %v: %v", txnHash, err)
+		}
+
+		txnData.TxnMeta.OperationType = int64(meta.OperationType)
+		txnData.TxnMeta.DeSoToSellNanos = int64OrMax(meta.DeSoToSellNanos)
+		txnData.TxnMeta.CreatorCoinToSellNanos = int64OrMax(meta.CreatorCoinToSellNanos)
+		txnData.TxnMeta.DeSoToAddNanos = int64OrMax(meta.DeSoToAddNanos)
+		txnData.TxnMeta.MinDeSoExpectedNanos = int64OrMax(meta.MinDeSoExpectedNanos)
+		txnData.TxnMeta.MinCreatorCoinExpectedNanos = int64OrMax(meta.MinCreatorCoinExpectedNanos)
+		txnData.TxnMeta.ProfilePublicKey = PkToString(meta.ProfilePublicKey)
+
+		txnData.TxIndexMetadata.OperationType = meta.OperationType.String()
+		txnData.TxIndexMetadata.DeSoToSellNanos = txnData.TxnMeta.DeSoToSellNanos
+		txnData.TxIndexMetadata.CreatorCoinToSellNanos = txnData.TxnMeta.CreatorCoinToSellNanos
+		txnData.TxIndexMetadata.DeSoToAddNanos = txnData.TxnMeta.DeSoToAddNanos
+		if badgerTxn != nil {
+			profile, err := DBGetProfileEntryForPublicKeyWithTxn(badgerTxn, meta.ProfilePublicKey)
+			if err != nil {
+				return nil, fmt.Errorf("newTransactionData: Problem looking up profile for txn %v: %v", txnHash, err)
+			}
+			if profile != nil {
+				txnData.TxIndexMetadata.DESOLockedNanosDiff = estimateDeSoLockedNanosDiff(txn, meta, profile)
+			}
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, publicKey := range affected {
+		if publicKey == "" || seen[publicKey] {
+			continue
+		}
+		seen[publicKey] = true
+		txnData.AffectedPublicKeys.Nodes = append(txnData.AffectedPublicKeys.Nodes,
+			AffectedPublicKey{PublicKey: publicKey})
+	}
+	return txnData, nil
+}
+
+// estimateDeSoLockedNanosDiff returns how much the DeSo locked in the profile
+// would change if the creator coin txn was connected now.
+func estimateDeSoLockedNanosDiff(txn *MsgDeSoTxn, meta *CreatorCoinMetadata, profile *ProfileEntry) int64 {
+	coinEntry := &profile.CreatorCoinEntry
+	switch meta.OperationType {
+	case CreatorCoinOperationTypeBuy:
+		desoAfterFeesNanos := basisPointsOf(meta.DeSoToSellNanos, 100*100-CreatorCoinTradeFeeBasisPoints)
+		// The founder reward is paid out in DeSo, unless the creator is buying
+		// their own coin.
+		desoFounderRewardNanos := uint64(0)
+		if string(txn.PublicKey) != string(profile.PublicKey) {
+			desoFounderRewardNanos = basisPointsOf(desoAfterFeesNanos, coinEntry.CreatorBasisPoints)
+		}
+		if desoFounderRewardNanos > desoAfterFeesNanos {
+			return 0
+		}
+		return int64OrMax(desoAfterFeesNanos - desoFounderRewardNanos)
+
+	case CreatorCoinOperationTypeSell:
+		desoBeforeFeesNanos := calculateDeSoToReturn(meta.CreatorCoinToSellNanos,
+			uint64OrMax(coinEntry.CoinsInCirculationNanos), coinEntry.DeSoLockedNanos)
+		return -int64OrMax(desoBeforeFeesNanos)
+	}
+	return 0
+}
+
+// basisPointsOf returns value * basisPoints / (100*100), using big ints like
+// core does so the product can't overflow.
+func basisPointsOf(value uint64, basisPoints uint64) uint64 {
+	product := new(big.Int).Mul(new(big.Int).SetUint64(value), new(big.Int).SetUint64(basisPoints))
+	return uint64OrMax(product.Div(product, big.NewInt(100*100)))
+}
+
+func int64OrMax(value uint64) int64 {
+	if value > math.MaxInt64 {
+		return math.MaxInt64
+	}
+	return int64(value)
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// TxnType mirrors core's TxnType. The values are part of the wire format.
+type TxnType uint8
+
+const (
+	TxnTypeUnset                        TxnType = 0
+	TxnTypeBlockReward                  TxnType = 1
+	TxnTypeBasicTransfer                TxnType = 2
+	TxnTypeBitcoinExchange              TxnType = 3
+	TxnTypePrivateMessage               TxnType = 4
+	TxnTypeSubmitPost                   TxnType = 5
+	TxnTypeUpdateProfile                TxnType = 6
+	TxnTypeUpdateBitcoinUSDExchangeRate TxnType = 8
+	TxnTypeFollow                       TxnType = 9
+	TxnTypeLike                         TxnType = 10
+	TxnTypeCreatorCoin                  TxnType = 11
+	TxnTypeSwapIdentity                 TxnType = 12
+	TxnTypeUpdateGlobalParams           TxnType = 13
+	TxnTypeCreatorCoinTransfer          TxnType = 14
+	TxnTypeCreateNFT                    TxnType = 15
+	TxnTypeUpdateNFT                    TxnType = 16
+	TxnTypeAcceptNFTBid                 TxnType = 17
+	TxnTypeNFTBid                       TxnType = 18
+	TxnTypeNFTTransfer                  TxnType = 19
+	TxnTypeAcceptNFTTransfer            TxnType = 20
+	TxnTypeBurnNFT                      TxnType = 21
+	TxnTypeAuthorizeDerivedKey          TxnType = 22
+	TxnTypeMessagingGroup               TxnType = 23
+	TxnTypeDAOCoin                      TxnType = 24
+	TxnTypeDAOCoinTransfer              TxnType = 25
+	TxnTypeDAOCoinLimitOrder            TxnType = 26
+	TxnTypeCreateUserAssociation        TxnType = 27
+	TxnTypeDeleteUserAssociation        TxnType = 28
+	TxnTypeCreatePostAssociation        TxnType = 29
+	TxnTypeDeletePostAssociation        TxnType = 30
+	TxnTypeAccessGroup                  TxnType = 31
+	TxnTypeAccessGroupMembers           TxnType = 32
+	TxnTypeNewMessage                   TxnType = 33
+)
+
+var txnTypeNames = map[TxnType]string{
+	TxnTypeUnset:                        "UNSET",
+	TxnTypeBlockReward:                  "BLOCK_REWARD",
+	TxnTypeBasicTransfer:                "BASIC_TRANSFER",
+	TxnTypeBitcoinExchange:              "BITCOIN_EXCHANGE",
+	TxnTypePrivateMessage:               "PRIVATE_MESSAGE",
+	TxnTypeSubmitPost:                   "SUBMIT_POST",
+	TxnTypeUpdateProfile:                "UPDATE_PROFILE",
+	TxnTypeUpdateBitcoinUSDExchangeRate: "UPDATE_BITCOIN_USD_EXCHANGE_RATE",
+	TxnTypeFollow:                       "FOLLOW",
+	TxnTypeLike:                         "LIKE",
+	TxnTypeCreatorCoin:                  "CREATOR_COIN",
+	TxnTypeSwapIdentity:                 "SWAP_IDENTITY",
+	TxnTypeUpdateGlobalParams:           "UPDATE_GLOBAL_PARAMS",
+	TxnTypeCreatorCoinTransfer:          "CREATOR_COIN_TRANSFER",
+	TxnTypeCreateNFT:                    "CREATE_NFT",
+	TxnTypeUpdateNFT:                    "UPDATE_NFT",
+	TxnTypeAcceptNFTBid:                 "ACCEPT_NFT_BID",
+	TxnTypeNFTBid:                       "NFT_BID",
+	TxnTypeNFTTransfer:                  "NFT_TRANSFER",
+	TxnTypeAcceptNFTTransfer:            "ACCEPT_NFT_TRANSFER",
+	TxnTypeBurnNFT:                      "BURN_NFT",
+	TxnTypeAuthorizeDerivedKey:          "AUTHORIZE_DERIVED_KEY",
+	TxnTypeMessagingGroup:               "MESSAGING_GROUP",
+	TxnTypeDAOCoin:                      "DAO_COIN",
+	TxnTypeDAOCoinTransfer:              "DAO_COIN_TRANSFER",
+	TxnTypeDAOCoinLimitOrder:            "DAO_COIN_LIMIT_ORDER",
+	TxnTypeCreateUserAssociation:        "CREATE_USER_ASSOCIATION",
+	TxnTypeDeleteUserAssociation:        "DELETE_USER_ASSOCIATION",
+	TxnTypeCreatePostAssociation:        "CREATE_POST_ASSOCIATION",
+	TxnTypeDeletePostAssociation:        "DELETE_POST_ASSOCIATION",
+	TxnTypeAccessGroup:                  "ACCESS_GROUP",
+	TxnTypeAccessGroupMembers:           "ACCESS_GROUP_MEMBERS",
+	TxnTypeNewMessage:                   "NEW_MESSAGE",
+}
+
+func (txnType TxnType) String() string {
+	if name, exists := txnTypeNames[txnType]; exists {
+		return name
+	}
+	return fmt.Sprintf("UNKNOWN_%d", uint8(txnType))
+}
+
+func (txnType TxnType) MarshalJSON() ([]byte, error) {
+	return json.Marshal(txnType.String())
+}
+
+type DeSoInput struct {
+	TxID  BlockHash
+	Index uint32
+}
+
+type DeSoOutput struct {
+	PublicKey   PublicKey
+	AmountNanos uint64
+}
+
+// TxnNonce is only set on version 1 transactions.
+type TxnNonce struct {
+	ExpirationBlockHeight uint64
+	PartialID             uint64
+}
+
+// MsgDeSoTxn mirrors core's MsgDeSoTxn. The metadata is kept as raw bytes
+// alongside its type.
+type MsgDeSoTxn struct {
+	TxInputs    []*DeSoInput
+	TxOutputs   []*DeSoOutput
+	TxnType     TxnType
+	TxnMeta     HexBytes
+	PublicKey   PublicKey
+	ExtraData   ExtraData
+	Signature   HexBytes
+	TxnVersion  uint64
+	TxnFeeNanos uint64
+	TxnNonce    *TxnNonce
+}
+
+// FromBytes decodes a transaction as written by core's MsgDeSoTxn.ToBytes.
+func (msg *MsgDeSoTxn) FromBytes(data []byte) error {
+	rr := bytes.NewReader(data)
+	ret := &MsgDeSoTxn{}
+
+	// De-serialize the inputs
+	numInputs, err := ReadUvarint(rr)
+	if err != nil {
+		return fmt.Errorf("MsgDeSoTxn.FromBytes: Problem converting len(msg.TxInputs): %v", err)
+	}
+	if numInputs > uint64(rr.Len()) {
+		return fmt.Errorf("MsgDeSoTxn.FromBytes: %d inputs can't fit in the %d bytes left", numInputs, rr.Len())
+	}
+	for ii := uint64(0); ii < numInputs; ii++ {
+		currentInput := &DeSoInput{}
+		if _, err = io.ReadFull(rr, currentInput.TxID[:]); err != nil {
+			return fmt.Errorf("MsgDeSoTxn.FromBytes: Problem converting input txid: %v", err)
+		}
+		inputIndex, err := ReadUvarint(rr)
+		if err != nil {
+			return fmt.Errorf("MsgDeSoTxn.FromBytes: Problem converting input index: %v", err)
+		}
+		currentInput.Index = uint32(inputIndex)
+		ret.TxInputs = append(ret.TxInputs, currentInput)
+	}
+
+	// De-serialize the outputs
+	numOutputs, err := ReadUvarint(rr)
+	if err != nil {
+		return fmt.Errorf("MsgDeSoTxn.FromBytes: Problem converting len(msg.TxOutputs): %v", err)
+	}
+	if numOutputs > uint64(rr.Len()) {
+		return fmt.Errorf("MsgDeSoTxn.FromBytes: %d outputs can't fit in the %d bytes left", numOutputs, rr.Len())
+	}
+	for ii := uint64(0); ii < numOutputs; ii++ {
+		currentOutput := &DeSoOutput{PublicKey: make(PublicKey, 33)}
+		if _, err = io.ReadFull(rr, currentOutput.PublicKey); err != nil {
+			return fmt.Errorf("MsgDeSoTxn.FromBytes: Problem reading DeSoOutput.PublicKey: %v", err)
+		}
+		if currentOutput.AmountNanos, err = ReadUvarint(rr); err != nil {
+			return fmt.Errorf("MsgDeSoTxn.FromBytes: Problem reading DeSoOutput.AmountNanos: %v", err)
+		}
+		ret.TxOutputs = append(ret.TxOutputs, currentOutput)
+	}
+
+	// De-serialize the metadata, which is its type followed by its bytes.
+	txnMetaType, err := ReadUvarint(rr)
+	if err != nil {
+		return fmt.Errorf("MsgDeSoTxn.FromBytes: Problem reading MsgDeSoTxn.TxnType: %v", err)
+	}
+	ret.TxnType = TxnType(txnMetaType)
+	if ret.TxnMeta, err = DecodeByteArray(rr); err != nil {
+		return fmt.Errorf("MsgDeSoTxn.FromBytes: Problem reading TxnMeta: %v", err)
+	}
+
+	if ret.PublicKey, err = decodePublicKey(rr); err != nil {
+		return fmt.Errorf("MsgDeSoTxn.FromBytes: Problem reading DeSoTxn.PublicKey: %v", err)
+	}
+	if ret.ExtraData, err = DecodeExtraData(rr); err != nil {
+		return fmt.Errorf("MsgDeSoTxn.FromBytes: Problem reading DeSoTxn.ExtraData: %v", err)
+	}
+	if ret.Signature, err = DecodeByteArray(rr); err != nil {
+		return fmt.Errorf("MsgDeSoTxn.FromBytes: Problem reading DeSoTxn.Signature: %v", err)
+	}
+
+	// Version 0 transactions end here. Later versions append the version,
+	// the fee and the nonce.
+	if rr.Len() > 0 {
+		if ret.TxnVersion, err = ReadUvarint(rr); err != nil {
+			return fmt.Errorf("MsgDeSoTxn.FromBytes: Problem reading TxnVersion: %v", err)
+		}
+		if ret.TxnVersion >= 1 {
+			if ret.TxnFeeNanos, err = ReadUvarint(rr); err != nil {
+				return fmt.Errorf("MsgDeSoTxn.FromBytes: Problem reading TxnFeeNanos: %v", err)
+			}
+			ret.TxnNonce = &TxnNonce{}
+			if ret.TxnNonce.ExpirationBlockHeight, err = ReadUvarint(rr); err != nil {
+				return fmt.Errorf("MsgDeSoTxn.FromBytes: Problem reading TxnNonce.ExpirationBlockHeight: %v", err)
+			}
+			if ret.TxnNonce.PartialID, err = ReadUvarint(rr); err != nil {
+				return fmt.Errorf("MsgDeSoTxn.FromBytes: Problem reading TxnNonce.PartialID: %v", err)
+			}
+		}
+	}
+
+	*msg = *ret
+	return nil
+}
+
+// txnHashFromBytes computes the hash of a serialized transaction the way
+// core's MsgDeSoTxn.Hash does, a double sha256 over the signed bytes.
+func txnHashFromBytes(data []byte) BlockHash {
+	first := sha256.Sum256(data)
+	return BlockHash(sha256.Sum256(first[:]))
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// CreatorCoinOperationType mirrors core's type of the same name.
+type CreatorCoinOperationType uint8
+
+const (
+	CreatorCoinOperationTypeBuy     CreatorCoinOperationType = 0
+	CreatorCoinOperationTypeSell    CreatorCoinOperationType = 1
+	CreatorCoinOperationTypeAddDeSo CreatorCoinOperationType = 2
+)
+
+func (op CreatorCoinOperationType) String() string {
+	switch op {
+	case CreatorCoinOperationTypeBuy:
+		return "buy"
+	case CreatorCoinOperationTypeSell:
+		return "sell"
+	case CreatorCoinOperationTypeAddDeSo:
+		return "add"
+	}
+	return fmt.Sprintf("unknown_%d", uint8(op))
+}
+
+// CreatorCoinMetadata mirrors core's CreatorCoinMetadataa.
+type CreatorCoinMetadata struct {
+	ProfilePublicKey            PublicKey
+	OperationType               CreatorCoinOperationType
+	DeSoToSellNanos             uint64
+	CreatorCoinToSellNanos      uint64
+	DeSoToAddNanos              uint64
+	MinDeSoExpectedNanos        uint64
+	MinCreatorCoinExpectedNanos uint64
+}
+
+func (txnData *CreatorCoinMetadata) FromBytes(data []byte) error {
+	ret := CreatorCoinMetadata{}
+	rr := bytes.NewReader(data)
+
+	var err error
+	if ret.ProfilePublicKey, err = DecodeByteArray(rr); err != nil {
+		return fmt.Errorf("CreatorCoinMetadata.FromBytes: Error reading ProfilePublicKey: %v", err)
+	}
+	operationType, err := rr.ReadByte()
+	if err != nil {
+		return fmt.Errorf("CreatorCoinMetadata.FromBytes: Error reading OperationType: %v", err)
+	}
+	ret.OperationType = CreatorCoinOperationType(operationType)
+	if ret.DeSoToSellNanos, err = ReadUvarint(rr); err != nil {
+		return fmt.Errorf("CreatorCoinMetadata.FromBytes: Error reading DeSoToSellNanos: %v", err)
+	}
+	if ret.CreatorCoinToSellNanos, err = ReadUvarint(rr); err != nil {
+		return fmt.Errorf("CreatorCoinMetadata.FromBytes: Error reading CreatorCoinToSellNanos: %v", err)
+	}
+	if ret.DeSoToAddNanos, err = ReadUvarint(rr); err != nil {
+		return fmt.Errorf("CreatorCoinMetadata.FromBytes: Error reading DeSoToAddNanos: %v", err)
+	}
+	if ret.MinDeSoExpectedNanos, err = ReadUvarint(rr); err != nil {
+		return fmt.Errorf("CreatorCoinMetadata.FromBytes: Error reading MinDeSoExpectedNanos: %v", err)
+	}
+	if ret.MinCreatorCoinExpectedNanos, err = ReadUvarint(rr); err != nil {
+		return fmt.Errorf("CreatorCoinMetadata.FromBytes: Error reading MinCreatorCoinExpectedNanos: %v", err)
+	}
+
+	*txnData = ret
+	return nil
+}
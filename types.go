@@ -19,8 +19,19 @@ type TransactionData struct {
 		CreatorCoinToSellNanos int64  `json:"CreatorCoinToSellNanos"`
 	} `json:"txIndexMetadata"`
 	AffectedPublicKeys struct {
-		Nodes []struct {
-			PublicKey string `json:"publicKey"`
-		} `json:"nodes"`
+		Nodes []AffectedPublicKey `json:"nodes"`
 	} `json:"affectedPublicKeys"`
+
+	// TxnType is the name of the txn type, e.g. "FOLLOW", and says which of
+	// the *Payload types Payload is. txnMeta and txIndexMetadata are only
+	// filled in for creator coin txns.
+	TxnType TxnType    `json:"txnType"`
+	Payload TxnPayload `json:"payload"`
+	// PayloadError is set when the metadata could not be decoded, in which
+	// case Payload is a RawPayload.
+	PayloadError string `json:"payloadError,omitempty"`
+}
+
+type AffectedPublicKey struct {
+	PublicKey string `json:"publicKey"`
 }
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testWebhookConfig posts to url without waiting between attempts.
+func testWebhookConfig(url string) *webhookConfig {
+	return &webhookConfig{
+		URL:            url,
+		Timeout:        configDuration(5 * time.Second),
+		MaxAttempts:    3,
+		InitialBackoff: configDuration(time.Millisecond),
+		MaxBackoff:     configDuration(time.Millisecond),
+		Workers:        2,
+		QueueSize:      10,
+	}
+}
+
+func TestPostWithRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int
+		wantAttempts int
+		wantErr      bool
+	}{
+		{"ok", []int{200}, 1, false},
+		{"server error then ok", []int{500, 200}, 2, false},
+		{"rate limited then ok", []int{429, 200}, 2, false},
+		{"server errors", []int{503, 502, 500}, 3, true},
+		{"bad request", []int{400, 200}, 1, true},
+		{"unauthorized", []int{401, 200}, 1, true},
+		{"not found", []int{404, 200}, 1, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var requests int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				request := atomic.AddInt32(&requests, 1)
+				w.WriteHeader(test.statuses[request-1])
+			}))
+			defer server.Close()
+
+			attempts, err := newWebhookClient(testWebhookConfig(server.URL)).postWithRetries(context.Background(), []byte("{}"))
+			if (err != nil) != test.wantErr {
+				t.Errorf("got error %v, want one: %v", err, test.wantErr)
+			}
+			if attempts != test.wantAttempts || int(requests) != test.wantAttempts {
+				t.Errorf("got %d attempts and %d requests, want %d", attempts, requests, test.wantAttempts)
+			}
+		})
+	}
+
+	t.Run("network error", func(t *testing.T) {
+		server := httptest.NewServer(http.NotFoundHandler())
+		server.Close()
+		attempts, err := newWebhookClient(testWebhookConfig(server.URL)).postWithRetries(context.Background(), []byte("{}"))
+		if err == nil || attempts != 3 {
+			t.Errorf("got %d attempts and error %v, want 3 attempts and an error", attempts, err)
+		}
+	})
+}
+
+// TestWebhookClientQueue checks that Enqueue doesn't wait for a failing
+// endpoint, that every payload that isn't delivered ends up in the
+// dead-letter queue under an id of its own, and that onDone reports each
+// payload once.
+func TestWebhookClientQueue(t *testing.T) {
+	var mtx sync.Mutex
+	delivered := make(map[string]bool)
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body [64]byte
+		n, _ := r.Body.Read(body[:])
+		switch string(body[:n]) {
+		case `"slow"`:
+			// Holds up a worker until the test is done with the others.
+			<-release
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case `"rejected"`:
+			w.WriteHeader(http.StatusBadRequest)
+		default:
+			mtx.Lock()
+			delivered[string(body[:n])] = true
+			mtx.Unlock()
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	cfg := testWebhookConfig(server.URL)
+	cfg.QueueSize = 3
+	webhook := newWebhookClient(cfg)
+	deadLetters, err := openDeadLetterQueue(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer deadLetters.Close()
+	webhook.deadLetters = deadLetters
+	done := make(map[BlockHash]int)
+	webhook.onDone = func(txnHash BlockHash, err error) {
+		if err != nil {
+			t.Errorf("txn %v is done with error %v", txnHash, err)
+		}
+		mtx.Lock()
+		done[txnHash]++
+		mtx.Unlock()
+	}
+	webhook.Start(context.Background())
+
+	enqueue := func(id byte, payload string) {
+		webhook.Enqueue(*testBlockHash(id), []byte(payload))
+	}
+	enqueue(1, `"slow"`)
+	enqueue(2, `"rejected"`)
+	enqueue(3, `"ok"`)
+	waitFor := func(what string, done func() bool) {
+		t.Helper()
+		for deadline := time.Now().Add(5 * time.Second); !done(); time.Sleep(10 * time.Millisecond) {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s", what)
+			}
+		}
+	}
+	// One worker is stuck on the slow payload, the other delivers the rest.
+	waitFor("the ok payload", func() bool {
+		mtx.Lock()
+		defer mtx.Unlock()
+		return delivered[`"ok"`]
+	})
+
+	// With one worker stuck, the other is made to wait too so that the queue
+	// fills up. Enqueue dead-letters what doesn't fit rather than waiting.
+	enqueue(4, `"slow"`)
+	waitFor("both workers to be busy", func() bool { return len(webhook.queue) == 0 })
+	for id := byte(5); id < 5+byte(cfg.QueueSize)+2; id++ {
+		enqueue(id, `"queued"`)
+	}
+	if err := webhook.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	items, err := deadLetters.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := make(map[string]bool)
+	txnHashes := make(map[string]bool)
+	for _, item := range items {
+		ids[item.ID] = true
+		txnHashes[item.TxnHash] = true
+	}
+	// Everything but the ok payload: the two slow ones cancelled by Stop,
+	// the rejected one, the two that didn't fit and the queued ones.
+	want := 2 + 1 + 2 + cfg.QueueSize
+	if len(items) != want || len(ids) != want || len(txnHashes) != want {
+		t.Errorf("got %d dead letters with %d ids and %d txn hashes, want %d", len(items), len(ids), len(txnHashes), want)
+	}
+	if txnHashes[testBlockHash(3).String()] {
+		t.Errorf("the delivered payload was dead-lettered")
+	}
+	for id := byte(1); id < 5+byte(cfg.QueueSize)+2; id++ {
+		if done[*testBlockHash(id)] != 1 {
+			t.Errorf("onDone was called %d times for txn %d, want once", done[*testBlockHash(id)], id)
+		}
+	}
+}
+
+func TestDeadLetterQueueIDs(t *testing.T) {
+	deadLetters, err := openDeadLetterQueue(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer deadLetters.Close()
+	failedAt := time.Now().UTC()
+	for i := 0; i < 3; i++ {
+		if err := deadLetters.Add(&deadLetter{Payload: []byte("{}"), FailedAt: failedAt}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	items, err := deadLetters.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 3 {
+		t.Fatalf("got %d items for 3 that failed at the same time", len(items))
+	}
+	// They are listed in the order they were added.
+	for i := 1; i < len(items); i++ {
+		if items[i-1].ID >= items[i].ID {
+			t.Errorf("item %s is listed before %s", items[i-1].ID, items[i].ID)
+		}
+	}
+}
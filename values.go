@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// valueDecoder turns the raw value stored under a key into something that can
+// be rendered as JSON.
+type valueDecoder func(data []byte) (interface{}, error)
+
+// valueDecoders maps DBPrefixes field names to the decoder for the values
+// stored under them. Values of prefixes that are not listed here, or that hold
+// no value at all, are printed as hex.
+var valueDecoders = map[string]valueDecoder{
+	"PrefixBestDeSoBlockHash":              decodeRawBlockHash,
+	"PrefixUtxoKeyToUtxoEntry":             decodeEntry(func() DeSoDecoder { return &UtxoEntry{} }),
+	"PrefixUtxoNumEntries":                 decodeUint64BigEndian,
+	"PrefixNanosPurchased":                 decodeUint64BigEndian,
+	"PrefixUSDCentsPerBitcoinExchangeRate": decodeUint64BigEndian,
+
+	"PrefixTransactionIndexTip":            decodeRawBlockHash,
+	"PrefixPublicKeyIndexToTransactionIDs": decodeRawBlockHash,
+	"PrefixPublicKeyToNextIndex":           decodeUint32BigEndian,
+
+	"PrefixPostHashToPostEntry":   decodeEntry(func() DeSoDecoder { return &PostEntry{} }),
+	"PrefixPKIDToProfileEntry":    decodeEntry(func() DeSoDecoder { return &ProfileEntry{} }),
+	"PrefixProfileUsernameToPKID": decodeRawPKID,
+
+	"PrefixHODLerPKIDCreatorPKIDToBalanceEntry": decodeEntry(func() DeSoDecoder { return &BalanceEntry{} }),
+	"PrefixCreatorPKIDHODLerPKIDToBalanceEntry": decodeEntry(func() DeSoDecoder { return &BalanceEntry{} }),
+
+	"PrefixPublicKeyToPKID":            decodeRawPKID,
+	"PrefixPKIDToPublicKey":            decodeRawPublicKey,
+	"PrefixMempoolTxnHashToMsgDeSoTxn": decodeMsgDeSoTxn,
+
+	"PrefixReposterPubKeyRepostedPostHashToRepostPostHash": decodeEntry(func() DeSoDecoder { return &RepostEntry{} }),
+	"PrefixDiamondReceiverPKIDDiamondSenderPKIDPostHash":   decodeEntry(func() DeSoDecoder { return &DiamondEntry{} }),
+	"PrefixDiamondSenderPKIDDiamondReceiverPKIDPostHash":   decodeEntry(func() DeSoDecoder { return &DiamondEntry{} }),
+
+	"PrefixPostHashSerialNumberToNFTEntry":                            decodeEntry(func() DeSoDecoder { return &NFTEntry{} }),
+	"PrefixPKIDIsForSaleBidAmountNanosPostHashSerialNumberToNFTEntry": decodeEntry(func() DeSoDecoder { return &NFTEntry{} }),
+	"PrefixBidderPKIDPostHashSerialNumberToBidNanos":                  decodeUint64BigEndian,
+
+	"PrefixPublicKeyToDeSoBalanceNanos": decodeUint64BigEndian,
+
+	"PrefixHODLerPKIDCreatorPKIDToDAOCoinBalanceEntry": decodeEntry(func() DeSoDecoder { return &BalanceEntry{} }),
+	"PrefixCreatorPKIDHODLerPKIDToDAOCoinBalanceEntry": decodeEntry(func() DeSoDecoder { return &BalanceEntry{} }),
+
+	"PrefixDAOCoinLimitOrder":                 decodeEntry(func() DeSoDecoder { return &DAOCoinLimitOrderEntry{} }),
+	"PrefixDAOCoinLimitOrderByTransactorPKID": decodeEntry(func() DeSoDecoder { return &DAOCoinLimitOrderEntry{} }),
+	"PrefixDAOCoinLimitOrderByOrderID":        decodeEntry(func() DeSoDecoder { return &DAOCoinLimitOrderEntry{} }),
+
+	"PrefixUserAssociationByTransactor": decodeRawBlockHash,
+	"PrefixUserAssociationByTargetUser": decodeRawBlockHash,
+	"PrefixUserAssociationByUsers":      decodeRawBlockHash,
+	"PrefixPostAssociationByTransactor": decodeRawBlockHash,
+	"PrefixPostAssociationByPost":       decodeRawBlockHash,
+	"PrefixPostAssociationByType":       decodeRawBlockHash,
+}
+
+// decodeValue decodes a value stored under prefix. It returns nil without an
+// error when there is no decoder for the prefix or the value is empty.
+func decodeValue(prefix *namedPrefix, data []byte) (interface{}, error) {
+	if prefix == nil || len(data) == 0 {
+		return nil, nil
+	}
+	decoder, exists := valueDecoders[prefix.Name]
+	if !exists {
+		return nil, nil
+	}
+	return decoder(data)
+}
+
+// decodeEntry returns a decoder for entries written with core's EncodeToBytes.
+func decodeEntry(newDecoder func() DeSoDecoder) valueDecoder {
+	return func(data []byte) (interface{}, error) {
+		decoder := newDecoder()
+		exists, err := DecodeFromBytes(decoder, bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, nil
+		}
+		return decoder, nil
+	}
+}
+
+func decodeMsgDeSoTxn(data []byte) (interface{}, error) {
+	txn := &MsgDeSoTxn{}
+	if err := txn.FromBytes(data); err != nil {
+		return nil, err
+	}
+	return txn, nil
+}
+
+func decodeUint64BigEndian(data []byte) (interface{}, error) {
+	if len(data) != 8 {
+		return nil, fmt.Errorf("decodeUint64BigEndian: expected 8 bytes, got %d", len(data))
+	}
+	return binary.BigEndian.Uint64(data), nil
+}
+
+func decodeUint32BigEndian(data []byte) (interface{}, error) {
+	if len(data) != 4 {
+		return nil, fmt.Errorf("decodeUint32BigEndian: expected 4 bytes, got %d", len(data))
+	}
+	return binary.BigEndian.Uint32(data), nil
+}
+
+func decodeRawPKID(data []byte) (interface{}, error) {
+	var pkid PKID
+	if len(data) != len(pkid) {
+		return nil, fmt.Errorf("decodeRawPKID: expected %d bytes, got %d", len(pkid), len(data))
+	}
+	copy(pkid[:], data)
+	return pkid, nil
+}
+
+func decodeRawPublicKey(data []byte) (interface{}, error) {
+	if len(data) != 33 {
+		return nil, fmt.Errorf("decodeRawPublicKey: expected 33 bytes, got %d", len(data))
+	}
+	return PublicKey(data), nil
+}
+
+func decodeRawBlockHash(data []byte) (interface{}, error) {
+	var hash BlockHash
+	if len(data) != len(hash) {
+		return nil, fmt.Errorf("decodeRawBlockHash: expected %d bytes, got %d", len(hash), len(data))
+	}
+	copy(hash[:], data)
+	return hash, nil
+}
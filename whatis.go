@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// keyIdentity is the prefix a raw key belongs to and the key decoded with the
+// layout of that prefix.
+type keyIdentity struct {
+	Key    string       `json:"key"`
+	Prefix *namedPrefix `json:"prefix"`
+	// Layout is the documented layout of the key after the prefix, e.g.
+	// "pkid PKID".
+	Layout []string    `json:"layout"`
+	Fields []*keyField `json:"fields"`
+	// KeyError is set when the key doesn't match the layout. Fields then holds
+	// whatever could be decoded before that.
+	KeyError string `json:"keyError,omitempty"`
+}
+
+// identifyKey maps the leading byte of key to its DBPrefixes field and decodes
+// the rest of the key. It fails only if no prefix matches.
+func identifyKey(key []byte) (*keyIdentity, error) {
+	if len(key) == 0 {
+		return nil, fmt.Errorf("identifyKey: empty key")
+	}
+	prefix := prefixForKey(key)
+	if prefix == nil {
+		return nil, fmt.Errorf("identifyKey: no prefix has id %d, it isn't mapped in DBPrefixes", key[0])
+	}
+
+	identity := &keyIdentity{Key: hex.EncodeToString(key), Prefix: prefix, Layout: []string{}}
+	for _, part := range keySchemas[prefix.Name] {
+		identity.Layout = append(identity.Layout, part.Name+" "+part.Type.String())
+	}
+	fields, err := decodeKey(prefix, key)
+	identity.Fields = fields
+	if err != nil {
+		identity.KeyError = err.Error()
+	}
+	return identity, nil
+}
+
+// parseRawKey decodes a key given on the command line. Keys are read as hex,
+// with or without a leading 0x, and as base64 if they aren't valid hex.
+func parseRawKey(input string) ([]byte, error) {
+	input = strings.TrimSpace(input)
+	if key, err := hex.DecodeString(strings.TrimPrefix(input, "0x")); err == nil {
+		return key, nil
+	}
+	for _, encoding := range []*base64.Encoding{base64.StdEncoding, base64.URLEncoding, base64.RawStdEncoding, base64.RawURLEncoding} {
+		if key, err := encoding.DecodeString(input); err == nil {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("key %q is neither hex nor base64", input)
+}